@@ -2,12 +2,21 @@ package main
 
 import (
 	"log"
+	"os"
 
 	"github.com/m1al04949/avito-tech-service/internal/app"
 )
 
 func main() {
 
+	// "avito-tech-service migrate ..." manages database schema and exits
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		if err := app.RunMigrate(os.Args[2:]); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
 	if err := app.RunServer(); err != nil {
 		log.Fatal(err)
 	}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/m1al04949/avito-tech-service/internal/lib/cursor"
+	"github.com/m1al04949/avito-tech-service/internal/lib/response/segmentsconv"
+	"github.com/m1al04949/avito-tech-service/internal/model"
+	"github.com/m1al04949/avito-tech-service/internal/storage"
+	"github.com/m1al04949/avito-tech-service/pkg/client"
+)
+
+// Operations available both through the service API and directly in DB
+type backend interface {
+	CreateSegment(ctx context.Context, slug string, autoPercent int) error
+	DeleteSegment(ctx context.Context, slug string) error
+	GetSegment(ctx context.Context, slug string) (client.Segment, error)
+	ListSegments(ctx context.Context, opts client.ListSegmentsOptions) (client.SegmentsPage, error)
+	ExportSegmentUsers(ctx context.Context, slug string, fn func(user int) error) error
+	CreateUser(ctx context.Context, user int) error
+	DeleteUser(ctx context.Context, user int) error
+	GetUserSegments(ctx context.Context, user int) ([]string, error)
+	AddSegmentsToUser(ctx context.Context, user int, segments []client.UserSegment) ([]client.SegmentResult, error)
+	RemoveSegmentsFromUser(ctx context.Context, user int, slugs []string) ([]client.SegmentResult, error)
+}
+
+var _ backend = (*client.Client)(nil)
+
+const defaultListLimit = 50
+
+// dbBackend works with storage directly, bypassing the service
+type dbBackend struct {
+	store storage.Repository
+}
+
+func (b dbBackend) CreateSegment(ctx context.Context, slug string, autoPercent int) error {
+	return b.store.SaveSegm(ctx, slug, autoPercent)
+}
+
+func (b dbBackend) DeleteSegment(ctx context.Context, slug string) error {
+	return b.store.DeleteSegm(ctx, slug)
+}
+
+func (b dbBackend) GetSegment(ctx context.Context, slug string) (client.Segment, error) {
+	segment, err := b.store.GetSegm(ctx, slug)
+	if err != nil {
+		return client.Segment{}, err
+	}
+
+	return segmentConv(segment), nil
+}
+
+func (b dbBackend) ListSegments(ctx context.Context, opts client.ListSegmentsOptions) (client.SegmentsPage, error) {
+	filter := model.SegmentsFilter{
+		Prefix: opts.Prefix,
+		SortBy: opts.SortBy,
+		Desc:   opts.Desc,
+		Limit:  opts.Limit,
+	}
+	if filter.SortBy == "" {
+		filter.SortBy = model.SortByName
+	}
+	if filter.Limit <= 0 {
+		filter.Limit = defaultListLimit
+	}
+	if opts.Cursor != "" {
+		var after model.Segments
+		if err := cursor.Decode(opts.Cursor, &after); err != nil {
+			return client.SegmentsPage{}, errors.New("invalid cursor")
+		}
+		filter.After = &after
+	}
+
+	limit := filter.Limit
+	filter.Limit++
+
+	segments, err := b.store.ListSegms(ctx, filter)
+	if err != nil {
+		return client.SegmentsPage{}, err
+	}
+
+	var page client.SegmentsPage
+	if len(segments) > limit {
+		segments = segments[:limit]
+		page.NextCursor, err = cursor.Encode(segments[limit-1])
+		if err != nil {
+			return client.SegmentsPage{}, err
+		}
+	}
+	for _, v := range segments {
+		page.Segments = append(page.Segments, segmentConv(v))
+	}
+
+	return page, nil
+}
+
+func (b dbBackend) ExportSegmentUsers(ctx context.Context, slug string, fn func(user int) error) error {
+	return b.store.StreamSegmUsers(ctx, slug, fn)
+}
+
+func (b dbBackend) CreateUser(ctx context.Context, user int) error {
+	return b.store.SaveUser(ctx, user)
+}
+
+func (b dbBackend) DeleteUser(ctx context.Context, user int) error {
+	return b.store.DeleteUser(ctx, user)
+}
+
+func (b dbBackend) GetUserSegments(ctx context.Context, user int) ([]string, error) {
+	return b.store.GetUser(ctx, user)
+}
+
+func (b dbBackend) AddSegmentsToUser(ctx context.Context, user int, segments []client.UserSegment) (
+	[]client.SegmentResult, error) {
+
+	segms := make([]model.Segment, 0, len(segments))
+	for _, v := range segments {
+		segm := model.Segment{Slug: v.Slug, ExpiresAt: v.ExpiresAt}
+		if v.TTL != 0 {
+			segm.TTL = v.TTL.String()
+		}
+		segms = append(segms, segm)
+	}
+
+	userSegms, err := segmentsconv.UserSegmentsConv(user, segms, time.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	results, err := b.store.SaveSegmToUser(ctx, user, userSegms)
+	if err != nil {
+		return nil, err
+	}
+
+	return resultsConv(results), nil
+}
+
+func (b dbBackend) RemoveSegmentsFromUser(ctx context.Context, user int, slugs []string) (
+	[]client.SegmentResult, error) {
+
+	results, err := b.store.DeleteSegmFromUser(ctx, user, slugs)
+	if err != nil {
+		return nil, err
+	}
+
+	return resultsConv(results), nil
+}
+
+func segmentConv(s model.Segments) client.Segment {
+	return client.Segment{
+		Slug:        s.SegmentName,
+		AutoPercent: s.AutoPercent,
+		CreatedAt:   s.CreatedAt,
+		Users:       s.Users,
+	}
+}
+
+func resultsConv(results []model.SegmentResult) []client.SegmentResult {
+	res := make([]client.SegmentResult, 0, len(results))
+	for _, v := range results {
+		res = append(res, client.SegmentResult{Slug: v.Slug, Result: v.Result})
+	}
+
+	return res
+}
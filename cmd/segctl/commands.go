@@ -0,0 +1,404 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/m1al04949/avito-tech-service/pkg/client"
+)
+
+func newFlagSet(name string) *flag.FlagSet {
+	return flag.NewFlagSet(name, flag.ContinueOnError)
+}
+
+// Parse command flags and check number of positional arguments
+func parseArgs(fs *flag.FlagSet, args []string, min, max int) ([]string, error) {
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+	if fs.NArg() < min || (max >= 0 && fs.NArg() > max) {
+		return nil, fmt.Errorf("%s: wrong number of arguments", fs.Name())
+	}
+
+	return fs.Args(), nil
+}
+
+func parseUser(s string) (int, error) {
+	user, err := strconv.Atoi(s)
+	if err != nil || user <= 0 {
+		return 0, fmt.Errorf("invalid user id %q", s)
+	}
+
+	return user, nil
+}
+
+func (c *cli) done(message string) error {
+	return c.out.print(struct {
+		Status string `json:"status"`
+	}{message}, []string{"STATUS"}, [][]string{{message}})
+}
+
+func (c *cli) segmentCreate(ctx context.Context, args []string) error {
+	fs := newFlagSet("segment create")
+	autoPercent := fs.Int("auto-percent", 0, "percent of existing users added to segment")
+	args, err := parseArgs(fs, args, 1, 1)
+	if err != nil {
+		return err
+	}
+
+	if err := c.backend.CreateSegment(ctx, args[0], *autoPercent); err != nil {
+		return err
+	}
+
+	return c.done("segment created")
+}
+
+func (c *cli) segmentDelete(ctx context.Context, args []string) error {
+	args, err := parseArgs(newFlagSet("segment delete"), args, 1, 1)
+	if err != nil {
+		return err
+	}
+
+	if err := c.backend.DeleteSegment(ctx, args[0]); err != nil {
+		return err
+	}
+
+	return c.done("segment deleted")
+}
+
+func (c *cli) segmentGet(ctx context.Context, args []string) error {
+	args, err := parseArgs(newFlagSet("segment get"), args, 1, 1)
+	if err != nil {
+		return err
+	}
+
+	segment, err := c.backend.GetSegment(ctx, args[0])
+	if err != nil {
+		return err
+	}
+
+	return c.printSegments(segment, []client.Segment{segment})
+}
+
+func (c *cli) segmentList(ctx context.Context, args []string) error {
+	fs := newFlagSet("segment list")
+	opts := client.ListSegmentsOptions{Limit: 1000}
+	fs.StringVar(&opts.Prefix, "prefix", "", "list segments with name prefix")
+	fs.StringVar(&opts.SortBy, "sort", client.SortByName, "sort by name, created_at or size")
+	fs.BoolVar(&opts.Desc, "desc", false, "descending order")
+	if _, err := parseArgs(fs, args, 0, 0); err != nil {
+		return err
+	}
+
+	segments := []client.Segment{}
+	for {
+		page, err := c.backend.ListSegments(ctx, opts)
+		if err != nil {
+			return err
+		}
+		segments = append(segments, page.Segments...)
+		if page.NextCursor == "" {
+			break
+		}
+		opts.Cursor = page.NextCursor
+	}
+
+	return c.printSegments(segments, segments)
+}
+
+func (c *cli) printSegments(v any, segments []client.Segment) error {
+	rows := make([][]string, 0, len(segments))
+	for _, s := range segments {
+		rows = append(rows, []string{
+			s.Slug,
+			strconv.Itoa(s.AutoPercent),
+			strconv.Itoa(s.Users),
+			s.CreatedAt.Format(time.RFC3339),
+		})
+	}
+
+	return c.out.print(v, []string{"SLUG", "AUTO_PERCENT", "USERS", "CREATED_AT"}, rows)
+}
+
+func (c *cli) segmentMembers(ctx context.Context, args []string) error {
+	args, err := parseArgs(newFlagSet("segment members"), args, 1, 1)
+	if err != nil {
+		return err
+	}
+
+	users := []int{}
+	if err := c.backend.ExportSegmentUsers(ctx, args[0], func(user int) error {
+		users = append(users, user)
+		return nil
+	}); err != nil {
+		return err
+	}
+
+	rows := make([][]string, 0, len(users))
+	for _, u := range users {
+		rows = append(rows, []string{strconv.Itoa(u)})
+	}
+
+	return c.out.print(users, []string{"USER_ID"}, rows)
+}
+
+func (c *cli) userCreate(ctx context.Context, args []string) error {
+	args, err := parseArgs(newFlagSet("user create"), args, 1, 1)
+	if err != nil {
+		return err
+	}
+	user, err := parseUser(args[0])
+	if err != nil {
+		return err
+	}
+
+	if err := c.backend.CreateUser(ctx, user); err != nil {
+		return err
+	}
+
+	return c.done("user created")
+}
+
+func (c *cli) userDelete(ctx context.Context, args []string) error {
+	args, err := parseArgs(newFlagSet("user delete"), args, 1, 1)
+	if err != nil {
+		return err
+	}
+	user, err := parseUser(args[0])
+	if err != nil {
+		return err
+	}
+
+	if err := c.backend.DeleteUser(ctx, user); err != nil {
+		return err
+	}
+
+	return c.done("user deleted")
+}
+
+func (c *cli) userGet(ctx context.Context, args []string) error {
+	args, err := parseArgs(newFlagSet("user get"), args, 1, 1)
+	if err != nil {
+		return err
+	}
+	user, err := parseUser(args[0])
+	if err != nil {
+		return err
+	}
+
+	segments, err := c.backend.GetUserSegments(ctx, user)
+	if err != nil {
+		return err
+	}
+
+	rows := make([][]string, 0, len(segments))
+	for _, s := range segments {
+		rows = append(rows, []string{s})
+	}
+
+	return c.out.print(struct {
+		UserID   int      `json:"user_id"`
+		Segments []string `json:"segments"`
+	}{user, segments}, []string{"SLUG"}, rows)
+}
+
+func (c *cli) userAssign(ctx context.Context, args []string) error {
+	fs := newFlagSet("user assign")
+	ttl := fs.Duration("ttl", 0, "membership duration, e.g. 168h")
+	expiresAt := fs.String("expires-at", "", "membership end in RFC3339")
+	args, err := parseArgs(fs, args, 2, -1)
+	if err != nil {
+		return err
+	}
+	user, err := parseUser(args[0])
+	if err != nil {
+		return err
+	}
+
+	var expires *time.Time
+	if *expiresAt != "" {
+		t, err := time.Parse(time.RFC3339, *expiresAt)
+		if err != nil {
+			return fmt.Errorf("invalid expires-at: %w", err)
+		}
+		expires = &t
+	}
+
+	segments := make([]client.UserSegment, 0, len(args)-1)
+	for _, slug := range args[1:] {
+		segments = append(segments, client.UserSegment{Slug: slug, TTL: *ttl, ExpiresAt: expires})
+	}
+
+	results, err := c.backend.AddSegmentsToUser(ctx, user, segments)
+	if err != nil {
+		return err
+	}
+
+	return c.printResults(results)
+}
+
+func (c *cli) userUnassign(ctx context.Context, args []string) error {
+	args, err := parseArgs(newFlagSet("user unassign"), args, 2, -1)
+	if err != nil {
+		return err
+	}
+	user, err := parseUser(args[0])
+	if err != nil {
+		return err
+	}
+
+	results, err := c.backend.RemoveSegmentsFromUser(ctx, user, args[1:])
+	if err != nil {
+		return err
+	}
+
+	return c.printResults(results)
+}
+
+func (c *cli) printResults(results []client.SegmentResult) error {
+	rows := make([][]string, 0, len(results))
+	for _, r := range results {
+		rows = append(rows, []string{r.Slug, r.Result})
+	}
+
+	return c.out.print(results, []string{"SLUG", "RESULT"}, rows)
+}
+
+// Assign memberships from CSV file with rows user_id,slug[,ttl|expires_at]
+func (c *cli) importFile(ctx context.Context, args []string) error {
+	args, err := parseArgs(newFlagSet("import"), args, 1, 1)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.Open(args[0])
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	// Segments of every user in order of appearance
+	var users []int
+	memberships := make(map[int][]client.UserSegment)
+
+	cr := csv.NewReader(f)
+	cr.FieldsPerRecord = -1
+	cr.TrimLeadingSpace = true
+	for line := 1; ; line++ {
+		row, err := cr.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		if len(row) < 2 || len(row) > 3 {
+			return fmt.Errorf("line %d: expected user_id,slug[,ttl|expires_at]", line)
+		}
+
+		user, err := parseUser(row[0])
+		if err != nil {
+			// Header of the file
+			if line == 1 {
+				continue
+			}
+			return fmt.Errorf("line %d: %w", line, err)
+		}
+
+		segment := client.UserSegment{Slug: row[1]}
+		if len(row) == 3 && row[2] != "" {
+			if segment.TTL, err = time.ParseDuration(row[2]); err != nil {
+				t, err := time.Parse(time.RFC3339, row[2])
+				if err != nil {
+					return fmt.Errorf("line %d: invalid ttl or expires_at %q", line, row[2])
+				}
+				segment.ExpiresAt = &t
+			}
+		}
+
+		if _, ok := memberships[user]; !ok {
+			users = append(users, user)
+		}
+		memberships[user] = append(memberships[user], segment)
+	}
+
+	type userResult struct {
+		UserID  int                    `json:"user_id"`
+		Results []client.SegmentResult `json:"results,omitempty"`
+		Error   string                 `json:"error,omitempty"`
+	}
+
+	var (
+		report []userResult
+		rows   [][]string
+		failed int
+	)
+	for _, user := range users {
+		res := userResult{UserID: user}
+		res.Results, err = c.backend.AddSegmentsToUser(ctx, user, memberships[user])
+		if err != nil {
+			res.Error = err.Error()
+			failed++
+			rows = append(rows, []string{strconv.Itoa(user), "", res.Error})
+		}
+		for _, r := range res.Results {
+			rows = append(rows, []string{strconv.Itoa(user), r.Slug, r.Result})
+		}
+		report = append(report, res)
+	}
+
+	if err := c.out.print(report, []string{"USER_ID", "SLUG", "RESULT"}, rows); err != nil {
+		return err
+	}
+	if failed > 0 {
+		return fmt.Errorf("import failed for %d of %d users", failed, len(users))
+	}
+
+	return nil
+}
+
+// Write memberships of segment as CSV file, which can be imported back
+func (c *cli) exportFile(ctx context.Context, args []string) error {
+	fs := newFlagSet("export")
+	file := fs.String("file", "", "output file, stdout by default")
+	args, err := parseArgs(fs, args, 1, 1)
+	if err != nil {
+		return err
+	}
+	slug := args[0]
+
+	w := io.Writer(os.Stdout)
+	if *file != "" {
+		f, err := os.Create(*file)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		w = f
+	}
+
+	cw := csv.NewWriter(w)
+	if err := c.backend.ExportSegmentUsers(ctx, slug, func(user int) error {
+		return cw.Write([]string{strconv.Itoa(user), slug})
+	}); err != nil {
+		return err
+	}
+	cw.Flush()
+
+	return cw.Error()
+}
+
+func (c *cli) migrate(ctx context.Context, args []string) error {
+	if c.migrator == nil {
+		return errors.New("migrate: -database-url or -storage-path is required")
+	}
+
+	return c.migrator.Run(ctx, args, c.out.w)
+}
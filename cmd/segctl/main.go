@@ -0,0 +1,186 @@
+// Command segctl operates avito-tech-service through its API or directly in DB
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/m1al04949/avito-tech-service/internal/storage"
+	"github.com/m1al04949/avito-tech-service/internal/storage/migrate"
+	"github.com/m1al04949/avito-tech-service/internal/storage/sqlite"
+	"github.com/m1al04949/avito-tech-service/pkg/client"
+)
+
+const usage = `Usage: segctl [flags] <command> [args]
+
+Commands:
+  segment create [-auto-percent N] SLUG     create segment
+  segment delete SLUG                       delete segment
+  segment get SLUG                          show segment and its size
+  segment list [-prefix P] [-sort S] [-desc] list segments
+  segment members SLUG                      list all users of segment
+  user create ID                            create user
+  user delete ID                            delete user
+  user get ID                               show active segments of user
+  user assign [-ttl D | -expires-at T] ID SLUG...  add segments to user
+  user unassign ID SLUG...                  remove segments from user
+  import FILE                               assign memberships from CSV file (user_id,slug[,ttl|expires_at])
+  export [-file FILE] SLUG                  write memberships of segment as CSV (user_id,slug)
+  migrate [up | down [N] | version]         manage DB schema (requires -database-url or -storage-path)
+
+Flags:
+`
+
+// Default timeout of the whole command. Commands which go over all memberships of segment,
+// file or DB schema run until done, since their duration depends on the size of data
+const defaultTimeout = time.Minute
+
+var unlimitedCommands = map[string]bool{"import": true, "export": true, "migrate": true}
+
+type cli struct {
+	backend backend
+	out     printer
+	// Set when DB is opened directly
+	migrator *migrate.Migrator
+}
+
+func main() {
+	if err := run(os.Args[1:]); err != nil {
+		fmt.Fprintln(os.Stderr, "segctl:", err)
+		os.Exit(1)
+	}
+}
+
+func run(args []string) error {
+	fs := flag.NewFlagSet("segctl", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprint(fs.Output(), usage)
+		fs.PrintDefaults()
+	}
+
+	addr := fs.String("addr", envOr("SEGCTL_ADDR", "http://localhost:8080"), "service address, $SEGCTL_ADDR")
+	user := fs.String("user", os.Getenv("SEGCTL_USER"), "service user, $SEGCTL_USER")
+	password := fs.String("password", os.Getenv("SEGCTL_PASSWORD"), "service password, $SEGCTL_PASSWORD")
+	dbURL := fs.String("database-url", os.Getenv("SEGCTL_DATABASE_URL"),
+		"work with Postgres directly instead of the service, $SEGCTL_DATABASE_URL")
+	storagePath := fs.String("storage-path", os.Getenv("SEGCTL_STORAGE_PATH"),
+		"work with SQLite DB file directly instead of the service, $SEGCTL_STORAGE_PATH")
+	output := fs.String("o", outputTable, "output format: table or json")
+	timeout := fs.Duration("timeout", 0,
+		"timeout of the whole command, 1m by default and none for import, export and migrate")
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return errors.New("command is not set")
+	}
+	if *output != outputTable && *output != outputJSON {
+		return fmt.Errorf("unknown output format %q", *output)
+	}
+
+	c := &cli{
+		out: printer{w: os.Stdout, mode: *output},
+	}
+
+	var err error
+	switch {
+	case *dbURL != "" && *storagePath != "":
+		return errors.New("-database-url and -storage-path can't be used together")
+	case *dbURL != "":
+		store := storage.New("", *dbURL)
+		if err := store.Open(); err != nil {
+			return fmt.Errorf("open storage: %w", err)
+		}
+		defer store.Close()
+		if c.migrator, err = store.Migrator(); err != nil {
+			return err
+		}
+		c.backend = dbBackend{store: store}
+	case *storagePath != "":
+		store := sqlite.New(*storagePath)
+		if err := store.Open(); err != nil {
+			return fmt.Errorf("open storage: %w", err)
+		}
+		defer store.Close()
+		if c.migrator, err = store.Migrator(); err != nil {
+			return err
+		}
+		c.backend = dbBackend{store: store}
+	default:
+		opts := []client.Option{client.WithBasicAuth(*user, *password)}
+		// Export is a single streamed response, it is limited by the command timeout only
+		if fs.Arg(0) == "export" {
+			opts = append(opts, client.WithTimeout(0))
+		}
+		if c.backend, err = client.New(*addr, opts...); err != nil {
+			return err
+		}
+	}
+
+	ctx := context.Background()
+	if d := commandTimeout(fs.Arg(0), *timeout); d > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, d)
+		defer cancel()
+	}
+
+	return c.dispatch(ctx, fs.Args())
+}
+
+func (c *cli) dispatch(ctx context.Context, args []string) error {
+	cmd, args := args[0], args[1:]
+
+	switch cmd {
+	case "segment", "user":
+		if len(args) == 0 {
+			return fmt.Errorf("%s: subcommand is not set", cmd)
+		}
+		sub, args := args[0], args[1:]
+		fn, ok := map[string]func(context.Context, []string) error{
+			"segment create":  c.segmentCreate,
+			"segment delete":  c.segmentDelete,
+			"segment get":     c.segmentGet,
+			"segment list":    c.segmentList,
+			"segment members": c.segmentMembers,
+			"user create":     c.userCreate,
+			"user delete":     c.userDelete,
+			"user get":        c.userGet,
+			"user assign":     c.userAssign,
+			"user unassign":   c.userUnassign,
+		}[cmd+" "+sub]
+		if !ok {
+			return fmt.Errorf("unknown command %q", cmd+" "+sub)
+		}
+		return fn(ctx, args)
+	case "import":
+		return c.importFile(ctx, args)
+	case "export":
+		return c.exportFile(ctx, args)
+	case "migrate":
+		return c.migrate(ctx, args)
+	default:
+		return fmt.Errorf("unknown command %q", cmd)
+	}
+}
+
+// commandTimeout returns timeout set by flag or the default one of cmd, zero means no limit
+func commandTimeout(cmd string, timeout time.Duration) time.Duration {
+	if timeout > 0 || unlimitedCommands[cmd] {
+		return timeout
+	}
+
+	return defaultTimeout
+}
+
+func envOr(key, def string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return def
+}
@@ -0,0 +1,235 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/m1al04949/avito-tech-service/pkg/client"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeBackend records assigned memberships and fails users from failUsers
+type fakeBackend struct {
+	backend
+	assigned  map[int][]client.UserSegment
+	failUsers map[int]bool
+	calls     []string
+}
+
+func (b *fakeBackend) AddSegmentsToUser(_ context.Context, user int, segments []client.UserSegment) (
+	[]client.SegmentResult, error) {
+	if b.failUsers[user] {
+		return nil, errors.New("user not exists")
+	}
+	if b.assigned == nil {
+		b.assigned = make(map[int][]client.UserSegment)
+	}
+	b.assigned[user] = append(b.assigned[user], segments...)
+
+	results := make([]client.SegmentResult, 0, len(segments))
+	for _, s := range segments {
+		results = append(results, client.SegmentResult{Slug: s.Slug, Result: "added"})
+	}
+
+	return results, nil
+}
+
+func (b *fakeBackend) CreateSegment(_ context.Context, slug string, autoPercent int) error {
+	b.calls = append(b.calls, "segment create "+slug)
+	return nil
+}
+
+func (b *fakeBackend) DeleteUser(_ context.Context, user int) error {
+	b.calls = append(b.calls, "user delete")
+	return nil
+}
+
+func (b *fakeBackend) GetUserSegments(context.Context, int) ([]string, error) {
+	return []string{"AVITO_VOICE", "AVITO_DISCOUNT_30"}, nil
+}
+
+func TestParseArgs(t *testing.T) {
+	for name, tc := range map[string]struct {
+		args     []string
+		min, max int
+		want     []string
+		wantErr  bool
+	}{
+		"exact":           {args: []string{"AVITO"}, min: 1, max: 1, want: []string{"AVITO"}},
+		"flags first":     {args: []string{"-ttl", "1h", "1000", "AVITO"}, min: 2, max: -1, want: []string{"1000", "AVITO"}},
+		"unlimited":       {args: []string{"1000", "A", "B", "C"}, min: 2, max: -1, want: []string{"1000", "A", "B", "C"}},
+		"none":            {args: nil, min: 0, max: 0},
+		"too few":         {args: []string{"1000"}, min: 2, max: -1, wantErr: true},
+		"too many":        {args: []string{"A", "B"}, min: 1, max: 1, wantErr: true},
+		"unknown flag":    {args: []string{"-percent", "10", "AVITO"}, min: 1, max: 1, wantErr: true},
+		"bad flag value":  {args: []string{"-ttl", "week", "1000", "AVITO"}, min: 2, max: -1, wantErr: true},
+		"flags after arg": {args: []string{"AVITO", "-ttl", "1h"}, min: 1, max: 1, wantErr: true},
+	} {
+		fs := newFlagSet("test")
+		fs.SetOutput(&bytes.Buffer{})
+		fs.Duration("ttl", 0, "")
+
+		got, err := parseArgs(fs, tc.args, tc.min, tc.max)
+		if tc.wantErr {
+			require.Error(t, err, name)
+			continue
+		}
+		require.NoError(t, err, name)
+		require.Equal(t, tc.want, got, name)
+	}
+}
+
+func TestImportFile(t *testing.T) {
+	expires := time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	for name, tc := range map[string]struct {
+		csv     string
+		want    map[int][]client.UserSegment
+		wantErr string
+	}{
+		"header is skipped": {
+			csv: "user_id,slug\n1000,AVITO_VOICE\n",
+			want: map[int][]client.UserSegment{
+				1000: {{Slug: "AVITO_VOICE"}},
+			},
+		},
+		"without header": {
+			csv: "1000,AVITO_VOICE\n1001,AVITO_VOICE\n1000,AVITO_DISCOUNT_30\n",
+			want: map[int][]client.UserSegment{
+				1000: {{Slug: "AVITO_VOICE"}, {Slug: "AVITO_DISCOUNT_30"}},
+				1001: {{Slug: "AVITO_VOICE"}},
+			},
+		},
+		"ttl and expires_at": {
+			csv: "user_id,slug,expires\n1000,AVITO_VOICE,168h\n1000,AVITO_DISCOUNT_30,2030-01-01T00:00:00Z\n1000,AVITO_PERFORMANCE,\n",
+			want: map[int][]client.UserSegment{
+				1000: {
+					{Slug: "AVITO_VOICE", TTL: 168 * time.Hour},
+					{Slug: "AVITO_DISCOUNT_30", ExpiresAt: &expires},
+					{Slug: "AVITO_PERFORMANCE"},
+				},
+			},
+		},
+		"header is only first line": {
+			csv:     "user_id,slug\n1000,AVITO_VOICE\nuser_id,slug\n",
+			wantErr: "line 3: invalid user id",
+		},
+		"invalid user": {
+			csv:     "1000,AVITO_VOICE\n-1,AVITO_VOICE\n",
+			wantErr: "line 2: invalid user id",
+		},
+		"invalid expiration": {
+			csv:     "user_id,slug\n1000,AVITO_VOICE,1h\n1000,AVITO_VOICE,tomorrow\n",
+			wantErr: `line 3: invalid ttl or expires_at "tomorrow"`,
+		},
+		"wrong number of fields": {
+			csv:     "1000,AVITO_VOICE\n1000\n",
+			wantErr: "line 2: expected user_id,slug[,ttl|expires_at]",
+		},
+	} {
+		b := &fakeBackend{}
+		c := &cli{backend: b, out: printer{w: &bytes.Buffer{}, mode: outputTable}}
+
+		err := c.importFile(context.Background(), []string{writeFile(t, tc.csv)})
+		if tc.wantErr != "" {
+			require.ErrorContains(t, err, tc.wantErr, name)
+			require.Empty(t, b.assigned, name)
+			continue
+		}
+		require.NoError(t, err, name)
+		require.Equal(t, tc.want, b.assigned, name)
+	}
+}
+
+func TestImportFileReport(t *testing.T) {
+	file := writeFile(t, "1000,AVITO_VOICE\n1001,AVITO_VOICE\n")
+	b := &fakeBackend{failUsers: map[int]bool{1001: true}}
+
+	var table bytes.Buffer
+	c := &cli{backend: b, out: printer{w: &table, mode: outputTable}}
+	require.EqualError(t, c.importFile(context.Background(), []string{file}), "import failed for 1 of 2 users")
+	require.Equal(t, "USER_ID  SLUG         RESULT\n"+
+		"1000     AVITO_VOICE  added\n"+
+		"1001                  user not exists\n", table.String())
+
+	var js bytes.Buffer
+	c.out = printer{w: &js, mode: outputJSON}
+	require.Error(t, c.importFile(context.Background(), []string{file}))
+	require.JSONEq(t, `[
+		{"user_id": 1000, "results": [{"slug": "AVITO_VOICE", "result": "added"}]},
+		{"user_id": 1001, "error": "user not exists"}
+	]`, js.String())
+}
+
+func TestDispatch(t *testing.T) {
+	for name, tc := range map[string]struct {
+		args    []string
+		call    string
+		wantErr string
+	}{
+		"segment":            {args: []string{"segment", "create", "-auto-percent", "10", "AVITO"}, call: "segment create AVITO"},
+		"user":               {args: []string{"user", "delete", "1000"}, call: "user delete"},
+		"unknown command":    {args: []string{"group"}, wantErr: `unknown command "group"`},
+		"unknown subcommand": {args: []string{"user", "rename", "1000"}, wantErr: `unknown command "user rename"`},
+		"no subcommand":      {args: []string{"segment"}, wantErr: "segment: subcommand is not set"},
+		"invalid user":       {args: []string{"user", "delete", "abc"}, wantErr: `invalid user id "abc"`},
+		"migrate without db": {args: []string{"migrate", "up"}, wantErr: "migrate: -database-url or -storage-path is required"},
+	} {
+		b := &fakeBackend{}
+		c := &cli{backend: b, out: printer{w: &bytes.Buffer{}, mode: outputTable}}
+
+		err := c.dispatch(context.Background(), tc.args)
+		if tc.wantErr != "" {
+			require.EqualError(t, err, tc.wantErr, name)
+			require.Empty(t, b.calls, name)
+			continue
+		}
+		require.NoError(t, err, name)
+		require.Equal(t, []string{tc.call}, b.calls, name)
+	}
+}
+
+func TestOutput(t *testing.T) {
+	var table bytes.Buffer
+	c := &cli{backend: &fakeBackend{}, out: printer{w: &table, mode: outputTable}}
+	require.NoError(t, c.dispatch(context.Background(), []string{"user", "get", "1000"}))
+	require.Equal(t, "SLUG\nAVITO_VOICE\nAVITO_DISCOUNT_30\n", table.String())
+
+	var js bytes.Buffer
+	c.out = printer{w: &js, mode: outputJSON}
+	require.NoError(t, c.dispatch(context.Background(), []string{"user", "get", "1000"}))
+	require.JSONEq(t, `{"user_id": 1000, "segments": ["AVITO_VOICE", "AVITO_DISCOUNT_30"]}`, js.String())
+
+	require.EqualError(t, run([]string{"-o", "yaml", "user", "get", "1000"}), `unknown output format "yaml"`)
+}
+
+func TestCommandTimeout(t *testing.T) {
+	for _, tc := range []struct {
+		cmd     string
+		timeout time.Duration
+		want    time.Duration
+	}{
+		{cmd: "user", want: defaultTimeout},
+		{cmd: "segment", timeout: time.Hour, want: time.Hour},
+		{cmd: "import", want: 0},
+		{cmd: "export", want: 0},
+		{cmd: "migrate", want: 0},
+		{cmd: "export", timeout: time.Hour, want: time.Hour},
+	} {
+		require.Equal(t, tc.want, commandTimeout(tc.cmd, tc.timeout), tc.cmd)
+	}
+}
+
+func writeFile(t *testing.T, content string) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "memberships.csv")
+	require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+
+	return path
+}
@@ -1,23 +1,35 @@
 package app
 
 import (
-	"fmt"
+	"context"
+	"crypto/tls"
+	"errors"
+	"net"
 	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
 
-	"github.com/go-chi/chi/v5"
-	"github.com/go-chi/chi/v5/middleware"
+	"github.com/m1al04949/avito-tech-service/internal/auth"
 	"github.com/m1al04949/avito-tech-service/internal/config"
-	"github.com/m1al04949/avito-tech-service/internal/http-server/handlers/addtouser"
-	"github.com/m1al04949/avito-tech-service/internal/http-server/handlers/adduser"
-	"github.com/m1al04949/avito-tech-service/internal/http-server/handlers/createsegment"
-	"github.com/m1al04949/avito-tech-service/internal/http-server/handlers/deletefromuser"
-	"github.com/m1al04949/avito-tech-service/internal/http-server/handlers/deletesegment"
-	"github.com/m1al04949/avito-tech-service/internal/http-server/handlers/deleteuser"
-	"github.com/m1al04949/avito-tech-service/internal/http-server/handlers/getuser"
-	"github.com/m1al04949/avito-tech-service/internal/http-server/middleware/mwlog"
+	grpcserver "github.com/m1al04949/avito-tech-service/internal/grpc-server"
+	"github.com/m1al04949/avito-tech-service/internal/health"
+	"github.com/m1al04949/avito-tech-service/internal/lib/tlsreload"
 	"github.com/m1al04949/avito-tech-service/internal/logger"
-	"github.com/m1al04949/avito-tech-service/internal/storage"
+	"github.com/m1al04949/avito-tech-service/internal/metrics"
+	"github.com/m1al04949/avito-tech-service/internal/reaper"
+	"github.com/m1al04949/avito-tech-service/internal/tracing"
 	"golang.org/x/exp/slog"
+	"google.golang.org/grpc"
+)
+
+const (
+	// Name of the service in traces
+	serviceName = "avito-tech-service"
+	// Limit of export of buffered spans on exit
+	tracingFlushTimeout = 5 * time.Second
 )
 
 func RunServer() error {
@@ -28,60 +40,236 @@ func RunServer() error {
 	// Log Initializing
 	log := logger.NewLog(cfg.Env)
 	log.Info("starting service", slog.String("env", cfg.Env))
+	// Config carries credentials, so only the fields known to be safe are logged
+	log.Debug("config is loaded",
+		slog.String("storage_type", cfg.StorageType),
+		slog.String("http_address", cfg.HTTPServer.Address),
+		slog.String("grpc_address", cfg.GRPCServer.Address),
+	)
 	log.Debug("debug messages are enabled")
 
+	// Stop on SIGINT and SIGTERM, second signal kills the process
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	// Tracing Initializing
+	shutdownTracing, err := tracing.Setup(ctx, cfg.Tracing, serviceName)
+	if err != nil {
+		log.Error("failed to init tracing", logger.Err(err))
+		return err
+	}
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), tracingFlushTimeout)
+		defer cancel()
+		if err := shutdownTracing(ctx); err != nil {
+			log.Error("failed to flush traces", logger.Err(err))
+		}
+	}()
+	log.Info("tracing is initialized", slog.String("exporter", cfg.Tracing.Exporter))
+
 	// Storage Initializing
-	store := storage.New(cfg.StoragePath, cfg.DatabaseURL)
-	if err := store.Open(); err != nil {
+	store, migrator, closeStore, err := openStorage(cfg)
+	if err != nil {
 		log.Error("failed to init storage", logger.Err(err))
 		return err
 	}
-	defer store.Close()
-	if err := store.CreateTabs(); err != nil {
-		log.Error("failed to init tabs", logger.Err(err))
+	defer closeStore()
+	rawStore := store
+
+	if err := prepareSchema(ctx, log, migrator, cfg.MigrateOnStart); err != nil {
+		log.Error("failed to prepare database schema", logger.Err(err))
+		return err
+	}
+	log.Info("storage is initialized", slog.String("type", cfg.StorageType))
+
+	readiness := &health.Readiness{}
+	addStorageChecks(readiness, store, migrator)
+
+	// Metrics Initializing
+	m := metrics.New()
+	addStorageMetrics(m, store, cfg.StorageType)
+
+	store = m.Storage(tracing.Storage(withQueryTimeouts(store, cfg.QueryTimeouts)))
+
+	// Background Workers are stopped after requests are drained
+	workersCtx, stopWorkers := context.WithCancel(context.Background())
+	var workers sync.WaitGroup
+	defer func() {
+		stopWorkers()
+		workers.Wait()
+	}()
+
+	// Segment Sizes Are Counted In Background, not on every scrape
+	sizes, err := m.RegisterSegmentSizes(log, store, cfg.Metrics.SegmentSizesInterval)
+	if err != nil {
+		log.Error("failed to init metrics", logger.Err(err))
+		return err
+	}
+	workers.Add(1)
+	go func() {
+		defer workers.Done()
+		sizes.Run(workersCtx)
+	}()
+
+	// Expired Segments Reaper Initializing
+	rp, err := reaper.New(log, store, cfg.Reaper.Interval)
+	if err != nil {
+		log.Error("failed to init reaper", logger.Err(err))
 		return err
 	}
-	log.Info("storage is initialized")
+	readiness.Add("reaper", rp.Check)
+	workers.Add(1)
+	go func() {
+		defer workers.Done()
+		rp.Run(workersCtx)
+	}()
+
+	// API Credentials Initializing, re-read with other secrets on SIGHUP
+	chain, err := auth.New(cfg.HTTPServer)
+	if err != nil {
+		log.Error("failed to init api credentials", logger.Err(err))
+		return err
+	}
+	authenticator := auth.NewReloadable(chain)
+	store = auth.Storage(store)
+
+	workers.Add(1)
+	go func() {
+		defer workers.Done()
+		reloadOnHangup(workersCtx, log, authenticator, rawStore)
+	}()
+
+	// TLS Initializing, certificates are re-read when files change
+	var certs *tlsreload.Reloader
+	if cfg.HTTPServer.TLS.Enabled() {
+		certs, err = tlsreload.New(log, cfg.HTTPServer.TLS)
+		if err != nil {
+			log.Error("failed to init tls", logger.Err(err))
+			return err
+		}
+
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			certs.Run(workersCtx)
+		}()
+	}
 
 	// Router Initiziling
-	router := chi.NewRouter()
-
-	router.Use(middleware.RequestID)
-	router.Use(mwlog.New(log))
-	router.Use(middleware.Recoverer)
-	router.Use(middleware.URLFormat)
-
-	router.Route("/", func(r chi.Router) {
-		r.Use(middleware.BasicAuth("avito-tech-service", map[string]string{
-			cfg.HTTPServer.User: cfg.HTTPServer.Password,
-		}))
-
-		r.Post("/segments", createsegment.NewSegment(log, store))             // Add Segment
-		r.Post("/users", adduser.AddUser(log, store))                         // Add User
-		r.Post("/users/id={id}", addtouser.AddToUser(log, store))             // Add Segment To User
-		r.Delete("/segments", deletesegment.DelSegment(log, store))           // Delete Segment
-		r.Delete("/users", deleteuser.DeleteUser(log, store))                 // Delete User
-		r.Delete("/users/id={id}", deletefromuser.DeleteFromUser(log, store)) // Delete Segment From User
-		r.Get("/users/id={id}", getuser.GetFromUser(log, store))              // Get From User
-	})
+	router := NewRouter(log, cfg, store, readiness, m, authenticator)
 
-	// Start HTTP Server
-	log.Info("starting server", slog.String("address", cfg.Address))
+	serveErr := make(chan error, 2)
 
+	// Start gRPC Server
+	lis, err := net.Listen("tcp", cfg.GRPCServer.Address)
+	if err != nil {
+		log.Error("failed to listen grpc address", logger.Err(err))
+		return err
+	}
+	var grpcTLS *tls.Config
+	if certs != nil {
+		grpcTLS = certs.Config()
+	}
+	gRPC := grpcserver.New(log, store, authenticator, grpcTLS)
+	go func() {
+		log.Info("starting grpc server",
+			slog.String("address", cfg.GRPCServer.Address),
+			slog.Bool("tls", grpcTLS != nil),
+		)
+		if err := gRPC.Serve(lis); err != nil {
+			serveErr <- err
+		}
+	}()
+
+	// Start HTTP Server
 	srv := &http.Server{
 		Addr:         cfg.Address,
 		Handler:      router,
 		ReadTimeout:  cfg.HTTPServer.Timeout,
 		WriteTimeout: cfg.HTTPServer.Timeout,
 		IdleTimeout:  cfg.HTTPServer.IdleTimeout,
+		// Rejected TLS handshakes are reported here
+		ErrorLog: slog.NewLogLogger(log.Handler(), slog.LevelWarn),
+	}
+	if certs != nil {
+		srv.TLSConfig = certs.Config()
 	}
+	go func() {
+		log.Info("starting server",
+			slog.String("address", cfg.Address),
+			slog.Bool("tls", srv.TLSConfig != nil),
+		)
 
-	if err := srv.ListenAndServe(); err != nil {
-		log.Error("failed to start server")
+		var err error
+		if srv.TLSConfig != nil {
+			// Certificate comes from TLSConfig, so files are not passed here
+			err = srv.ListenAndServeTLS("", "")
+		} else {
+			err = srv.ListenAndServe()
+		}
+		if !errors.Is(err, http.ErrServerClosed) {
+			serveErr <- err
+		}
+	}()
+
+	select {
+	case <-ctx.Done():
+		log.Info("shutdown signal received")
+	case err := <-serveErr:
+		log.Error("server stopped", logger.Err(err))
+		gRPC.Stop()
+		srv.Close()
 		return err
 	}
+	stop()
+
+	shutdown(log, cfg.HTTPServer, readiness, srv, gRPC)
+
+	log.Info("service stopped")
+
+	return nil
+}
+
+// Flip readiness, wait for load balancers to notice it and drain in-flight requests.
+// Requests left after shutdown timeout are cut off
+func shutdown(log *slog.Logger, cfg config.HTTPServer, readiness *health.Readiness,
+	srv *http.Server, gRPC *grpc.Server) {
+	readiness.Drain()
+
+	log.Info("waiting for load balancers to stop routing", slog.String("delay", cfg.ShutdownDelay.String()))
+	time.Sleep(cfg.ShutdownDelay)
+
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+	defer cancel()
+
+	log.Info("draining requests", slog.String("timeout", cfg.ShutdownTimeout.String()))
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+
+	go func() {
+		defer wg.Done()
+		if err := srv.Shutdown(ctx); err != nil {
+			log.Error("http requests are not drained", logger.Err(err))
+			srv.Close()
+		}
+	}()
+
+	go func() {
+		defer wg.Done()
+		stopped := make(chan struct{})
+		go func() {
+			gRPC.GracefulStop()
+			close(stopped)
+		}()
 
-	log.Error("server stopped")
+		select {
+		case <-stopped:
+		case <-ctx.Done():
+			log.Error("grpc requests are not drained", logger.Err(ctx.Err()))
+			gRPC.Stop()
+		}
+	}()
 
-	return fmt.Errorf("server is stopped")
+	wg.Wait()
 }
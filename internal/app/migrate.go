@@ -0,0 +1,28 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/m1al04949/avito-tech-service/internal/config"
+)
+
+// RunMigrate manages database schema of storage from config, args follow "migrate"
+func RunMigrate(args []string) error {
+
+	// Config Initializing
+	cfg := config.MustLoad()
+
+	_, migrator, closeStore, err := openStorage(cfg)
+	if err != nil {
+		return err
+	}
+	defer closeStore()
+
+	if migrator == nil {
+		return fmt.Errorf("%s storage has no schema to migrate", cfg.StorageType)
+	}
+
+	return migrator.Run(context.Background(), args, os.Stdout)
+}
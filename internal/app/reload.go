@@ -0,0 +1,62 @@
+package app
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/m1al04949/avito-tech-service/internal/auth"
+	"github.com/m1al04949/avito-tech-service/internal/config"
+	"github.com/m1al04949/avito-tech-service/internal/logger"
+	"golang.org/x/exp/slog"
+)
+
+type databaseURLSetter interface {
+	SetDatabaseURL(dburl string) error
+}
+
+// Re-read config and secret files on SIGHUP until ctx is done, so rotated secrets
+// apply without restart. Only API credentials and database URL are changed,
+// other options need restart
+func reloadOnHangup(ctx context.Context, log *slog.Logger, authenticator *auth.Reloadable, store any) {
+	log = log.With(slog.String("component", "app/reload"))
+
+	hangup := make(chan os.Signal, 1)
+	signal.Notify(hangup, syscall.SIGHUP)
+	defer signal.Stop(hangup)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hangup:
+			if err := reloadSecrets(authenticator, store); err != nil {
+				log.Error("failed to reload secrets, previous ones are kept", logger.Err(err))
+				continue
+			}
+			log.Info("secrets are reloaded")
+		}
+	}
+}
+
+func reloadSecrets(authenticator *auth.Reloadable, store any) error {
+	cfg, err := config.Load()
+	if err != nil {
+		return err
+	}
+
+	chain, err := auth.New(cfg.HTTPServer)
+	if err != nil {
+		return err
+	}
+
+	if setter, ok := store.(databaseURLSetter); ok && cfg.StorageType == config.StoragePostgres {
+		if err := setter.SetDatabaseURL(cfg.DatabaseURL.Value()); err != nil {
+			return err
+		}
+	}
+	authenticator.Store(chain)
+
+	return nil
+}
@@ -0,0 +1,128 @@
+package app
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/m1al04949/avito-tech-service/internal/auth"
+	"github.com/m1al04949/avito-tech-service/internal/config"
+	"github.com/m1al04949/avito-tech-service/internal/health"
+	"github.com/m1al04949/avito-tech-service/internal/http-server/handlers/addtouser"
+	"github.com/m1al04949/avito-tech-service/internal/http-server/handlers/adduser"
+	"github.com/m1al04949/avito-tech-service/internal/http-server/handlers/createsegment"
+	"github.com/m1al04949/avito-tech-service/internal/http-server/handlers/deletefromuser"
+	"github.com/m1al04949/avito-tech-service/internal/http-server/handlers/deletesegment"
+	"github.com/m1al04949/avito-tech-service/internal/http-server/handlers/deleteuser"
+	"github.com/m1al04949/avito-tech-service/internal/http-server/handlers/docs"
+	"github.com/m1al04949/avito-tech-service/internal/http-server/handlers/gethistory"
+	"github.com/m1al04949/avito-tech-service/internal/http-server/handlers/getsegment"
+	"github.com/m1al04949/avito-tech-service/internal/http-server/handlers/getsegmentusers"
+	"github.com/m1al04949/avito-tech-service/internal/http-server/handlers/getuser"
+	"github.com/m1al04949/avito-tech-service/internal/http-server/handlers/healthcheck"
+	"github.com/m1al04949/avito-tech-service/internal/http-server/handlers/listsegments"
+	"github.com/m1al04949/avito-tech-service/internal/http-server/handlers/updateuser"
+	"github.com/m1al04949/avito-tech-service/internal/http-server/middleware/mwauth"
+	"github.com/m1al04949/avito-tech-service/internal/http-server/middleware/mwdeprecation"
+	"github.com/m1al04949/avito-tech-service/internal/http-server/middleware/mwdrain"
+	"github.com/m1al04949/avito-tech-service/internal/http-server/middleware/mwlog"
+	"github.com/m1al04949/avito-tech-service/internal/http-server/middleware/mwmetrics"
+	"github.com/m1al04949/avito-tech-service/internal/http-server/middleware/mwtrace"
+	"github.com/m1al04949/avito-tech-service/internal/lib/response"
+	"github.com/m1al04949/avito-tech-service/internal/metrics"
+	"github.com/m1al04949/avito-tech-service/internal/storage"
+	"golang.org/x/exp/slog"
+)
+
+const apiV1 = "/api/v1"
+
+func NewRouter(log *slog.Logger, cfg *config.Config, store storage.Repository, readiness *health.Readiness,
+	m *metrics.Metrics, authenticator auth.Authenticator) http.Handler {
+
+	router := chi.NewRouter()
+
+	router.Use(middleware.RequestID)
+	router.Use(mwtrace.New())
+	router.Use(mwlog.New(log))
+	router.Use(mwmetrics.New(m))
+	router.Use(middleware.Recoverer)
+	router.Use(response.LegacyErrors(cfg.HTTPServer.LegacyErrors))
+	router.Use(mwdrain.New(readiness))
+	router.Use(legacyURLFormat)
+
+	// Probes of orchestrator, no authorization
+	router.Get("/healthz", healthcheck.Liveness())               // Process Is Alive
+	router.Get("/readyz", healthcheck.Readiness(log, readiness)) // Service Accepts Traffic
+
+	// API Documentation
+	router.Get("/openapi.json", docs.OpenAPI()) // OpenAPI Specification
+	router.Get("/docs", docs.SwaggerUI())       // Swagger UI
+	swaggerUIAssets := docs.SwaggerUIAssets()
+	router.Get("/docs/swagger-ui.css", swaggerUIAssets.ServeHTTP)       // Swagger UI Styles
+	router.Get("/docs/swagger-ui-bundle.js", swaggerUIAssets.ServeHTTP) // Swagger UI Script
+
+	router.Group(func(r chi.Router) {
+		r.Use(mwauth.New(log, "avito-tech-service", authenticator))
+
+		// Readers may only call GET endpoints, segments are created and deleted by admins
+		writer := mwauth.Require(auth.RoleWriter)
+		admin := mwauth.Require(auth.RoleAdmin)
+
+		// Metrics are labeled by every segment, so they are for unrestricted admins only
+		r.With(admin, mwauth.RequireUnrestricted()).Get("/metrics", m.Handler().ServeHTTP) // Prometheus Metrics
+
+		// API v1
+		r.Route(apiV1, func(r chi.Router) {
+			r.Get("/users/{id}", getuser.GetFromUser(log, store))                                    // Get User
+			r.With(writer).Put("/users/{id}", adduser.AddUser(log, store))                           // Add User
+			r.With(writer).Delete("/users/{id}", deleteuser.DeleteUser(log, store))                  // Delete User
+			r.Get("/users/{id}/segments", getuser.GetFromUser(log, store))                           // Get Segments Of User
+			r.With(writer).Post("/users/{id}/segments", addtouser.AddToUser(log, store))             // Add Segments To User
+			r.With(writer).Patch("/users/{id}/segments", updateuser.UpdateUser(log, store))          // Add And Delete Segments For User
+			r.With(writer).Delete("/users/{id}/segments", deletefromuser.DeleteFromUser(log, store)) // Delete Segments From User
+			r.Get("/segments", listsegments.ListSegments(log, store))                                // List Segments
+			r.With(admin).Post("/segments", createsegment.NewSegment(log, store))                    // Add Segment
+			r.Get("/segments/{slug}", getsegment.GetSegment(log, store))                             // Get Segment
+			r.With(admin).Delete("/segments/{slug}", deletesegment.DelSegment(log, store))           // Delete Segment
+			r.Get("/segments/{slug}/users", getsegmentusers.GetSegmentUsers(log, store))             // Get Users Of Segment
+			r.Get("/reports/history", gethistory.GetHistory(log, store))                             // Get Segments History Report
+		})
+
+		// Legacy API, kept until consumers migrate to v1
+		r.Group(func(r chi.Router) {
+			r.Use(mwdeprecation.New(apiV1))
+
+			r.With(admin).Post("/segments", createsegment.NewSegment(log, store))              // Add Segment
+			r.With(writer).Post("/users", adduser.AddUser(log, store))                         // Add User
+			r.With(writer).Post("/users/id={id}", addtouser.AddToUser(log, store))             // Add Segment To User
+			r.With(admin).Delete("/segments", deletesegment.DelSegment(log, store))            // Delete Segment
+			r.With(writer).Delete("/users", deleteuser.DeleteUser(log, store))                 // Delete User
+			r.With(writer).Delete("/users/id={id}", deletefromuser.DeleteFromUser(log, store)) // Delete Segment From User
+			r.With(writer).Patch("/users/id={id}", updateuser.UpdateUser(log, store))          // Add And Delete Segments For User
+			r.Get("/users/id={id}", getuser.GetFromUser(log, store))                           // Get From User
+			r.Get("/reports/history", gethistory.GetHistory(log, store))                       // Get Segments History Report
+		})
+	})
+
+	return router
+}
+
+// Paths of legacy API, which accepted extensions such as /users/id=5.json
+var legacyPrefixes = []string{"/users", "/segments", "/reports/"}
+
+// legacyURLFormat strips extension from paths of legacy API before routing.
+// Other paths keep it, as /openapi.json and Swagger UI assets are served by file name
+func legacyURLFormat(next http.Handler) http.Handler {
+	format := middleware.URLFormat(next)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for _, prefix := range legacyPrefixes {
+			if strings.HasPrefix(r.URL.Path, prefix) {
+				format.ServeHTTP(w, r)
+				return
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,313 @@
+package app_test
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/m1al04949/avito-tech-service/internal/app"
+	"github.com/m1al04949/avito-tech-service/internal/auth"
+	"github.com/m1al04949/avito-tech-service/internal/config"
+	"github.com/m1al04949/avito-tech-service/internal/health"
+	"github.com/m1al04949/avito-tech-service/internal/http-server/handlers/docs"
+	"github.com/m1al04949/avito-tech-service/internal/metrics"
+	"github.com/m1al04949/avito-tech-service/internal/storage/memory"
+	"github.com/m1al04949/avito-tech-service/pkg/slogdiscard"
+	"github.com/stretchr/testify/require"
+)
+
+func newRouter(t *testing.T) http.Handler {
+	t.Helper()
+
+	cfg := &config.Config{}
+	cfg.HTTPServer.User = "myuser"
+	cfg.HTTPServer.Password = "mypass"
+
+	authenticator, err := auth.New(cfg.HTTPServer)
+	require.NoError(t, err)
+
+	return app.NewRouter(slogdiscard.NewDiscardLogger(), cfg, memory.New(), &health.Readiness{}, metrics.New(), authenticator)
+}
+
+func TestRoutesAreDocumented(t *testing.T) {
+	var spec struct {
+		Paths map[string]map[string]json.RawMessage `json:"paths"`
+	}
+	require.NoError(t, json.Unmarshal(docs.Spec(), &spec))
+
+	routes, ok := newRouter(t).(chi.Routes)
+	require.True(t, ok)
+
+	registered := make(map[string]bool)
+	err := chi.Walk(routes, func(method, route string, _ http.Handler, _ ...func(http.Handler) http.Handler) error {
+		method = strings.ToLower(method)
+		registered[method+" "+route] = true
+
+		_, ok := spec.Paths[route][method]
+		require.Truef(t, ok, "route %s %s is missing from openapi.json", method, route)
+
+		return nil
+	})
+	require.NoError(t, err)
+
+	for path, item := range spec.Paths {
+		for method := range item {
+			if method == "parameters" {
+				continue
+			}
+			require.Truef(t, registered[method+" "+path], "openapi.json describes unregistered route %s %s", method, path)
+		}
+	}
+}
+
+func TestOpenAPIIsServed(t *testing.T) {
+	router := newRouter(t)
+
+	req := httptest.NewRequest(http.MethodGet, "/openapi.json", nil)
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+
+	require.Equal(t, http.StatusOK, rr.Code)
+	require.Equal(t, "application/json", rr.Header().Get("Content-Type"))
+	require.JSONEq(t, string(docs.Spec()), rr.Body.String())
+
+	req = httptest.NewRequest(http.MethodGet, "/docs", nil)
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+
+	require.Equal(t, http.StatusOK, rr.Code)
+	require.Contains(t, rr.Body.String(), "/openapi.json")
+	// Page works without access to CDN
+	require.NotContains(t, rr.Body.String(), "https://")
+
+	for path, contentType := range map[string]string{
+		"/docs/swagger-ui.css":       "text/css",
+		"/docs/swagger-ui-bundle.js": "text/javascript",
+	} {
+		req = httptest.NewRequest(http.MethodGet, path, nil)
+		rr = httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+
+		require.Equal(t, http.StatusOK, rr.Code, path)
+		require.Contains(t, rr.Header().Get("Content-Type"), contentType, path)
+		require.NotEmpty(t, rr.Body.Bytes(), path)
+	}
+}
+
+func TestLegacyURLFormat(t *testing.T) {
+	router := newRouter(t)
+
+	call := func(method, path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.SetBasicAuth("myuser", "mypass")
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		return rr
+	}
+
+	require.Equal(t, http.StatusOK, call(http.MethodPost, "/users.json", `{"user_id":5}`).Code)
+	require.Equal(t, http.StatusOK, call(http.MethodPost, "/segments.json", `{"slug":"AVITO_VOICE"}`).Code)
+	require.Equal(t, http.StatusOK, call(http.MethodPost, "/users/id=5.json", `{"segments":[{"slug":"AVITO_VOICE"}]}`).Code)
+
+	// Extension is stripped as before v1 API was added
+	for _, path := range []string{"/users/id=5", "/users/id=5.json"} {
+		rr := call(http.MethodGet, path, "")
+		require.Equal(t, http.StatusOK, rr.Code, path)
+		require.Contains(t, rr.Body.String(), "AVITO_VOICE", path)
+	}
+}
+
+func TestProbes(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.HTTPServer.User = "myuser"
+	cfg.HTTPServer.Password = "mypass"
+
+	var storageErr error
+	readiness := &health.Readiness{}
+	readiness.Add("storage", func(ctx context.Context) error { return storageErr })
+
+	authenticator, err := auth.New(cfg.HTTPServer)
+	require.NoError(t, err)
+
+	router := app.NewRouter(slogdiscard.NewDiscardLogger(), cfg, memory.New(), readiness, metrics.New(), authenticator)
+
+	probe := func(path string) (int, health.Report) {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+
+		var report health.Report
+		require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &report))
+
+		return rr.Code, report
+	}
+
+	code, report := probe("/healthz")
+	require.Equal(t, http.StatusOK, code)
+	require.Equal(t, health.StatusOK, report.Status)
+
+	code, report = probe("/readyz")
+	require.Equal(t, http.StatusOK, code)
+	require.Equal(t, health.StatusOK, report.Status)
+	require.Len(t, report.Checks, 2)
+
+	storageErr = errors.New("connection refused")
+	code, report = probe("/readyz")
+	require.Equal(t, http.StatusServiceUnavailable, code)
+	require.Equal(t, health.StatusFail, report.Status)
+	require.Equal(t, health.CheckResult{Name: "storage", Status: health.StatusFail, Error: "connection refused"},
+		health.CheckResult{Name: report.Checks[1].Name, Status: report.Checks[1].Status, Error: report.Checks[1].Error})
+
+	storageErr = nil
+	readiness.Drain()
+	code, report = probe("/readyz")
+	require.Equal(t, http.StatusServiceUnavailable, code)
+	require.Equal(t, "shutdown", report.Checks[0].Name)
+	require.Equal(t, health.StatusFail, report.Checks[0].Status)
+
+	// Liveness does not depend on readiness
+	code, _ = probe("/healthz")
+	require.Equal(t, http.StatusOK, code)
+}
+
+func TestRoles(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.HTTPServer.User = "admin"
+	cfg.HTTPServer.Password = "admin-pass"
+	cfg.HTTPServer.Credentials = []config.Credential{
+		{User: "reader", Password: "reader-pass", Role: config.RoleReader},
+		{User: "writer", Password: "writer-pass", Role: config.RoleWriter},
+		{User: "avito", Password: "avito-pass", Role: config.RoleWriter, Segments: []string{"AVITO_"}},
+		{User: "avito-admin", Password: "avito-admin-pass", Role: config.RoleAdmin, Segments: []string{"AVITO_"}},
+	}
+	authenticator, err := auth.New(cfg.HTTPServer)
+	require.NoError(t, err)
+
+	router := app.NewRouter(slogdiscard.NewDiscardLogger(), cfg, auth.Storage(memory.New()), &health.Readiness{},
+		metrics.New(), authenticator)
+
+	call := func(user, method, path, body string) int {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.SetBasicAuth(user, user+"-pass")
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		return rr.Code
+	}
+
+	require.Equal(t, http.StatusUnauthorized, call("nobody", http.MethodGet, "/api/v1/segments", ""))
+
+	// Segments are created and deleted by admins only
+	require.Equal(t, http.StatusForbidden, call("writer", http.MethodPost, "/api/v1/segments", `{"slug":"OZON_VOICE"}`))
+	require.Equal(t, http.StatusForbidden, call("writer", http.MethodPost, "/segments", `{"slug":"OZON_VOICE"}`))
+	require.Equal(t, http.StatusOK, call("admin", http.MethodPost, "/api/v1/segments", `{"slug":"OZON_VOICE"}`))
+	require.Equal(t, http.StatusOK, call("admin", http.MethodPost, "/api/v1/segments", `{"slug":"AVITO_VOICE"}`))
+
+	// Readers only call GET endpoints
+	require.Equal(t, http.StatusForbidden, call("reader", http.MethodPut, "/api/v1/users/1000", ""))
+	require.Equal(t, http.StatusForbidden, call("reader", http.MethodPost, "/users", `{"user_id":1000}`))
+	require.Equal(t, http.StatusOK, call("writer", http.MethodPut, "/api/v1/users/1000", ""))
+	require.Equal(t, http.StatusOK, call("reader", http.MethodGet, "/api/v1/users/1000", ""))
+
+	// Metrics reveal every segment
+	require.Equal(t, http.StatusForbidden, call("reader", http.MethodGet, "/metrics", ""))
+	require.Equal(t, http.StatusForbidden, call("avito-admin", http.MethodGet, "/metrics", ""))
+	require.Equal(t, http.StatusOK, call("admin", http.MethodGet, "/metrics", ""))
+
+	// Writers limited by prefixes only use their segments
+	require.Equal(t, http.StatusForbidden, call("avito", http.MethodPost, "/api/v1/users/1000/segments",
+		`{"segments":[{"slug":"OZON_VOICE"}]}`))
+	require.Equal(t, http.StatusOK, call("avito", http.MethodPost, "/api/v1/users/1000/segments",
+		`{"segments":[{"slug":"AVITO_VOICE"}]}`))
+	require.Equal(t, http.StatusForbidden, call("avito", http.MethodGet, "/api/v1/segments/OZON_VOICE", ""))
+	require.Equal(t, http.StatusOK, call("avito", http.MethodGet, "/api/v1/segments/AVITO_VOICE", ""))
+	require.Equal(t, http.StatusForbidden, call("avito", http.MethodDelete, "/api/v1/users/1000", ""))
+}
+
+func TestAuthenticators(t *testing.T) {
+	hash := sha256.Sum256([]byte("analytics-key"))
+
+	cfg := &config.Config{}
+	cfg.HTTPServer.APIKeys = []config.APIKey{
+		{Name: "analytics", Hash: hex.EncodeToString(hash[:]), Role: config.RoleReader},
+	}
+	cfg.HTTPServer.JWT = config.JWT{Secrets: []config.Secret{"secret"}, IdentityClaim: "sub", RoleClaim: "role"}
+	authenticator, err := auth.New(cfg.HTTPServer)
+	require.NoError(t, err)
+
+	router := app.NewRouter(slogdiscard.NewDiscardLogger(), cfg, memory.New(), &health.Readiness{}, metrics.New(),
+		authenticator)
+
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"sub":  "segments-admin",
+		"role": "admin",
+		"exp":  time.Now().Add(time.Hour).Unix(),
+	}).SignedString([]byte("secret"))
+	require.NoError(t, err)
+
+	call := func(header, value, method, path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set(header, value)
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		return rr
+	}
+
+	rr := call("Authorization", "Bearer "+token, http.MethodPost, "/api/v1/segments", `{"slug":"AVITO_VOICE"}`)
+	require.Equal(t, http.StatusOK, rr.Code)
+
+	rr = call(auth.HeaderAPIKey, "analytics-key", http.MethodGet, "/api/v1/segments/AVITO_VOICE", "")
+	require.Equal(t, http.StatusOK, rr.Code)
+	rr = call(auth.HeaderAPIKey, "analytics-key", http.MethodDelete, "/api/v1/segments/AVITO_VOICE", "")
+	require.Equal(t, http.StatusForbidden, rr.Code)
+
+	rr = call(auth.HeaderAPIKey, "wrong-key", http.MethodGet, "/api/v1/segments", "")
+	require.Equal(t, http.StatusUnauthorized, rr.Code)
+	require.Equal(t, []string{`Bearer realm="avito-tech-service"`}, rr.Header().Values("WWW-Authenticate"))
+}
+
+func TestClientCertificates(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.HTTPServer.TLS.ClientCAFile = "ca.crt"
+	cfg.HTTPServer.ClientCerts = []config.ClientCert{
+		{CN: "billing", Role: config.RoleWriter, Segments: []string{"BILLING_"}},
+	}
+	authenticator, err := auth.New(cfg.HTTPServer)
+	require.NoError(t, err)
+
+	store := memory.New()
+	require.NoError(t, store.SaveSegm(context.Background(), "BILLING_TRIAL", 0))
+	require.NoError(t, store.SaveSegm(context.Background(), "AVITO_VOICE", 0))
+
+	router := app.NewRouter(slogdiscard.NewDiscardLogger(), cfg, auth.Storage(store), &health.Readiness{}, metrics.New(),
+		authenticator)
+
+	// Handshake has verified the chain, router only sees the leaf certificate
+	call := func(cn, path string) int {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		if cn != "" {
+			req.TLS = &tls.ConnectionState{
+				PeerCertificates: []*x509.Certificate{{Subject: pkix.Name{CommonName: cn}}},
+			}
+		}
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		return rr.Code
+	}
+
+	require.Equal(t, http.StatusOK, call("billing", "/api/v1/segments/BILLING_TRIAL"))
+	require.Equal(t, http.StatusForbidden, call("billing", "/api/v1/segments/AVITO_VOICE"))
+	require.Equal(t, http.StatusUnauthorized, call("web", "/api/v1/segments/BILLING_TRIAL"))
+	require.Equal(t, http.StatusUnauthorized, call("", "/api/v1/segments/BILLING_TRIAL"))
+}
@@ -0,0 +1,130 @@
+package app
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/m1al04949/avito-tech-service/internal/config"
+	"github.com/m1al04949/avito-tech-service/internal/health"
+	"github.com/m1al04949/avito-tech-service/internal/metrics"
+	"github.com/m1al04949/avito-tech-service/internal/storage"
+	"github.com/m1al04949/avito-tech-service/internal/storage/memory"
+	"github.com/m1al04949/avito-tech-service/internal/storage/migrate"
+	"github.com/m1al04949/avito-tech-service/internal/storage/sqlite"
+	"golang.org/x/exp/slog"
+)
+
+var errSchemaOutdated = errors.New("database schema is outdated, run migrate up")
+
+// Open storage selected in config, returned func closes it.
+// Migrator is nil for storage without schema
+func openStorage(cfg *config.Config) (storage.Repository, *migrate.Migrator, func(), error) {
+	switch cfg.StorageType {
+	case config.StoragePostgres:
+		if cfg.DatabaseURL == "" {
+			return nil, nil, nil, errors.New("database_url is required for postgres storage")
+		}
+
+		store := storage.New(cfg.StoragePath, cfg.DatabaseURL.Value())
+		if err := store.Open(); err != nil {
+			return nil, nil, nil, err
+		}
+		migrator, err := store.Migrator()
+		if err != nil {
+			store.Close()
+			return nil, nil, nil, err
+		}
+
+		return store, migrator, store.Close, nil
+	case config.StorageSQLite:
+		if cfg.StoragePath == "" {
+			return nil, nil, nil, errors.New("storage_path is required for sqlite storage")
+		}
+
+		store := sqlite.New(cfg.StoragePath)
+		if err := store.Open(); err != nil {
+			return nil, nil, nil, err
+		}
+		migrator, err := store.Migrator()
+		if err != nil {
+			store.Close()
+			return nil, nil, nil, err
+		}
+
+		return store, migrator, store.Close, nil
+	case config.StorageMemory:
+		return memory.New(), nil, func() {}, nil
+	default:
+		return nil, nil, nil, fmt.Errorf("unknown storage type %q", cfg.StorageType)
+	}
+}
+
+// Register readiness checks of storage: connection and schema version
+func addStorageChecks(readiness *health.Readiness, store storage.Repository, migrator *migrate.Migrator) {
+	if pinger, ok := store.(interface {
+		Ping(ctx context.Context) error
+	}); ok {
+		readiness.Add("storage", pinger.Ping)
+	}
+
+	if migrator != nil {
+		readiness.Add("migrations", func(ctx context.Context) error {
+			version, err := migrator.Version(ctx)
+			if err != nil {
+				return err
+			}
+			if version != migrator.Latest() {
+				return fmt.Errorf("schema version %d, expected %d", version, migrator.Latest())
+			}
+			return nil
+		})
+	}
+}
+
+// Expose pool stats of storage backed by database/sql
+func addStorageMetrics(m *metrics.Metrics, store storage.Repository, storageType string) {
+	if pool, ok := store.(interface{ DB() *sql.DB }); ok {
+		m.RegisterDB(pool.DB(), storageType)
+	}
+}
+
+// Limit every storage operation with timeout from config
+func withQueryTimeouts(store storage.Repository, cfg config.QueryTimeouts) storage.Repository {
+	return storage.WithTimeouts(store, storage.Timeouts{
+		Read:   cfg.Read,
+		Write:  cfg.Write,
+		Export: cfg.Export,
+		Expire: cfg.Expire,
+	})
+}
+
+// Bring schema to the version of the binary or check it is already there.
+// Schema of a newer binary is never touched
+func prepareSchema(ctx context.Context, log *slog.Logger, migrator *migrate.Migrator, migrateOnStart bool) error {
+	if migrator == nil {
+		return nil
+	}
+
+	if migrateOnStart {
+		applied, err := migrator.Up(ctx)
+		for _, v := range applied {
+			log.Info("migration applied", slog.Int("version", v))
+		}
+		return err
+	}
+
+	if err := migrator.Check(ctx); err != nil {
+		return err
+	}
+	version, err := migrator.Version(ctx)
+	if err != nil {
+		return err
+	}
+	if version < migrator.Latest() {
+		return fmt.Errorf("%w: version %d, latest %d", errSchemaOutdated, version, migrator.Latest())
+	}
+
+	return nil
+}
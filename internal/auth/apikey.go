@@ -0,0 +1,63 @@
+package auth
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+
+	"github.com/m1al04949/avito-tech-service/internal/config"
+)
+
+// HeaderAPIKey carries API key of the client
+const HeaderAPIKey = "X-API-Key"
+
+// APIKeys checks X-API-Key header against SHA-256 hashes of configured keys.
+// Keys are random secrets, so a fast hash is enough to keep them out of config
+type APIKeys struct {
+	keys map[[sha256.Size]byte]*Principal
+}
+
+func NewAPIKeys(keys []config.APIKey) (*APIKeys, error) {
+	const op = "auth.NewAPIKeys"
+
+	a := &APIKeys{keys: make(map[[sha256.Size]byte]*Principal, len(keys))}
+	for _, k := range keys {
+		if k.Name == "" {
+			return nil, fmt.Errorf("%s: name of key is required", op)
+		}
+
+		var hash [sha256.Size]byte
+		if len(k.Hash) != hex.EncodedLen(sha256.Size) {
+			return nil, fmt.Errorf("%s: key %q: hash must be hex SHA-256", op, k.Name)
+		}
+		if _, err := hex.Decode(hash[:], []byte(k.Hash)); err != nil {
+			return nil, fmt.Errorf("%s: key %q: hash must be hex SHA-256", op, k.Name)
+		}
+		if _, ok := a.keys[hash]; ok {
+			return nil, fmt.Errorf("%s: key %q: duplicate hash", op, k.Name)
+		}
+
+		principal, err := newPrincipal(MethodAPIKey, k.Name, k.Role, k.Segments)
+		if err != nil {
+			return nil, fmt.Errorf("%s: key %q: %w", op, k.Name, err)
+		}
+		a.keys[hash] = principal
+	}
+
+	return a, nil
+}
+
+func (a *APIKeys) Authenticate(_ context.Context, h Headers) (*Principal, error) {
+	key := h.Get(HeaderAPIKey)
+	if key == "" {
+		return nil, ErrNoCredentials
+	}
+
+	principal, ok := a.keys[sha256.Sum256([]byte(key))]
+	if !ok {
+		return nil, ErrInvalidCredentials
+	}
+
+	return principal, nil
+}
@@ -0,0 +1,250 @@
+// Package auth authenticates API consumers and decides what they may do.
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync/atomic"
+
+	"github.com/m1al04949/avito-tech-service/internal/config"
+	"golang.org/x/exp/slog"
+)
+
+var (
+	ErrNoCredentials      = errors.New("no credentials")
+	ErrInvalidCredentials = errors.New("invalid credentials")
+	ErrForbidden          = errors.New("access denied")
+)
+
+// Methods of authentication
+const (
+	MethodBasic  = "basic"
+	MethodAPIKey = "api_key"
+	MethodJWT    = "jwt"
+	MethodCert   = "client_cert"
+)
+
+// Role grants access to its own operations and to those of lower roles
+type Role int
+
+const (
+	RoleReader Role = iota + 1
+	RoleWriter
+	RoleAdmin
+)
+
+func ParseRole(role string) (Role, error) {
+	switch role {
+	case config.RoleReader:
+		return RoleReader, nil
+	case config.RoleWriter:
+		return RoleWriter, nil
+	case config.RoleAdmin:
+		return RoleAdmin, nil
+	}
+
+	return 0, fmt.Errorf("unknown role %q", role)
+}
+
+func (r Role) String() string {
+	switch r {
+	case RoleReader:
+		return config.RoleReader
+	case RoleWriter:
+		return config.RoleWriter
+	case RoleAdmin:
+		return config.RoleAdmin
+	}
+
+	return "unknown"
+}
+
+// Principal is authenticated API consumer
+type Principal struct {
+	// Identity of the client: user, name of API key or claim of token
+	User string
+	// How the client was authenticated
+	Method string
+	Role   Role
+	// Allowed prefixes of segment slugs, empty allows every segment
+	Segments []string
+}
+
+// Allows reports whether principal has at least role
+func (p *Principal) Allows(role Role) bool {
+	return p.Role >= role
+}
+
+// AllowsSegment reports whether principal may use segment
+func (p *Principal) AllowsSegment(slug string) bool {
+	if p.Unrestricted() {
+		return true
+	}
+	for _, prefix := range p.Segments {
+		if strings.HasPrefix(slug, prefix) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Unrestricted reports whether principal may use every segment
+func (p *Principal) Unrestricted() bool {
+	return len(p.Segments) == 0
+}
+
+func newPrincipal(method, user, role string, segments []string) (*Principal, error) {
+	r, err := ParseRole(role)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Principal{
+		User:     user,
+		Method:   method,
+		Role:     r,
+		Segments: segments,
+	}, nil
+}
+
+type ctxKeyPrincipal struct{}
+
+func WithPrincipal(ctx context.Context, p *Principal) context.Context {
+	return context.WithValue(ctx, ctxKeyPrincipal{}, p)
+}
+
+// FromContext returns principal of the request, nil for calls made by the service itself
+func FromContext(ctx context.Context) *Principal {
+	p, _ := ctx.Value(ctxKeyPrincipal{}).(*Principal)
+
+	return p
+}
+
+// Attr is principal of ctx for request loggers, empty for calls made by the service itself
+func Attr(ctx context.Context) slog.Attr {
+	p := FromContext(ctx)
+	if p == nil {
+		return slog.Attr{}
+	}
+
+	return slog.Group("principal",
+		slog.String("user", p.User),
+		slog.String("method", p.Method),
+		slog.String("role", p.Role.String()),
+	)
+}
+
+// Headers of HTTP request or metadata of gRPC call
+type Headers interface {
+	Get(key string) string
+}
+
+// Authenticator identifies the caller by credentials of its kind.
+// It returns ErrNoCredentials when headers carry none of them
+type Authenticator interface {
+	Authenticate(ctx context.Context, h Headers) (*Principal, error)
+}
+
+// Chain tries authenticators in order until one of them finds its credentials
+type Chain []Authenticator
+
+func (c Chain) Authenticate(ctx context.Context, h Headers) (*Principal, error) {
+	for _, a := range c {
+		p, err := a.Authenticate(ctx, h)
+		if errors.Is(err, ErrNoCredentials) {
+			continue
+		}
+
+		return p, err
+	}
+
+	return nil, ErrNoCredentials
+}
+
+// Challenges are WWW-Authenticate values of HTTP schemes in the chain
+func (c Chain) Challenges(realm string) []string {
+	var challenges []string
+	for _, a := range c {
+		if ch, ok := a.(interface{ Challenges(realm string) []string }); ok {
+			challenges = append(challenges, ch.Challenges(realm)...)
+		}
+	}
+
+	return challenges
+}
+
+// New builds authenticators of every kind of credentials configured for the API
+func New(cfg config.HTTPServer) (Chain, error) {
+	const op = "auth.New"
+
+	var chain Chain
+
+	if creds := cfg.APICredentials(); len(creds) > 0 {
+		basic, err := NewBasic(creds)
+		if err != nil {
+			return nil, err
+		}
+		chain = append(chain, basic)
+	}
+
+	if len(cfg.APIKeys) > 0 {
+		keys, err := NewAPIKeys(cfg.APIKeys)
+		if err != nil {
+			return nil, err
+		}
+		chain = append(chain, keys)
+	}
+
+	if len(cfg.JWT.Secrets) > 0 || cfg.JWT.JWKSFile != "" {
+		tokens, err := NewJWT(cfg.JWT)
+		if err != nil {
+			return nil, err
+		}
+		chain = append(chain, tokens)
+	}
+
+	if len(cfg.ClientCerts) > 0 {
+		if cfg.TLS.ClientCAFile == "" {
+			return nil, fmt.Errorf("%s: client certificates require tls.client_ca_file", op)
+		}
+		certs, err := NewClientCerts(cfg.ClientCerts)
+		if err != nil {
+			return nil, err
+		}
+		chain = append(chain, certs)
+	}
+
+	if len(chain) == 0 {
+		return nil, fmt.Errorf("%s: no credentials configured", op)
+	}
+
+	return chain, nil
+}
+
+// Reloadable is authenticator which is replaced when credentials are re-read
+type Reloadable struct {
+	chain atomic.Pointer[Chain]
+}
+
+func NewReloadable(chain Chain) *Reloadable {
+	r := &Reloadable{}
+	r.Store(chain)
+
+	return r
+}
+
+// Store replaces authenticators, requests in flight finish with the previous ones
+func (r *Reloadable) Store(chain Chain) {
+	r.chain.Store(&chain)
+}
+
+func (r *Reloadable) Authenticate(ctx context.Context, h Headers) (*Principal, error) {
+	return r.chain.Load().Authenticate(ctx, h)
+}
+
+func (r *Reloadable) Challenges(realm string) []string {
+	return r.chain.Load().Challenges(realm)
+}
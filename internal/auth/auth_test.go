@@ -0,0 +1,435 @@
+package auth_test
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/m1al04949/avito-tech-service/internal/auth"
+	"github.com/m1al04949/avito-tech-service/internal/config"
+	"github.com/m1al04949/avito-tech-service/internal/model"
+	"github.com/m1al04949/avito-tech-service/internal/storage/memory"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+var ctx = context.Background()
+
+func TestNewBasic(t *testing.T) {
+	for name, creds := range map[string][]config.Credential{
+		"empty":        nil,
+		"unknown role": {{User: "u", Password: "p", Role: "root"}},
+		"no password":  {{User: "u", Role: config.RoleReader}},
+		"duplicate": {
+			{User: "u", Password: "p", Role: config.RoleReader},
+			{User: "u", Password: "q", Role: config.RoleAdmin},
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			_, err := auth.NewBasic(creds)
+			require.Error(t, err)
+		})
+	}
+
+	basic, err := auth.NewBasic([]config.Credential{
+		{User: "reader", Password: "secret", Role: config.RoleReader, Segments: []string{"AVITO_"}},
+	})
+	require.NoError(t, err)
+
+	p, err := basic.Authenticate(ctx, basicAuth("reader", "secret"))
+	require.NoError(t, err)
+	require.Equal(t, auth.RoleReader, p.Role)
+	require.Equal(t, auth.MethodBasic, p.Method)
+	require.True(t, p.Allows(auth.RoleReader))
+	require.False(t, p.Allows(auth.RoleWriter))
+	require.True(t, p.AllowsSegment("AVITO_VOICE"))
+	require.False(t, p.AllowsSegment("OZON_VOICE"))
+
+	_, err = basic.Authenticate(ctx, basicAuth("reader", "wrong"))
+	require.ErrorIs(t, err, auth.ErrInvalidCredentials)
+	_, err = basic.Authenticate(ctx, basicAuth("nobody", "secret"))
+	require.ErrorIs(t, err, auth.ErrInvalidCredentials)
+	_, err = basic.Authenticate(ctx, http.Header{"Authorization": {"Bearer token"}})
+	require.ErrorIs(t, err, auth.ErrNoCredentials)
+}
+
+func TestHashedPasswords(t *testing.T) {
+	bcryptHash, err := bcrypt.GenerateFromPassword([]byte("bcrypt-pass"), bcrypt.MinCost)
+	require.NoError(t, err)
+
+	salt := []byte("0123456789abcdef")
+	argon2Hash := fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s", argon2.Version, 1024, 1, 1,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(argon2.IDKey([]byte("argon2-pass"), salt, 1, 1024, 1, 32)))
+
+	basic, err := auth.NewBasic([]config.Credential{
+		{User: "bcrypt", Password: config.Secret(bcryptHash), Role: config.RoleReader},
+		{User: "argon2", Password: config.Secret(argon2Hash), Role: config.RoleReader},
+	})
+	require.NoError(t, err)
+
+	for user, password := range map[string]string{"bcrypt": "bcrypt-pass", "argon2": "argon2-pass"} {
+		// Second check is served from cache of verified password
+		for i := 0; i < 2; i++ {
+			_, err = basic.Authenticate(ctx, basicAuth(user, password))
+			require.NoError(t, err)
+		}
+		_, err = basic.Authenticate(ctx, basicAuth(user, "wrong"))
+		require.ErrorIs(t, err, auth.ErrInvalidCredentials)
+		// Hash itself is not a password
+		_, err = basic.Authenticate(ctx, basicAuth(user, map[string]string{
+			"bcrypt": string(bcryptHash), "argon2": argon2Hash,
+		}[user]))
+		require.ErrorIs(t, err, auth.ErrInvalidCredentials)
+	}
+
+	for _, hash := range []string{"$2a$10$short", "$argon2id$v=19$m=0,t=1,p=1$c2FsdA$aGFzaA", "$argon2id$v=19$salt"} {
+		_, err := auth.NewBasic([]config.Credential{{User: "u", Password: config.Secret(hash), Role: config.RoleReader}})
+		require.Error(t, err, hash)
+	}
+}
+
+func TestReloadable(t *testing.T) {
+	first, err := auth.New(config.HTTPServer{User: "admin", Password: "first"})
+	require.NoError(t, err)
+	authenticator := auth.NewReloadable(first)
+
+	_, err = authenticator.Authenticate(ctx, basicAuth("admin", "first"))
+	require.NoError(t, err)
+
+	second, err := auth.New(config.HTTPServer{User: "admin", Password: "second"})
+	require.NoError(t, err)
+	authenticator.Store(second)
+
+	_, err = authenticator.Authenticate(ctx, basicAuth("admin", "first"))
+	require.ErrorIs(t, err, auth.ErrInvalidCredentials)
+	_, err = authenticator.Authenticate(ctx, basicAuth("admin", "second"))
+	require.NoError(t, err)
+}
+
+func TestAPIKeys(t *testing.T) {
+	hash := sha256.Sum256([]byte("analytics-key"))
+
+	for name, keys := range map[string][]config.APIKey{
+		"no name":      {{Hash: hex.EncodeToString(hash[:]), Role: config.RoleReader}},
+		"plain key":    {{Name: "analytics", Hash: "analytics-key", Role: config.RoleReader}},
+		"unknown role": {{Name: "analytics", Hash: hex.EncodeToString(hash[:]), Role: "root"}},
+	} {
+		t.Run(name, func(t *testing.T) {
+			_, err := auth.NewAPIKeys(keys)
+			require.Error(t, err)
+		})
+	}
+
+	keys, err := auth.NewAPIKeys([]config.APIKey{
+		{Name: "analytics", Hash: hex.EncodeToString(hash[:]), Role: config.RoleReader},
+	})
+	require.NoError(t, err)
+
+	p, err := keys.Authenticate(ctx, apiKey("analytics-key"))
+	require.NoError(t, err)
+	require.Equal(t, &auth.Principal{User: "analytics", Method: auth.MethodAPIKey, Role: auth.RoleReader}, p)
+
+	_, err = keys.Authenticate(ctx, apiKey("other-key"))
+	require.ErrorIs(t, err, auth.ErrInvalidCredentials)
+	_, err = keys.Authenticate(ctx, http.Header{})
+	require.ErrorIs(t, err, auth.ErrNoCredentials)
+}
+
+func TestClientCerts(t *testing.T) {
+	for name, certs := range map[string][]config.ClientCert{
+		"no cn":        {{Role: config.RoleWriter}},
+		"duplicate cn": {{CN: "billing", Role: config.RoleWriter}, {CN: "billing", Role: config.RoleReader}},
+		"unknown role": {{CN: "billing", Role: "root"}},
+	} {
+		t.Run(name, func(t *testing.T) {
+			_, err := auth.NewClientCerts(certs)
+			require.Error(t, err)
+		})
+	}
+
+	certs, err := auth.NewClientCerts([]config.ClientCert{
+		{CN: "billing", Role: config.RoleWriter, Segments: []string{"billing_"}},
+	})
+	require.NoError(t, err)
+
+	p, err := certs.Authenticate(withCN(ctx, "billing"), http.Header{})
+	require.NoError(t, err)
+	require.Equal(t, &auth.Principal{
+		User: "billing", Method: auth.MethodCert, Role: auth.RoleWriter, Segments: []string{"billing_"},
+	}, p)
+
+	_, err = certs.Authenticate(withCN(ctx, "web"), http.Header{})
+	require.ErrorIs(t, err, auth.ErrInvalidCredentials)
+	_, err = certs.Authenticate(ctx, http.Header{})
+	require.ErrorIs(t, err, auth.ErrNoCredentials)
+
+	_, err = auth.New(config.HTTPServer{ClientCerts: []config.ClientCert{{CN: "billing", Role: config.RoleWriter}}})
+	require.Error(t, err, "client certificates without CA bundle")
+}
+
+func withCN(ctx context.Context, cn string) context.Context {
+	return auth.WithClientCert(ctx, &x509.Certificate{Subject: pkix.Name{CommonName: cn}})
+}
+
+func TestJWTSecrets(t *testing.T) {
+	tokens, err := auth.NewJWT(config.JWT{
+		Secrets:       []config.Secret{"new-secret", "old-secret"},
+		Issuer:        "https://id.example.com",
+		IdentityClaim: "client_id",
+		RoleClaim:     "scope",
+		SegmentsClaim: "segments",
+		Roles:         map[string]string{"segments:write": config.RoleWriter},
+	})
+	require.NoError(t, err)
+
+	claims := func() jwt.MapClaims {
+		return jwt.MapClaims{
+			"iss":       "https://id.example.com",
+			"exp":       time.Now().Add(time.Hour).Unix(),
+			"client_id": "avito-voice",
+			"scope":     []string{"segments:read", "segments:write"},
+			"segments":  []string{"AVITO_VOICE_"},
+		}
+	}
+	sign := func(claims jwt.MapClaims, secret string) string {
+		token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(secret))
+		require.NoError(t, err)
+		return token
+	}
+
+	// Both secrets are accepted during rotation
+	for _, secret := range []string{"new-secret", "old-secret"} {
+		p, err := tokens.Authenticate(ctx, bearer(sign(claims(), secret)))
+		require.NoError(t, err)
+		require.Equal(t, &auth.Principal{
+			User:     "avito-voice",
+			Method:   auth.MethodJWT,
+			Role:     auth.RoleWriter,
+			Segments: []string{"AVITO_VOICE_"},
+		}, p)
+	}
+
+	invalid := map[string]string{
+		"unknown secret": sign(claims(), "other-secret"),
+		"no role":        sign(without(claims(), "scope"), "new-secret"),
+		"no identity":    sign(without(claims(), "client_id"), "new-secret"),
+		"no expiration":  sign(without(claims(), "exp"), "new-secret"),
+		"other issuer":   sign(with(claims(), "iss", "https://evil.example.com"), "new-secret"),
+		"expired":        sign(with(claims(), "exp", time.Now().Add(-time.Hour).Unix()), "new-secret"),
+		"unsigned":       unsigned(t, claims()),
+	}
+	for name, token := range invalid {
+		t.Run(name, func(t *testing.T) {
+			_, err := tokens.Authenticate(ctx, bearer(token))
+			require.ErrorIs(t, err, auth.ErrInvalidCredentials)
+		})
+	}
+}
+
+func TestJWTKeySet(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	b64 := func(b []byte) string { return base64.RawURLEncoding.EncodeToString(b) }
+	jwks, err := json.Marshal(map[string]any{"keys": []map[string]string{
+		{"kty": "RSA", "kid": "rsa-1", "use": "sig", "n": b64(rsaKey.N.Bytes()), "e": b64(big.NewInt(int64(rsaKey.E)).Bytes())},
+		{"kty": "EC", "crv": "P-256", "x": b64(ecKey.X.Bytes()), "y": b64(ecKey.Y.Bytes())},
+	}})
+	require.NoError(t, err)
+	path := filepath.Join(t.TempDir(), "jwks.json")
+	require.NoError(t, os.WriteFile(path, jwks, 0o600))
+
+	tokens, err := auth.NewJWT(config.JWT{
+		JWKSFile:      path,
+		IdentityClaim: "sub",
+		RoleClaim:     "role",
+	})
+	require.NoError(t, err)
+
+	claims := jwt.MapClaims{"sub": "reports", "role": "reader", "exp": time.Now().Add(time.Hour).Unix()}
+	sign := func(method jwt.SigningMethod, kid string, key any) string {
+		token := jwt.NewWithClaims(method, claims)
+		if kid != "" {
+			token.Header["kid"] = kid
+		}
+		signed, err := token.SignedString(key)
+		require.NoError(t, err)
+		return signed
+	}
+
+	p, err := tokens.Authenticate(ctx, bearer(sign(jwt.SigningMethodRS256, "rsa-1", rsaKey)))
+	require.NoError(t, err)
+	require.Equal(t, "reports", p.User)
+	require.Equal(t, auth.RoleReader, p.Role)
+
+	// Keys without kid are tried in turn
+	_, err = tokens.Authenticate(ctx, bearer(sign(jwt.SigningMethodES256, "", ecKey)))
+	require.NoError(t, err)
+
+	_, err = tokens.Authenticate(ctx, bearer(sign(jwt.SigningMethodRS256, "rsa-1", otherKey)))
+	require.ErrorIs(t, err, auth.ErrInvalidCredentials)
+	_, err = tokens.Authenticate(ctx, bearer(sign(jwt.SigningMethodRS256, "rsa-2", rsaKey)))
+	require.ErrorIs(t, err, auth.ErrInvalidCredentials)
+
+	// HMAC tokens are rejected without secrets, so public keys can not be used as them
+	_, err = tokens.Authenticate(ctx, bearer(sign(jwt.SigningMethodHS256, "", []byte("secret"))))
+	require.ErrorIs(t, err, auth.ErrInvalidCredentials)
+}
+
+func TestNew(t *testing.T) {
+	_, err := auth.New(config.HTTPServer{})
+	require.Error(t, err)
+
+	hash := sha256.Sum256([]byte("analytics-key"))
+	chain, err := auth.New(config.HTTPServer{
+		User:     "admin",
+		Password: "admin-pass",
+		APIKeys:  []config.APIKey{{Name: "analytics", Hash: hex.EncodeToString(hash[:]), Role: config.RoleReader}},
+		JWT:      config.JWT{Secrets: []config.Secret{"secret"}, IdentityClaim: "sub", RoleClaim: "role"},
+	})
+	require.NoError(t, err)
+	require.Equal(t, []string{`Basic realm="api"`, `Bearer realm="api"`}, chain.Challenges("api"))
+
+	p, err := chain.Authenticate(ctx, apiKey("analytics-key"))
+	require.NoError(t, err)
+	require.Equal(t, auth.MethodAPIKey, p.Method)
+
+	p, err = chain.Authenticate(ctx, basicAuth("admin", "admin-pass"))
+	require.NoError(t, err)
+	require.Equal(t, auth.RoleAdmin, p.Role)
+
+	_, err = chain.Authenticate(ctx, http.Header{"Authorization": {"Bearer not-a-token"}})
+	require.ErrorIs(t, err, auth.ErrInvalidCredentials)
+
+	_, err = chain.Authenticate(ctx, http.Header{})
+	require.ErrorIs(t, err, auth.ErrNoCredentials)
+}
+
+func basicAuth(user, password string) http.Header {
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.SetBasicAuth(user, password)
+	return r.Header
+}
+
+func apiKey(key string) http.Header {
+	h := http.Header{}
+	h.Set(auth.HeaderAPIKey, key)
+	return h
+}
+
+func bearer(token string) http.Header {
+	return http.Header{"Authorization": {"Bearer " + token}}
+}
+
+func with(claims jwt.MapClaims, name string, value any) jwt.MapClaims {
+	claims[name] = value
+	return claims
+}
+
+func without(claims jwt.MapClaims, name string) jwt.MapClaims {
+	delete(claims, name)
+	return claims
+}
+
+func unsigned(t *testing.T, claims jwt.MapClaims) string {
+	token, err := jwt.NewWithClaims(jwt.SigningMethodNone, claims).SignedString(jwt.UnsafeAllowNoneSignatureType)
+	require.NoError(t, err)
+	return token
+}
+
+func TestStorage(t *testing.T) {
+	repo := auth.Storage(memory.New())
+
+	// Calls without principal are not restricted
+	service := ctx
+	for _, segm := range []string{"AVITO_A", "AVITO_B", "OZON_A", "OZON_B", "AVITO_C"} {
+		require.NoError(t, repo.SaveSegm(service, segm, 0))
+	}
+	require.NoError(t, repo.SaveUser(service, 1))
+	_, err := repo.SaveSegmToUser(service, 1, []model.UserSegments{
+		{SegmentName: "AVITO_A"}, {SegmentName: "OZON_A"},
+	})
+	require.NoError(t, err)
+
+	ctx := auth.WithPrincipal(service, &auth.Principal{
+		User:     "avito",
+		Role:     auth.RoleWriter,
+		Segments: []string{"AVITO_"},
+	})
+
+	require.ErrorIs(t, repo.SaveSegm(ctx, "OZON_C", 0), auth.ErrForbidden)
+	require.ErrorIs(t, repo.DeleteSegm(ctx, "OZON_A"), auth.ErrForbidden)
+	_, err = repo.GetSegm(ctx, "OZON_A")
+	require.ErrorIs(t, err, auth.ErrForbidden)
+	_, err = repo.GetSegmUsers(ctx, "OZON_A", 0, 10)
+	require.ErrorIs(t, err, auth.ErrForbidden)
+	_, err = repo.SaveSegmToUser(ctx, 1, []model.UserSegments{{SegmentName: "AVITO_B"}, {SegmentName: "OZON_B"}})
+	require.ErrorIs(t, err, auth.ErrForbidden)
+	_, err = repo.DeleteSegmFromUser(ctx, 1, []string{"OZON_A"})
+	require.ErrorIs(t, err, auth.ErrForbidden)
+	_, _, err = repo.UpdateUserSegments(ctx, 1, nil, []string{"OZON_A"})
+	require.ErrorIs(t, err, auth.ErrForbidden)
+	require.ErrorIs(t, repo.DeleteUser(ctx, 1), auth.ErrForbidden)
+
+	segments, err := repo.GetUser(ctx, 1)
+	require.NoError(t, err)
+	require.Equal(t, []string{"AVITO_A"}, segments)
+
+	segments, _, err = repo.UpdateUserSegments(ctx, 1, []model.UserSegments{{SegmentName: "AVITO_B"}}, nil)
+	require.NoError(t, err)
+	require.ElementsMatch(t, []string{"AVITO_A", "AVITO_B"}, segments)
+
+	history, err := repo.GetHistory(ctx, time.Time{}, time.Now().Add(time.Hour))
+	require.NoError(t, err)
+	require.NotEmpty(t, history)
+	for _, h := range history {
+		require.True(t, strings.HasPrefix(h.SegmentName, "AVITO_"), h.SegmentName)
+	}
+
+	// Pages are filled with allowed segments only, so the next page starts after them
+	ctx = auth.WithPrincipal(service, &auth.Principal{
+		User:     "reader",
+		Role:     auth.RoleReader,
+		Segments: []string{"AVITO_", "OZON_B"},
+	})
+	page, err := repo.ListSegms(ctx, model.SegmentsFilter{SortBy: model.SortByName, Limit: 2})
+	require.NoError(t, err)
+	require.Equal(t, []string{"AVITO_A", "AVITO_B"}, names(page))
+
+	page, err = repo.ListSegms(ctx, model.SegmentsFilter{SortBy: model.SortByName, Limit: 2, After: &page[1]})
+	require.NoError(t, err)
+	require.Equal(t, []string{"AVITO_C", "OZON_B"}, names(page))
+}
+
+func names(segments []model.Segments) []string {
+	var n []string
+	for _, s := range segments {
+		n = append(n, s.SegmentName)
+	}
+
+	return n
+}
@@ -0,0 +1,86 @@
+package auth
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"strings"
+
+	"github.com/m1al04949/avito-tech-service/internal/config"
+)
+
+type credential struct {
+	password  *password
+	principal *Principal
+}
+
+// Basic checks user and password of "Authorization: Basic ..." header against configured credentials,
+// passwords may be stored as bcrypt or argon2id hashes
+type Basic struct {
+	creds map[string]credential
+}
+
+func NewBasic(creds []config.Credential) (*Basic, error) {
+	const op = "auth.NewBasic"
+
+	if len(creds) == 0 {
+		return nil, fmt.Errorf("%s: no credentials configured", op)
+	}
+
+	b := &Basic{creds: make(map[string]credential, len(creds))}
+	for _, c := range creds {
+		if c.User == "" || c.Password == "" {
+			return nil, fmt.Errorf("%s: user and password are required", op)
+		}
+		if _, ok := b.creds[c.User]; ok {
+			return nil, fmt.Errorf("%s: duplicate user %q", op, c.User)
+		}
+		principal, err := newPrincipal(MethodBasic, c.User, c.Role, c.Segments)
+		if err != nil {
+			return nil, fmt.Errorf("%s: user %q: %w", op, c.User, err)
+		}
+		pw, err := newPassword(c.Password.Value())
+		if err != nil {
+			return nil, fmt.Errorf("%s: user %q: %w", op, c.User, err)
+		}
+
+		b.creds[c.User] = credential{
+			password:  pw,
+			principal: principal,
+		}
+	}
+
+	return b, nil
+}
+
+func (b *Basic) Authenticate(_ context.Context, h Headers) (*Principal, error) {
+	user, password, ok := parseBasicAuth(h.Get("Authorization"))
+	if !ok {
+		return nil, ErrNoCredentials
+	}
+
+	c, ok := b.creds[user]
+	if !ok || !c.password.matches(password) {
+		return nil, ErrInvalidCredentials
+	}
+
+	return c.principal, nil
+}
+
+func (b *Basic) Challenges(realm string) []string {
+	return []string{`Basic realm="` + realm + `"`}
+}
+
+func parseBasicAuth(auth string) (user, password string, ok bool) {
+	const prefix = "Basic "
+
+	if len(auth) < len(prefix) || !strings.EqualFold(auth[:len(prefix)], prefix) {
+		return "", "", false
+	}
+	c, err := base64.StdEncoding.DecodeString(auth[len(prefix):])
+	if err != nil {
+		return "", "", false
+	}
+
+	return strings.Cut(string(c), ":")
+}
@@ -0,0 +1,65 @@
+package auth
+
+import (
+	"context"
+	"crypto/x509"
+	"fmt"
+
+	"github.com/m1al04949/avito-tech-service/internal/config"
+)
+
+// ClientCerts maps common name of client certificate to principal.
+// Certificate is verified by TLS handshake against CA bundle, so only its subject is checked here
+type ClientCerts struct {
+	names map[string]*Principal
+}
+
+func NewClientCerts(certs []config.ClientCert) (*ClientCerts, error) {
+	const op = "auth.NewClientCerts"
+
+	c := &ClientCerts{names: make(map[string]*Principal, len(certs))}
+	for _, cert := range certs {
+		if cert.CN == "" {
+			return nil, fmt.Errorf("%s: cn is required", op)
+		}
+		if _, ok := c.names[cert.CN]; ok {
+			return nil, fmt.Errorf("%s: duplicate cn %q", op, cert.CN)
+		}
+
+		principal, err := newPrincipal(MethodCert, cert.CN, cert.Role, cert.Segments)
+		if err != nil {
+			return nil, fmt.Errorf("%s: cn %q: %w", op, cert.CN, err)
+		}
+		c.names[cert.CN] = principal
+	}
+
+	return c, nil
+}
+
+func (c *ClientCerts) Authenticate(ctx context.Context, _ Headers) (*Principal, error) {
+	cert := ClientCertFromContext(ctx)
+	if cert == nil {
+		return nil, ErrNoCredentials
+	}
+
+	principal, ok := c.names[cert.Subject.CommonName]
+	if !ok {
+		return nil, ErrInvalidCredentials
+	}
+
+	return principal, nil
+}
+
+type ctxKeyClientCert struct{}
+
+// WithClientCert stores verified certificate of the peer, servers call it before authentication
+func WithClientCert(ctx context.Context, cert *x509.Certificate) context.Context {
+	return context.WithValue(ctx, ctxKeyClientCert{}, cert)
+}
+
+// ClientCertFromContext returns certificate stored by WithClientCert or nil
+func ClientCertFromContext(ctx context.Context) *x509.Certificate {
+	cert, _ := ctx.Value(ctxKeyClientCert{}).(*x509.Certificate)
+
+	return cert
+}
@@ -0,0 +1,289 @@
+package auth
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/m1al04949/avito-tech-service/internal/config"
+)
+
+// Allowed difference of clocks of the service and token issuer
+const jwtLeeway = 30 * time.Second
+
+// JWT checks "Authorization: Bearer ..." tokens signed with configured HMAC secrets
+// or keys of JWKS file and maps their claims to principal
+type JWT struct {
+	cfg     config.JWT
+	parser  *jwt.Parser
+	secrets []jwt.VerificationKey
+	// Public keys by key id, all of them are tried for tokens without kid
+	keys    map[string]jwt.VerificationKey
+	allKeys []jwt.VerificationKey
+}
+
+func NewJWT(cfg config.JWT) (*JWT, error) {
+	const op = "auth.NewJWT"
+
+	j := &JWT{cfg: cfg}
+
+	var methods []string
+	for _, secret := range cfg.Secrets {
+		if secret == "" {
+			return nil, fmt.Errorf("%s: empty secret", op)
+		}
+		j.secrets = append(j.secrets, []byte(secret.Value()))
+	}
+	if len(j.secrets) > 0 {
+		methods = append(methods, "HS256", "HS384", "HS512")
+	}
+
+	if cfg.JWKSFile != "" {
+		keys, err := loadJWKS(cfg.JWKSFile)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		j.keys = keys
+		for _, k := range keys {
+			j.allKeys = append(j.allKeys, k)
+		}
+		methods = append(methods, "RS256", "RS384", "RS512", "PS256", "PS384", "PS512", "ES256", "ES384", "ES512")
+	}
+
+	if len(methods) == 0 {
+		return nil, fmt.Errorf("%s: no secrets or jwks file configured", op)
+	}
+
+	for value, role := range cfg.Roles {
+		if _, err := ParseRole(role); err != nil {
+			return nil, fmt.Errorf("%s: role of %q: %w", op, value, err)
+		}
+	}
+
+	opts := []jwt.ParserOption{
+		jwt.WithValidMethods(methods),
+		jwt.WithExpirationRequired(),
+		jwt.WithLeeway(jwtLeeway),
+	}
+	if cfg.Issuer != "" {
+		opts = append(opts, jwt.WithIssuer(cfg.Issuer))
+	}
+	if cfg.Audience != "" {
+		opts = append(opts, jwt.WithAudience(cfg.Audience))
+	}
+	j.parser = jwt.NewParser(opts...)
+
+	return j, nil
+}
+
+func (j *JWT) Authenticate(_ context.Context, h Headers) (*Principal, error) {
+	const prefix = "Bearer "
+
+	header := h.Get("Authorization")
+	if len(header) < len(prefix) || !strings.EqualFold(header[:len(prefix)], prefix) {
+		return nil, ErrNoCredentials
+	}
+
+	claims := jwt.MapClaims{}
+	if _, err := j.parser.ParseWithClaims(header[len(prefix):], claims, j.key); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidCredentials, err)
+	}
+
+	principal, err := j.principal(claims)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidCredentials, err)
+	}
+
+	return principal, nil
+}
+
+func (j *JWT) Challenges(realm string) []string {
+	return []string{`Bearer realm="` + realm + `"`}
+}
+
+func (j *JWT) key(token *jwt.Token) (any, error) {
+	if _, ok := token.Method.(*jwt.SigningMethodHMAC); ok {
+		return jwt.VerificationKeySet{Keys: j.secrets}, nil
+	}
+
+	if kid, ok := token.Header["kid"].(string); ok && kid != "" {
+		key, ok := j.keys[kid]
+		if !ok {
+			return nil, fmt.Errorf("unknown key %q", kid)
+		}
+		return key, nil
+	}
+
+	return jwt.VerificationKeySet{Keys: j.allKeys}, nil
+}
+
+func (j *JWT) principal(claims jwt.MapClaims) (*Principal, error) {
+	user, _ := claims[j.cfg.IdentityClaim].(string)
+	if user == "" {
+		return nil, fmt.Errorf("claim %q is missing", j.cfg.IdentityClaim)
+	}
+
+	values, err := stringsClaim(claims, j.cfg.RoleClaim)
+	if err != nil {
+		return nil, err
+	}
+
+	// Token with several roles gets the highest of them
+	var role Role
+	for _, v := range values {
+		if mapped, ok := j.cfg.Roles[v]; ok {
+			v = mapped
+		}
+		if r, err := ParseRole(v); err == nil && r > role {
+			role = r
+		}
+	}
+	if role == 0 {
+		return nil, fmt.Errorf("claim %q has no known role", j.cfg.RoleClaim)
+	}
+
+	segments, err := stringsClaim(claims, j.cfg.SegmentsClaim)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Principal{
+		User:     user,
+		Method:   MethodJWT,
+		Role:     role,
+		Segments: segments,
+	}, nil
+}
+
+// Claim which is either a string or an array of strings
+func stringsClaim(claims jwt.MapClaims, name string) ([]string, error) {
+	switch v := claims[name].(type) {
+	case nil:
+		return nil, nil
+	case string:
+		return []string{v}, nil
+	case []any:
+		values := make([]string, 0, len(v))
+		for _, item := range v {
+			s, ok := item.(string)
+			if !ok {
+				return nil, fmt.Errorf("claim %q must be string or array of strings", name)
+			}
+			values = append(values, s)
+		}
+		return values, nil
+	}
+
+	return nil, fmt.Errorf("claim %q must be string or array of strings", name)
+}
+
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	// RSA
+	N string `json:"n"`
+	E string `json:"e"`
+	// EC
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// Load public RSA and EC keys of signatures from JWKS file
+func loadJWKS(path string) (map[string]jwt.VerificationKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := json.Unmarshal(data, &set); err != nil {
+		return nil, fmt.Errorf("jwks %s: %w", path, err)
+	}
+
+	keys := make(map[string]jwt.VerificationKey, len(set.Keys))
+	for i, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+
+		key, err := k.publicKey()
+		if err != nil {
+			return nil, fmt.Errorf("jwks %s: key %d: %w", path, i, err)
+		}
+
+		kid := k.Kid
+		if kid == "" {
+			kid = fmt.Sprintf("#%d", i)
+		}
+		keys[kid] = key
+	}
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("jwks %s: no signature keys", path)
+	}
+
+	return keys, nil
+}
+
+func (k jwk) publicKey() (jwt.VerificationKey, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := base64Int(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := base64Int(k.E)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, err := base64Int(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := base64Int(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		if !curve.IsOnCurve(x, y) {
+			return nil, errors.New("point is not on curve")
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	}
+
+	return nil, fmt.Errorf("unsupported key type %q", k.Kty)
+}
+
+func base64Int(s string) (*big.Int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil || len(b) == 0 {
+		return nil, errors.New("invalid key parameter")
+	}
+
+	return new(big.Int).SetBytes(b), nil
+}
@@ -0,0 +1,97 @@
+package auth
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+	"sync/atomic"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// password checks secret of basic auth, stored plain, as bcrypt or as argon2id hash
+type password struct {
+	check func(plain []byte) bool
+	// Hash of the last password which matched, so slow hashes are not computed on every request
+	verified atomic.Pointer[[sha256.Size]byte]
+}
+
+func newPassword(stored string) (*password, error) {
+	p := &password{}
+
+	switch {
+	case strings.HasPrefix(stored, "$2a$"), strings.HasPrefix(stored, "$2b$"), strings.HasPrefix(stored, "$2y$"):
+		hash := []byte(stored)
+		if _, err := bcrypt.Cost(hash); err != nil {
+			return nil, fmt.Errorf("bcrypt hash: %w", err)
+		}
+		p.check = func(plain []byte) bool {
+			return bcrypt.CompareHashAndPassword(hash, plain) == nil
+		}
+	case strings.HasPrefix(stored, "$argon2id$"):
+		check, err := argon2Check(stored)
+		if err != nil {
+			return nil, fmt.Errorf("argon2id hash: %w", err)
+		}
+		p.check = check
+	default:
+		plain := []byte(stored)
+		p.check = func(given []byte) bool {
+			return subtle.ConstantTimeCompare(given, plain) == 1
+		}
+	}
+
+	return p, nil
+}
+
+func (p *password) matches(plain string) bool {
+	sum := sha256.Sum256([]byte(plain))
+	if v := p.verified.Load(); v != nil && subtle.ConstantTimeCompare(v[:], sum[:]) == 1 {
+		return true
+	}
+
+	if !p.check([]byte(plain)) {
+		return false
+	}
+	p.verified.Store(&sum)
+
+	return true
+}
+
+// Check of hash in PHC format: $argon2id$v=19$m=65536,t=3,p=4$<salt>$<hash>
+func argon2Check(stored string) (func(plain []byte) bool, error) {
+	parts := strings.Split(stored, "$")
+	if len(parts) != 6 {
+		return nil, errors.New("expected $argon2id$v=19$m=...,t=...,p=...$salt$hash")
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return nil, fmt.Errorf("unsupported version %q", parts[2])
+	}
+
+	var memory, time uint32
+	var threads uint8
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &memory, &time, &threads); err != nil ||
+		memory == 0 || time == 0 || threads == 0 {
+		return nil, fmt.Errorf("invalid parameters %q", parts[3])
+	}
+
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return nil, errors.New("invalid salt")
+	}
+	hash, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil || len(hash) == 0 {
+		return nil, errors.New("invalid hash")
+	}
+
+	return func(plain []byte) bool {
+		given := argon2.IDKey(plain, salt, time, memory, threads, uint32(len(hash)))
+		return subtle.ConstantTimeCompare(given, hash) == 1
+	}, nil
+}
@@ -0,0 +1,211 @@
+package auth
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/m1al04949/avito-tech-service/internal/model"
+	"github.com/m1al04949/avito-tech-service/internal/storage"
+)
+
+type scopedRepository struct {
+	repo storage.Repository
+}
+
+// Storage wraps repo so principal of ctx only uses segments of its allowed prefixes:
+// operations on other segments fail with ErrForbidden and listings skip them.
+// Calls without principal, such as background workers, are not restricted
+func Storage(repo storage.Repository) storage.Repository {
+	return &scopedRepository{repo: repo}
+}
+
+func checkSegments(ctx context.Context, op string, slugs ...string) error {
+	p := FromContext(ctx)
+	if p == nil {
+		return nil
+	}
+	for _, slug := range slugs {
+		if !p.AllowsSegment(slug) {
+			return fmt.Errorf("%s: segment %q: %w", op, slug, ErrForbidden)
+		}
+	}
+
+	return nil
+}
+
+func allowedSegments(ctx context.Context, slugs []string) []string {
+	p := FromContext(ctx)
+	if p == nil || p.Unrestricted() {
+		return slugs
+	}
+
+	allowed := make([]string, 0, len(slugs))
+	for _, slug := range slugs {
+		if p.AllowsSegment(slug) {
+			allowed = append(allowed, slug)
+		}
+	}
+
+	return allowed
+}
+
+func (s *scopedRepository) SaveSegm(ctx context.Context, segmToSave string, autoPercent int) error {
+	if err := checkSegments(ctx, "auth.SaveSegm", segmToSave); err != nil {
+		return err
+	}
+
+	return s.repo.SaveSegm(ctx, segmToSave, autoPercent)
+}
+
+func (s *scopedRepository) DeleteSegm(ctx context.Context, segmToDelete string) error {
+	if err := checkSegments(ctx, "auth.DeleteSegm", segmToDelete); err != nil {
+		return err
+	}
+
+	return s.repo.DeleteSegm(ctx, segmToDelete)
+}
+
+func (s *scopedRepository) GetSegm(ctx context.Context, segment string) (model.Segments, error) {
+	if err := checkSegments(ctx, "auth.GetSegm", segment); err != nil {
+		return model.Segments{}, err
+	}
+
+	return s.repo.GetSegm(ctx, segment)
+}
+
+// ListSegms reads pages until limit is filled with allowed segments, so cursors keep working
+func (s *scopedRepository) ListSegms(ctx context.Context, filter model.SegmentsFilter) ([]model.Segments, error) {
+	p := FromContext(ctx)
+	if p == nil || p.Unrestricted() || p.AllowsSegment(filter.Prefix) {
+		return s.repo.ListSegms(ctx, filter)
+	}
+
+	var allowed []model.Segments
+	for {
+		page, err := s.repo.ListSegms(ctx, filter)
+		if err != nil {
+			return nil, err
+		}
+		for _, segm := range page {
+			if p.AllowsSegment(segm.SegmentName) {
+				allowed = append(allowed, segm)
+			}
+		}
+		if filter.Limit <= 0 || len(page) < filter.Limit || len(allowed) >= filter.Limit {
+			break
+		}
+		last := page[len(page)-1]
+		filter.After = &last
+	}
+
+	if filter.Limit > 0 && len(allowed) > filter.Limit {
+		allowed = allowed[:filter.Limit]
+	}
+
+	return allowed, nil
+}
+
+func (s *scopedRepository) GetSegmUsers(ctx context.Context, segment string, after, limit int) ([]int, error) {
+	if err := checkSegments(ctx, "auth.GetSegmUsers", segment); err != nil {
+		return nil, err
+	}
+
+	return s.repo.GetSegmUsers(ctx, segment, after, limit)
+}
+
+func (s *scopedRepository) StreamSegmUsers(ctx context.Context, segment string, fn func(user int) error) error {
+	if err := checkSegments(ctx, "auth.StreamSegmUsers", segment); err != nil {
+		return err
+	}
+
+	return s.repo.StreamSegmUsers(ctx, segment, fn)
+}
+
+func (s *scopedRepository) SaveUser(ctx context.Context, userToSave int) error {
+	return s.repo.SaveUser(ctx, userToSave)
+}
+
+// DeleteUser drops user from every segment, so it needs access to all of them
+func (s *scopedRepository) DeleteUser(ctx context.Context, userToDelete int) error {
+	if p := FromContext(ctx); p != nil && !p.Unrestricted() {
+		return fmt.Errorf("auth.DeleteUser: restricted to segments %s: %w",
+			strings.Join(p.Segments, ", "), ErrForbidden)
+	}
+
+	return s.repo.DeleteUser(ctx, userToDelete)
+}
+
+func (s *scopedRepository) GetUser(ctx context.Context, user int) ([]string, error) {
+	segments, err := s.repo.GetUser(ctx, user)
+	if err != nil {
+		return nil, err
+	}
+
+	return allowedSegments(ctx, segments), nil
+}
+
+func (s *scopedRepository) SaveSegmToUser(ctx context.Context, user int, segments []model.UserSegments) (
+	[]model.SegmentResult, error) {
+	for _, segm := range segments {
+		if err := checkSegments(ctx, "auth.SaveSegmToUser", segm.SegmentName); err != nil {
+			return nil, err
+		}
+	}
+
+	return s.repo.SaveSegmToUser(ctx, user, segments)
+}
+
+func (s *scopedRepository) DeleteSegmFromUser(ctx context.Context, user int, segments []string) (
+	[]model.SegmentResult, error) {
+	if err := checkSegments(ctx, "auth.DeleteSegmFromUser", segments...); err != nil {
+		return nil, err
+	}
+
+	return s.repo.DeleteSegmFromUser(ctx, user, segments)
+}
+
+func (s *scopedRepository) UpdateUserSegments(ctx context.Context, user int, add []model.UserSegments,
+	remove []string) ([]string, []model.SegmentResult, error) {
+	for _, segm := range add {
+		if err := checkSegments(ctx, "auth.UpdateUserSegments", segm.SegmentName); err != nil {
+			return nil, nil, err
+		}
+	}
+	if err := checkSegments(ctx, "auth.UpdateUserSegments", remove...); err != nil {
+		return nil, nil, err
+	}
+
+	segments, results, err := s.repo.UpdateUserSegments(ctx, user, add, remove)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return allowedSegments(ctx, segments), results, nil
+}
+
+func (s *scopedRepository) GetHistory(ctx context.Context, from, to time.Time) ([]model.UserSegmentsHistory, error) {
+	history, err := s.repo.GetHistory(ctx, from, to)
+	if err != nil {
+		return nil, err
+	}
+
+	p := FromContext(ctx)
+	if p == nil || p.Unrestricted() {
+		return history, nil
+	}
+
+	allowed := make([]model.UserSegmentsHistory, 0, len(history))
+	for _, h := range history {
+		if p.AllowsSegment(h.SegmentName) {
+			allowed = append(allowed, h)
+		}
+	}
+
+	return allowed, nil
+}
+
+func (s *scopedRepository) DeleteExpired(ctx context.Context) (int, error) {
+	return s.repo.DeleteExpired(ctx)
+}
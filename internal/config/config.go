@@ -1,6 +1,7 @@
 package config
 
 import (
+	"fmt"
 	"log"
 	"os"
 	"time"
@@ -10,40 +11,206 @@ import (
 
 type Config struct {
 	Env         string `yaml:"env" env:"ENV" env-default:"local"`
-	StoragePath string `yaml:"storage_path" env-required:"true"`
-	DatabaseURL string `yaml:"database_url" env-required:"true"`
-	HTTPServer  `yaml:"http_server"`
+	StorageType string `yaml:"storage_type" env:"STORAGE_TYPE" env-default:"postgres"`
+	StoragePath string `yaml:"storage_path"`
+	DatabaseURL Secret `yaml:"database_url" env:"DATABASE_URL"`
+	// File with database_url, such as mounted Kubernetes secret
+	DatabaseURLFile string `yaml:"database_url_file" env:"DATABASE_URL_FILE"`
+	// Apply pending migrations on start, otherwise refuse to start with outdated schema
+	MigrateOnStart bool          `yaml:"migrate_on_start" env-default:"true"`
+	QueryTimeouts  QueryTimeouts `yaml:"query_timeouts"`
+	HTTPServer     `yaml:"http_server"`
+	Reaper         `yaml:"reaper"`
+	Metrics        Metrics    `yaml:"metrics"`
+	GRPCServer     GRPCServer `yaml:"grpc_server"`
+	Tracing        Tracing    `yaml:"tracing"`
+}
+
+// Storage backends
+const (
+	StoragePostgres = "postgres"
+	StorageSQLite   = "sqlite"
+	StorageMemory   = "memory"
+)
+
+// Limits of storage queries by kind of operation, zero disables the limit.
+// Read and write limits are below HTTP server timeout, so the client gets an error
+// instead of a dropped connection
+type QueryTimeouts struct {
+	Read   time.Duration `yaml:"read" env-default:"3s"`
+	Write  time.Duration `yaml:"write" env-default:"3s"`
+	Export time.Duration `yaml:"export" env-default:"10m"`
+	Expire time.Duration `yaml:"expire" env-default:"1m"`
 }
 
 type HTTPServer struct {
 	Address     string        `yaml:"address" env-default:"localhost:8080"`
 	Timeout     time.Duration `yaml:"timeout" env-default:"4s"`
 	IdleTimeout time.Duration `yaml:"idle_timeout" env-default:"60s"`
-	User        string        `yaml:"user" env-required:"true"`
-	Password    string        `yaml:"password" env-required:"true" env:"HTTP_SERVER_PASSWORD"`
+	// Single admin credential, kept for configs written before credentials list
+	User         string `yaml:"user"`
+	Password     Secret `yaml:"password" env:"HTTP_SERVER_PASSWORD"`
+	PasswordFile string `yaml:"password_file" env:"HTTP_SERVER_PASSWORD_FILE"`
+	// Credentials of API consumers, shared by HTTP and gRPC servers
+	Credentials []Credential `yaml:"credentials"`
+	// Keys of API consumers sent in X-API-Key header
+	APIKeys []APIKey `yaml:"api_keys"`
+	// Bearer tokens of API consumers
+	JWT JWT `yaml:"jwt"`
+	// Client certificates of API consumers by CN, verified against tls.client_ca_file
+	ClientCerts []ClientCert `yaml:"client_certs"`
+	// HTTPS and TLS of gRPC server
+	TLS          TLS  `yaml:"tls"`
+	LegacyErrors bool `yaml:"legacy_errors" env-default:"false"`
+	// Time between readiness flip and stop of accepting connections
+	ShutdownDelay time.Duration `yaml:"shutdown_delay" env-default:"5s"`
+	// Time to drain in-flight requests on shutdown
+	ShutdownTimeout time.Duration `yaml:"shutdown_timeout" env-default:"20s"`
+}
+
+// Roles of API credentials
+const (
+	// GET endpoints only
+	RoleReader = "reader"
+	// Reader plus users and their segments
+	RoleWriter = "writer"
+	// Writer plus creation and deletion of segments
+	RoleAdmin = "admin"
+)
+
+type Credential struct {
+	User string `yaml:"user"`
+	// Plain, bcrypt ($2a$...) or argon2id ($argon2id$...) password
+	Password     Secret `yaml:"password"`
+	PasswordFile string `yaml:"password_file"`
+	Role         string `yaml:"role"`
+	// Prefixes of segment slugs the credential may use, empty allows every segment
+	Segments []string `yaml:"segments"`
+}
+
+type APIKey struct {
+	// Identity of the client in logs
+	Name string `yaml:"name"`
+	// Hex SHA-256 of the key, the key itself is not stored
+	Hash     string   `yaml:"hash"`
+	Role     string   `yaml:"role"`
+	Segments []string `yaml:"segments"`
+}
+
+type JWT struct {
+	// HMAC secrets of HS256, HS384 and HS512 tokens, several are accepted during rotation
+	Secrets []Secret `yaml:"secrets"`
+	// File with one secret per line, added to secrets
+	SecretsFile string `yaml:"secrets_file"`
+	// JSON Web Key Set with public keys of RS, PS and ES tokens
+	JWKSFile string `yaml:"jwks_file"`
+	// Required iss and aud of tokens, empty skips the check
+	Issuer   string `yaml:"issuer"`
+	Audience string `yaml:"audience"`
+	// Claims with client identity, role and allowed prefixes of segment slugs
+	IdentityClaim string `yaml:"identity_claim" env-default:"sub"`
+	RoleClaim     string `yaml:"role_claim" env-default:"role"`
+	SegmentsClaim string `yaml:"segments_claim" env-default:"segments"`
+	// Values of role claim mapped to reader, writer or admin, unmapped values are used as is
+	Roles map[string]string `yaml:"roles"`
+}
+
+type ClientCert struct {
+	// Common name of subject of client certificate
+	CN       string   `yaml:"cn"`
+	Role     string   `yaml:"role"`
+	Segments []string `yaml:"segments"`
+}
+
+type TLS struct {
+	// Certificate chain and key of the server, both enable TLS of HTTP and gRPC servers
+	CertFile string `yaml:"cert_file"`
+	KeyFile  string `yaml:"key_file"`
+	// CA bundle of client certificates, enables mTLS
+	ClientCAFile string `yaml:"client_ca_file"`
+	// Reject connections without client certificate, otherwise other credentials are accepted
+	RequireClientCert bool `yaml:"require_client_cert"`
+	// How often files are checked for changes
+	ReloadInterval time.Duration `yaml:"reload_interval" env-default:"10s"`
+}
+
+// Enabled reports whether servers use TLS
+func (t TLS) Enabled() bool {
+	return t.CertFile != "" || t.KeyFile != ""
+}
+
+// APICredentials is credentials list with user and password as admin
+func (s HTTPServer) APICredentials() []Credential {
+	creds := s.Credentials
+	if s.User != "" {
+		creds = append([]Credential{{User: s.User, Password: s.Password, Role: RoleAdmin}}, creds...)
+	}
+
+	return creds
+}
+
+type GRPCServer struct {
+	Address string `yaml:"address" env-default:"localhost:9090"`
+}
+
+// Exporters of traces
+const (
+	TracingOTLP   = "otlp"
+	TracingStdout = "stdout"
+	TracingNone   = "none"
+)
+
+type Tracing struct {
+	// otlp, stdout or none. With none trace ids are still propagated and logged
+	Exporter string `yaml:"exporter" env:"TRACING_EXPORTER" env-default:"none"`
+	// Address of OTLP gRPC collector
+	Endpoint string `yaml:"endpoint" env:"TRACING_ENDPOINT" env-default:"localhost:4317"`
+	Insecure bool   `yaml:"insecure" env-default:"true"`
+	// Share of traces started by the service which are recorded, sampled parent is always followed
+	SampleRatio float64 `yaml:"sample_ratio" env-default:"1"`
+}
+
+type Reaper struct {
+	Interval time.Duration `yaml:"interval" env-default:"1m"`
+}
+
+type Metrics struct {
+	// How often users of every segment are counted for segment_users metric
+	SegmentSizesInterval time.Duration `yaml:"segment_sizes_interval" env-default:"1m"`
 }
 
 func MustLoad() *Config {
+	cfg, err := Load()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	return cfg
+}
+
+// Load reads config file and secrets of *_file options, it is called again on reload
+func Load() (*Config, error) {
 	// Path to YAML file in project's directory
 	path := "avito-tech-service/config/local.yaml"
 
 	// Get Config Path using ROOT_PATH
 	configPath := os.Getenv("ROOT_PATH") + "/" + path
-	if configPath == "" {
-		log.Fatal("config path is not set")
-	}
 
 	// Check if file exists
 	if _, err := os.Stat(configPath); os.IsNotExist(err) {
-		log.Fatalf("config file does not exist: %s", configPath)
+		return nil, fmt.Errorf("config file does not exist: %s", configPath)
 	}
 
 	var cfg Config
 
 	// Reading config
 	if err := cleanenv.ReadConfig(configPath, &cfg); err != nil {
-		log.Fatalf("cannot read config: %s", err)
+		return nil, fmt.Errorf("cannot read config: %w", err)
+	}
+
+	if err := cfg.resolveSecrets(); err != nil {
+		return nil, fmt.Errorf("cannot read secrets: %w", err)
 	}
 
-	return &cfg
+	return &cfg, nil
 }
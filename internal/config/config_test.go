@@ -0,0 +1,93 @@
+package config_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/m1al04949/avito-tech-service/internal/config"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/exp/slog"
+)
+
+func writeConfig(t *testing.T, yaml string) string {
+	t.Helper()
+
+	root := t.TempDir()
+	dir := filepath.Join(root, "avito-tech-service", "config")
+	require.NoError(t, os.MkdirAll(dir, 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "local.yaml"), []byte(yaml), 0o600))
+	t.Setenv("ROOT_PATH", root)
+
+	return root
+}
+
+func TestLoadSecretFiles(t *testing.T) {
+	secrets := t.TempDir()
+	for name, value := range map[string]string{
+		"database_url": "host=db user=svc password=db-pass\n",
+		"password":     "admin-pass\n",
+		"reader":       "reader-pass",
+		"jwt":          "new-secret\nold-secret\n",
+	} {
+		require.NoError(t, os.WriteFile(filepath.Join(secrets, name), []byte(value), 0o600))
+	}
+
+	writeConfig(t, fmt.Sprintf(`
+database_url_file: %[1]s/database_url
+http_server:
+  user: admin
+  password_file: %[1]s/password
+  credentials:
+    - user: reader
+      password_file: %[1]s/reader
+      role: reader
+  jwt:
+    secrets: ["inline-secret"]
+    secrets_file: %[1]s/jwt
+`, secrets))
+
+	cfg, err := config.Load()
+	require.NoError(t, err)
+	require.Equal(t, "host=db user=svc password=db-pass", cfg.DatabaseURL.Value())
+	require.Equal(t, "admin-pass", cfg.HTTPServer.Password.Value())
+	require.Equal(t, "reader-pass", cfg.HTTPServer.Credentials[0].Password.Value())
+	require.Equal(t, []config.Secret{"inline-secret", "new-secret", "old-secret"}, cfg.HTTPServer.JWT.Secrets)
+}
+
+func TestLoadSecretConflict(t *testing.T) {
+	writeConfig(t, `
+database_url: "host=db"
+database_url_file: /run/secrets/database_url
+`)
+
+	_, err := config.Load()
+	require.ErrorContains(t, err, "database_url and database_url_file are both set")
+}
+
+func TestSecretIsNotPrinted(t *testing.T) {
+	cfg := &config.Config{DatabaseURL: "host=db password=db-pass"}
+	cfg.HTTPServer.Password = "admin-pass"
+	cfg.HTTPServer.JWT.Secrets = []config.Secret{"jwt-secret"}
+
+	var out bytes.Buffer
+	log := slog.New(slog.NewJSONHandler(&out, nil))
+	log.Info("config is loaded", slog.Any("config", cfg), slog.Any("password", cfg.HTTPServer.Password))
+
+	body, err := json.Marshal(cfg)
+	require.NoError(t, err)
+
+	for _, printed := range []string{
+		out.String(),
+		string(body),
+		fmt.Sprintf("%v %+v %#v %s", cfg, cfg, cfg, cfg.DatabaseURL),
+	} {
+		require.NotContains(t, printed, "db-pass")
+		require.NotContains(t, printed, "admin-pass")
+		require.NotContains(t, printed, "jwt-secret")
+		require.Contains(t, printed, "[REDACTED]")
+	}
+}
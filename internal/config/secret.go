@@ -0,0 +1,99 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"golang.org/x/exp/slog"
+)
+
+const redacted = "[REDACTED]"
+
+// Secret is config value which is never printed, neither by fmt, nor by loggers
+type Secret string
+
+// Value is the secret itself
+func (s Secret) Value() string {
+	return string(s)
+}
+
+func (s Secret) String() string {
+	if s == "" {
+		return ""
+	}
+
+	return redacted
+}
+
+func (s Secret) GoString() string {
+	return `"` + s.String() + `"`
+}
+
+func (s Secret) LogValue() slog.Value {
+	return slog.StringValue(s.String())
+}
+
+func (s Secret) MarshalJSON() ([]byte, error) {
+	return json.Marshal(s.String())
+}
+
+// Read secret from file, dropping trailing line break which editors and kubectl add
+func readSecretFile(path string) (Secret, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+
+	return Secret(strings.TrimRight(string(data), "\r\n")), nil
+}
+
+// Fill secret from file when its *_file option is set
+func resolveSecret(name string, value *Secret, path string) error {
+	if path == "" {
+		return nil
+	}
+	if *value != "" {
+		return fmt.Errorf("%s and %s_file are both set", name, name)
+	}
+
+	secret, err := readSecretFile(path)
+	if err != nil {
+		return fmt.Errorf("%s_file: %w", name, err)
+	}
+	*value = secret
+
+	return nil
+}
+
+// Read secrets of every *_file option
+func (c *Config) resolveSecrets() error {
+	if err := resolveSecret("database_url", &c.DatabaseURL, c.DatabaseURLFile); err != nil {
+		return err
+	}
+	if err := resolveSecret("http_server.password", &c.HTTPServer.Password, c.HTTPServer.PasswordFile); err != nil {
+		return err
+	}
+	for i := range c.HTTPServer.Credentials {
+		cred := &c.HTTPServer.Credentials[i]
+		if err := resolveSecret("credentials["+cred.User+"].password", &cred.Password, cred.PasswordFile); err != nil {
+			return err
+		}
+	}
+
+	if path := c.HTTPServer.JWT.SecretsFile; path != "" {
+		data, err := readSecretFile(path)
+		if err != nil {
+			return fmt.Errorf("jwt.secrets_file: %w", err)
+		}
+		// One secret per line
+		for _, line := range strings.Split(data.Value(), "\n") {
+			if line = strings.TrimSpace(line); line != "" {
+				c.HTTPServer.JWT.Secrets = append(c.HTTPServer.JWT.Secrets, Secret(line))
+			}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,145 @@
+package interceptor
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/m1al04949/avito-tech-service/internal/auth"
+	"github.com/m1al04949/avito-tech-service/internal/logger"
+	"github.com/m1al04949/avito-tech-service/internal/tracing"
+	"go.opentelemetry.io/otel"
+	otelcodes "go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.21.0"
+	"go.opentelemetry.io/otel/trace"
+	"golang.org/x/exp/slog"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// Logging logs every unary call the same way as HTTP logger middleware
+func Logging(log *slog.Logger) grpc.UnaryServerInterceptor {
+	log = log.With(
+		slog.String("component", "grpc-server/interceptor"),
+	)
+
+	log.Info("logger interceptor enabled")
+
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo,
+		handler grpc.UnaryHandler) (any, error) {
+
+		entry := log.With(
+			slog.String("method", info.FullMethod),
+			logger.Trace(ctx),
+		)
+		if p, ok := peer.FromContext(ctx); ok {
+			entry = entry.With(slog.String("remote_addr", p.Addr.String()))
+		}
+
+		t1 := time.Now()
+		resp, err := handler(ctx, req)
+
+		entry.Info("request completed",
+			slog.String("code", status.Code(err).String()),
+			slog.String("duration", time.Since(t1).String()),
+		)
+
+		return resp, err
+	}
+}
+
+// Tracing starts server span of every unary call, continuing the trace of
+// W3C traceparent metadata if the caller sent it
+func Tracing() grpc.UnaryServerInterceptor {
+	tracer := tracing.Tracer()
+
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo,
+		handler grpc.UnaryHandler) (any, error) {
+
+		md, _ := metadata.FromIncomingContext(ctx)
+		ctx = otel.GetTextMapPropagator().Extract(ctx, metadataCarrier(md))
+
+		service, method, _ := strings.Cut(strings.TrimPrefix(info.FullMethod, "/"), "/")
+		ctx, span := tracer.Start(ctx, info.FullMethod,
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(
+				semconv.RPCSystemGRPC,
+				semconv.RPCService(service),
+				semconv.RPCMethod(method),
+			),
+		)
+		defer span.End()
+
+		resp, err := handler(ctx, req)
+
+		code := status.Code(err)
+		span.SetAttributes(semconv.RPCGRPCStatusCodeKey.Int(int(code)))
+		if err != nil {
+			span.SetStatus(otelcodes.Error, err.Error())
+		}
+
+		return resp, err
+	}
+}
+
+// metadataCarrier lets propagator read trace context from incoming metadata
+type metadataCarrier metadata.MD
+
+func (c metadataCarrier) Get(key string) string {
+	if v := metadata.MD(c).Get(key); len(v) > 0 {
+		return v[0]
+	}
+
+	return ""
+}
+
+func (c metadataCarrier) Set(key, value string) {
+	metadata.MD(c).Set(key, value)
+}
+
+func (c metadataCarrier) Keys() []string {
+	keys := make([]string, 0, len(c))
+	for k := range c {
+		keys = append(keys, k)
+	}
+
+	return keys
+}
+
+// Auth authenticates the caller by metadata, the same as HTTP headers, and checks
+// the role required by the method, methods missing from roles need admin
+func Auth(authenticator auth.Authenticator, roles map[string]auth.Role) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo,
+		handler grpc.UnaryHandler) (any, error) {
+
+		md, _ := metadata.FromIncomingContext(ctx)
+
+		// Client certificate is already verified by TLS handshake
+		if p, ok := peer.FromContext(ctx); ok {
+			if info, ok := p.AuthInfo.(credentials.TLSInfo); ok && len(info.State.PeerCertificates) > 0 {
+				ctx = auth.WithClientCert(ctx, info.State.PeerCertificates[0])
+			}
+		}
+
+		principal, err := authenticator.Authenticate(ctx, metadataCarrier(md))
+		if err != nil {
+			return nil, status.Error(codes.Unauthenticated, "invalid credentials")
+		}
+
+		role, ok := roles[info.FullMethod]
+		if !ok {
+			role = auth.RoleAdmin
+		}
+		if !principal.Allows(role) {
+			return nil, status.Error(codes.PermissionDenied, role.String()+" role is required")
+		}
+
+		trace.SpanFromContext(ctx).SetAttributes(semconv.EnduserID(principal.User))
+
+		return handler(auth.WithPrincipal(ctx, principal), req)
+	}
+}
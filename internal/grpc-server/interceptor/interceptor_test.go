@@ -0,0 +1,69 @@
+package interceptor_test
+
+import (
+	"context"
+	"encoding/base64"
+	"testing"
+
+	"github.com/m1al04949/avito-tech-service/internal/auth"
+	"github.com/m1al04949/avito-tech-service/internal/config"
+	"github.com/m1al04949/avito-tech-service/internal/grpc-server/interceptor"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+func TestAuth(t *testing.T) {
+	authenticator, err := auth.New(config.HTTPServer{
+		Credentials: []config.Credential{
+			{User: "reader", Password: "reader-pass", Role: config.RoleReader},
+			{User: "writer", Password: "writer-pass", Role: config.RoleWriter},
+			{User: "admin", Password: "admin-pass", Role: config.RoleAdmin},
+		},
+	})
+	require.NoError(t, err)
+
+	authorize := interceptor.Auth(authenticator, map[string]auth.Role{
+		"/test.Service/Read":  auth.RoleReader,
+		"/test.Service/Write": auth.RoleWriter,
+	})
+
+	call := func(user, method string) (*auth.Principal, error) {
+		md := metadata.MD{}
+		if user != "" {
+			md.Set("authorization", "Basic "+base64.StdEncoding.EncodeToString([]byte(user+":"+user+"-pass")))
+		}
+		ctx := metadata.NewIncomingContext(context.Background(), md)
+
+		var principal *auth.Principal
+		_, err := authorize(ctx, nil, &grpc.UnaryServerInfo{FullMethod: method},
+			func(ctx context.Context, _ any) (any, error) {
+				principal = auth.FromContext(ctx)
+				return nil, nil
+			})
+
+		return principal, err
+	}
+
+	for _, tc := range []struct {
+		user, method string
+		code         codes.Code
+	}{
+		{"", "/test.Service/Read", codes.Unauthenticated},
+		{"nobody", "/test.Service/Read", codes.Unauthenticated},
+		{"reader", "/test.Service/Read", codes.OK},
+		{"reader", "/test.Service/Write", codes.PermissionDenied},
+		{"writer", "/test.Service/Write", codes.OK},
+		// Methods missing from roles need admin
+		{"writer", "/test.Service/Unmapped", codes.PermissionDenied},
+		{"admin", "/test.Service/Unmapped", codes.OK},
+	} {
+		principal, err := call(tc.user, tc.method)
+		require.Equal(t, tc.code, status.Code(err), "%s %s", tc.user, tc.method)
+		if tc.code == codes.OK {
+			require.Equal(t, tc.user, principal.User)
+		}
+	}
+}
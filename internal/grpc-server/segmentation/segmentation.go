@@ -0,0 +1,294 @@
+package segmentation
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/m1al04949/avito-tech-service/internal/auth"
+	"github.com/m1al04949/avito-tech-service/internal/lib/response/segmentsconv"
+	"github.com/m1al04949/avito-tech-service/internal/logger"
+	"github.com/m1al04949/avito-tech-service/internal/model"
+	"github.com/m1al04949/avito-tech-service/internal/storage"
+	segmentationv1 "github.com/m1al04949/avito-tech-service/pkg/api/segmentation/v1"
+	"golang.org/x/exp/slog"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+type Storage interface {
+	SaveSegm(ctx context.Context, segmToSave string, autoPercent int) error
+	DeleteSegm(context.Context, string) error
+	SaveUser(context.Context, int) error
+	DeleteUser(context.Context, int) error
+	SaveSegmToUser(context.Context, int, []model.UserSegments) ([]model.SegmentResult, error)
+	DeleteSegmFromUser(context.Context, int, []string) ([]model.SegmentResult, error)
+	GetUser(context.Context, int) ([]string, error)
+}
+
+// Server implements gRPC SegmentationService on top of storage,
+// reporting the same errors as HTTP handlers with gRPC status codes
+type Server struct {
+	segmentationv1.UnimplementedSegmentationServiceServer
+	log   *slog.Logger
+	store Storage
+}
+
+func Register(gRPC *grpc.Server, log *slog.Logger, store Storage) {
+	segmentationv1.RegisterSegmentationServiceServer(gRPC, &Server{
+		log:   log,
+		store: store,
+	})
+}
+
+func (s *Server) CreateSegment(ctx context.Context, req *segmentationv1.CreateSegmentRequest) (
+	*segmentationv1.CreateSegmentResponse, error) {
+	const op = "grpc.createsegment"
+
+	log := s.log.With(slog.String("op", op), logger.Trace(ctx), auth.Attr(ctx))
+
+	segment := req.GetSlug()
+	if segment == "" {
+		return nil, status.Error(codes.InvalidArgument, "segment name (slug) is empty")
+	}
+	autoPercent := int(req.GetAutoPercent())
+	if autoPercent < 0 || autoPercent > 100 {
+		return nil, status.Error(codes.InvalidArgument, "auto_percent must be between 0 and 100")
+	}
+
+	err := s.store.SaveSegm(ctx, segment, autoPercent)
+	if errors.Is(err, auth.ErrForbidden) {
+		log.Info("access denied", logger.Err(err))
+		return nil, status.Error(codes.PermissionDenied, "access to segment is denied")
+	}
+	if errors.Is(err, storage.ErrSegmentExists) {
+		log.Info("segment already exists", slog.String("segment", segment))
+		return nil, status.Error(codes.AlreadyExists, "segment already exists")
+	}
+	if err != nil {
+		log.Error("failed to add segment", logger.Err(err))
+		return nil, status.Error(codes.Internal, "failed to add segment")
+	}
+
+	log.Info("segment added", slog.String("segment", segment), slog.Int("auto_percent", autoPercent))
+
+	return &segmentationv1.CreateSegmentResponse{
+		Slug:        segment,
+		AutoPercent: req.GetAutoPercent(),
+	}, nil
+}
+
+func (s *Server) DeleteSegment(ctx context.Context, req *segmentationv1.DeleteSegmentRequest) (
+	*segmentationv1.DeleteSegmentResponse, error) {
+	const op = "grpc.deletesegment"
+
+	log := s.log.With(slog.String("op", op), logger.Trace(ctx), auth.Attr(ctx))
+
+	segment := req.GetSlug()
+
+	err := s.store.DeleteSegm(ctx, segment)
+	if errors.Is(err, auth.ErrForbidden) {
+		log.Info("access denied", logger.Err(err))
+		return nil, status.Error(codes.PermissionDenied, "access to segment is denied")
+	}
+	if errors.Is(err, storage.ErrSegmentNotExists) {
+		log.Info("segment not exists", slog.String("segment", segment))
+		return nil, status.Error(codes.NotFound, "segment not exists")
+	}
+	if errors.Is(err, storage.ErrSegmentDelete) {
+		log.Info("delete segment from user segments table", slog.String("segment", segment))
+		return nil, status.Error(codes.FailedPrecondition, "delete segment from user segments table")
+	}
+	if err != nil {
+		log.Error("failed to delete segment", logger.Err(err))
+		return nil, status.Error(codes.Internal, "failed to delete segment")
+	}
+
+	log.Info("segment deleted", slog.String("segment", segment))
+
+	return &segmentationv1.DeleteSegmentResponse{Slug: segment}, nil
+}
+
+func (s *Server) CreateUser(ctx context.Context, req *segmentationv1.CreateUserRequest) (
+	*segmentationv1.CreateUserResponse, error) {
+	const op = "grpc.createuser"
+
+	log := s.log.With(slog.String("op", op), logger.Trace(ctx), auth.Attr(ctx))
+
+	user := int(req.GetUserId())
+	if user == 0 {
+		return nil, status.Error(codes.InvalidArgument, "user_id is empty")
+	}
+
+	err := s.store.SaveUser(ctx, user)
+	if errors.Is(err, storage.ErrUserExists) {
+		log.Info("user already exists", slog.Int("user", user))
+		return nil, status.Error(codes.AlreadyExists, "user already exists")
+	}
+	if err != nil {
+		log.Error("failed to save user", logger.Err(err))
+		return nil, status.Error(codes.Internal, "failed to save user")
+	}
+
+	log.Info("user added", slog.Int("user", user))
+
+	return &segmentationv1.CreateUserResponse{UserId: req.GetUserId()}, nil
+}
+
+func (s *Server) DeleteUser(ctx context.Context, req *segmentationv1.DeleteUserRequest) (
+	*segmentationv1.DeleteUserResponse, error) {
+	const op = "grpc.deleteuser"
+
+	log := s.log.With(slog.String("op", op), logger.Trace(ctx), auth.Attr(ctx))
+
+	user := int(req.GetUserId())
+
+	err := s.store.DeleteUser(ctx, user)
+	if errors.Is(err, auth.ErrForbidden) {
+		log.Info("access denied", logger.Err(err))
+		return nil, status.Error(codes.PermissionDenied, "access to segments of user is denied")
+	}
+	if errors.Is(err, storage.ErrUserNotExists) {
+		log.Info("user not exists", slog.Int("user", user))
+		return nil, status.Error(codes.NotFound, "user not exists")
+	}
+	if errors.Is(err, storage.ErrUserDelete) {
+		log.Info("delete user from user segments table", slog.Int("user", user))
+		return nil, status.Error(codes.FailedPrecondition, "delete user from user segments table")
+	}
+	if err != nil {
+		log.Error("failed to delete user", logger.Err(err))
+		return nil, status.Error(codes.Internal, "failed to delete user")
+	}
+
+	log.Info("user deleted", slog.Int("user", user))
+
+	return &segmentationv1.DeleteUserResponse{UserId: req.GetUserId()}, nil
+}
+
+func (s *Server) AddSegmentsToUser(ctx context.Context, req *segmentationv1.AddSegmentsToUserRequest) (
+	*segmentationv1.AddSegmentsToUserResponse, error) {
+	const op = "grpc.addsegmentstouser"
+
+	log := s.log.With(slog.String("op", op), logger.Trace(ctx), auth.Attr(ctx))
+
+	user := int(req.GetUserId())
+
+	segms := make([]model.Segment, 0, len(req.GetSegments()))
+	for _, v := range req.GetSegments() {
+		segm := model.Segment{Slug: v.GetSlug()}
+		if v.GetTtl() != nil {
+			segm.TTL = v.GetTtl().AsDuration().String()
+		}
+		if v.GetExpiresAt() != nil {
+			expiresAt := v.GetExpiresAt().AsTime()
+			segm.ExpiresAt = &expiresAt
+		}
+		segms = append(segms, segm)
+	}
+
+	segments, err := segmentsconv.UserSegmentsConv(user, segms, time.Now())
+	if err != nil {
+		log.Info("invalid segment expiration", logger.Err(err))
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	results, err := s.store.SaveSegmToUser(ctx, user, segments)
+	if errors.Is(err, auth.ErrForbidden) {
+		log.Info("access denied", logger.Err(err))
+		return nil, status.Error(codes.PermissionDenied, "access to segment is denied")
+	}
+	if errors.Is(err, storage.ErrUserNotExists) {
+		log.Info("user not exists", slog.Int("user", user))
+		return nil, status.Error(codes.NotFound, "user not exists")
+	}
+	if err != nil {
+		log.Error("failed to save segments for user", logger.Err(err))
+		return nil, status.Error(codes.Internal, "failed to save segments for user")
+	}
+
+	log.Info("segments added for user", slog.Int("user", user))
+
+	return &segmentationv1.AddSegmentsToUserResponse{
+		UserId:  req.GetUserId(),
+		Results: resultsConv(results),
+	}, nil
+}
+
+func (s *Server) RemoveSegmentsFromUser(ctx context.Context, req *segmentationv1.RemoveSegmentsFromUserRequest) (
+	*segmentationv1.RemoveSegmentsFromUserResponse, error) {
+	const op = "grpc.removesegmentsfromuser"
+
+	log := s.log.With(slog.String("op", op), logger.Trace(ctx), auth.Attr(ctx))
+
+	user := int(req.GetUserId())
+
+	results, err := s.store.DeleteSegmFromUser(ctx, user, req.GetSlugs())
+	if errors.Is(err, auth.ErrForbidden) {
+		log.Info("access denied", logger.Err(err))
+		return nil, status.Error(codes.PermissionDenied, "access to segment is denied")
+	}
+	if errors.Is(err, storage.ErrUserNotExists) {
+		log.Info("user not exists", slog.Int("user", user))
+		return nil, status.Error(codes.NotFound, "user not exists")
+	}
+	if err != nil {
+		log.Error("failed to delete segments from user", logger.Err(err))
+		return nil, status.Error(codes.Internal, "failed to delete segments from user")
+	}
+
+	log.Info("segments deleted from user", slog.Int("user", user))
+
+	return &segmentationv1.RemoveSegmentsFromUserResponse{
+		UserId:  req.GetUserId(),
+		Results: resultsConv(results),
+	}, nil
+}
+
+func (s *Server) GetUserSegments(ctx context.Context, req *segmentationv1.GetUserSegmentsRequest) (
+	*segmentationv1.GetUserSegmentsResponse, error) {
+	const op = "grpc.getusersegments"
+
+	log := s.log.With(slog.String("op", op), logger.Trace(ctx), auth.Attr(ctx))
+
+	user := int(req.GetUserId())
+
+	segments, err := s.store.GetUser(ctx, user)
+	if errors.Is(err, storage.ErrUserNotExists) {
+		log.Info("user not exists", slog.Int("user", user))
+		return nil, status.Error(codes.NotFound, "user not exists")
+	}
+	if err != nil {
+		log.Error("failed to get user info", logger.Err(err))
+		return nil, status.Error(codes.Internal, "failed to get user info")
+	}
+
+	log.Info("user info is getted", slog.Int("user", user))
+
+	return &segmentationv1.GetUserSegmentsResponse{
+		UserId: req.GetUserId(),
+		Slugs:  segments,
+	}, nil
+}
+
+var resultCodes = map[string]segmentationv1.SegmentResult_Result{
+	model.ResultAdded:          segmentationv1.SegmentResult_RESULT_ADDED,
+	model.ResultAlreadyMember:  segmentationv1.SegmentResult_RESULT_ALREADY_MEMBER,
+	model.ResultUnknownSegment: segmentationv1.SegmentResult_RESULT_UNKNOWN_SEGMENT,
+	model.ResultRemoved:        segmentationv1.SegmentResult_RESULT_REMOVED,
+	model.ResultNotMember:      segmentationv1.SegmentResult_RESULT_NOT_MEMBER,
+}
+
+func resultsConv(results []model.SegmentResult) []*segmentationv1.SegmentResult {
+	res := make([]*segmentationv1.SegmentResult, 0, len(results))
+
+	for _, v := range results {
+		res = append(res, &segmentationv1.SegmentResult{
+			Slug:   v.Slug,
+			Result: resultCodes[v.Result],
+		})
+	}
+
+	return res
+}
@@ -0,0 +1,50 @@
+package grpcserver
+
+import (
+	"crypto/tls"
+
+	"github.com/m1al04949/avito-tech-service/internal/auth"
+	"github.com/m1al04949/avito-tech-service/internal/grpc-server/interceptor"
+	"github.com/m1al04949/avito-tech-service/internal/grpc-server/segmentation"
+	segmentationv1 "github.com/m1al04949/avito-tech-service/pkg/api/segmentation/v1"
+	"golang.org/x/exp/slog"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/reflection"
+)
+
+// Roles required by methods, the same as of matching HTTP routes
+var methodRoles = map[string]auth.Role{
+	segmentationv1.SegmentationService_CreateSegment_FullMethodName:          auth.RoleAdmin,
+	segmentationv1.SegmentationService_DeleteSegment_FullMethodName:          auth.RoleAdmin,
+	segmentationv1.SegmentationService_CreateUser_FullMethodName:             auth.RoleWriter,
+	segmentationv1.SegmentationService_DeleteUser_FullMethodName:             auth.RoleWriter,
+	segmentationv1.SegmentationService_AddSegmentsToUser_FullMethodName:      auth.RoleWriter,
+	segmentationv1.SegmentationService_RemoveSegmentsFromUser_FullMethodName: auth.RoleWriter,
+	segmentationv1.SegmentationService_GetUserSegments_FullMethodName:        auth.RoleReader,
+}
+
+// New builds gRPC server with the same credentials as HTTP API.
+// Reflection is left unauthenticated so grpcurl can discover the schema.
+// Server uses TLS when tlsConfig is not nil
+func New(log *slog.Logger, store segmentation.Storage, authenticator auth.Authenticator,
+	tlsConfig *tls.Config) *grpc.Server {
+
+	opts := []grpc.ServerOption{
+		grpc.ChainUnaryInterceptor(
+			interceptor.Tracing(),
+			interceptor.Logging(log),
+			interceptor.Auth(authenticator, methodRoles),
+		),
+	}
+	if tlsConfig != nil {
+		opts = append(opts, grpc.Creds(credentials.NewTLS(tlsConfig)))
+	}
+
+	gRPC := grpc.NewServer(opts...)
+
+	segmentation.Register(gRPC, log, store)
+	reflection.Register(gRPC)
+
+	return gRPC
+}
@@ -0,0 +1,208 @@
+package grpcserver_test
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/m1al04949/avito-tech-service/internal/auth"
+	"github.com/m1al04949/avito-tech-service/internal/config"
+	grpcserver "github.com/m1al04949/avito-tech-service/internal/grpc-server"
+	"github.com/m1al04949/avito-tech-service/internal/grpc-server/segmentation"
+	"github.com/m1al04949/avito-tech-service/internal/storage/memory"
+	segmentationv1 "github.com/m1al04949/avito-tech-service/pkg/api/segmentation/v1"
+	"github.com/m1al04949/avito-tech-service/pkg/slogdiscard"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/types/known/durationpb"
+)
+
+// newClient serves store over in-memory listener with the same credentials as router tests
+func newClient(t *testing.T, store segmentation.Storage) segmentationv1.SegmentationServiceClient {
+	t.Helper()
+
+	authenticator, err := auth.New(config.HTTPServer{
+		Credentials: []config.Credential{
+			{User: "reader", Password: "reader-pass", Role: config.RoleReader},
+			{User: "writer", Password: "writer-pass", Role: config.RoleWriter},
+			{User: "admin", Password: "admin-pass", Role: config.RoleAdmin},
+			{User: "avito", Password: "avito-pass", Role: config.RoleWriter, Segments: []string{"AVITO_"}},
+		},
+	})
+	require.NoError(t, err)
+
+	lis := bufconn.Listen(1 << 20)
+	srv := grpcserver.New(slogdiscard.NewDiscardLogger(), store, authenticator, nil)
+	go srv.Serve(lis) //nolint:errcheck
+	t.Cleanup(srv.Stop)
+
+	conn, err := grpc.DialContext(context.Background(), "bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return lis.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+
+	return segmentationv1.NewSegmentationServiceClient(conn)
+}
+
+func as(user string) context.Context {
+	token := base64.StdEncoding.EncodeToString([]byte(user + ":" + user + "-pass"))
+
+	return metadata.AppendToOutgoingContext(context.Background(), "authorization", "Basic "+token)
+}
+
+func TestRoles(t *testing.T) {
+	c := newClient(t, auth.Storage(memory.New()))
+
+	_, err := c.GetUserSegments(context.Background(), &segmentationv1.GetUserSegmentsRequest{UserId: 1000})
+	require.Equal(t, codes.Unauthenticated, status.Code(err))
+	_, err = c.GetUserSegments(as("nobody"), &segmentationv1.GetUserSegmentsRequest{UserId: 1000})
+	require.Equal(t, codes.Unauthenticated, status.Code(err))
+
+	// Segments are created and deleted by admins only
+	_, err = c.CreateSegment(as("writer"), &segmentationv1.CreateSegmentRequest{Slug: "AVITO_VOICE"})
+	require.Equal(t, codes.PermissionDenied, status.Code(err))
+	_, err = c.CreateSegment(as("admin"), &segmentationv1.CreateSegmentRequest{Slug: "AVITO_VOICE"})
+	require.NoError(t, err)
+	_, err = c.CreateSegment(as("admin"), &segmentationv1.CreateSegmentRequest{Slug: "OZON_VOICE"})
+	require.NoError(t, err)
+
+	// Readers only read
+	_, err = c.CreateUser(as("reader"), &segmentationv1.CreateUserRequest{UserId: 1000})
+	require.Equal(t, codes.PermissionDenied, status.Code(err))
+	_, err = c.CreateUser(as("writer"), &segmentationv1.CreateUserRequest{UserId: 1000})
+	require.NoError(t, err)
+	_, err = c.GetUserSegments(as("reader"), &segmentationv1.GetUserSegmentsRequest{UserId: 1000})
+	require.NoError(t, err)
+
+	// Writers limited by prefixes only use their segments
+	_, err = c.AddSegmentsToUser(as("avito"), &segmentationv1.AddSegmentsToUserRequest{
+		UserId: 1000, Segments: []*segmentationv1.UserSegment{{Slug: "OZON_VOICE"}},
+	})
+	require.Equal(t, codes.PermissionDenied, status.Code(err))
+	_, err = c.AddSegmentsToUser(as("avito"), &segmentationv1.AddSegmentsToUserRequest{
+		UserId: 1000, Segments: []*segmentationv1.UserSegment{{Slug: "AVITO_VOICE"}},
+	})
+	require.NoError(t, err)
+	_, err = c.RemoveSegmentsFromUser(as("avito"), &segmentationv1.RemoveSegmentsFromUserRequest{
+		UserId: 1000, Slugs: []string{"OZON_VOICE"},
+	})
+	require.Equal(t, codes.PermissionDenied, status.Code(err))
+	_, err = c.DeleteUser(as("avito"), &segmentationv1.DeleteUserRequest{UserId: 1000})
+	require.Equal(t, codes.PermissionDenied, status.Code(err))
+}
+
+func TestErrors(t *testing.T) {
+	c := newClient(t, memory.New())
+	ctx := as("admin")
+
+	_, err := c.CreateSegment(ctx, &segmentationv1.CreateSegmentRequest{Slug: "AVITO_VOICE"})
+	require.NoError(t, err)
+	_, err = c.CreateUser(ctx, &segmentationv1.CreateUserRequest{UserId: 1000})
+	require.NoError(t, err)
+
+	results, err := c.AddSegmentsToUser(ctx, &segmentationv1.AddSegmentsToUserRequest{
+		UserId: 1000,
+		Segments: []*segmentationv1.UserSegment{
+			{Slug: "AVITO_VOICE", Ttl: durationpb.New(time.Hour)},
+			{Slug: "UNKNOWN"},
+		},
+	})
+	require.NoError(t, err)
+	require.Equal(t, segmentationv1.SegmentResult_RESULT_ADDED, results.GetResults()[0].GetResult())
+	require.Equal(t, segmentationv1.SegmentResult_RESULT_UNKNOWN_SEGMENT, results.GetResults()[1].GetResult())
+
+	for name, tc := range map[string]struct {
+		call func() error
+		code codes.Code
+	}{
+		"empty slug": {func() error {
+			_, err := c.CreateSegment(ctx, &segmentationv1.CreateSegmentRequest{})
+			return err
+		}, codes.InvalidArgument},
+		"auto percent": {func() error {
+			_, err := c.CreateSegment(ctx, &segmentationv1.CreateSegmentRequest{Slug: "NEW", AutoPercent: 101})
+			return err
+		}, codes.InvalidArgument},
+		"segment exists": {func() error {
+			_, err := c.CreateSegment(ctx, &segmentationv1.CreateSegmentRequest{Slug: "AVITO_VOICE"})
+			return err
+		}, codes.AlreadyExists},
+		"segment not exists": {func() error {
+			_, err := c.DeleteSegment(ctx, &segmentationv1.DeleteSegmentRequest{Slug: "UNKNOWN"})
+			return err
+		}, codes.NotFound},
+		"segment has users": {func() error {
+			_, err := c.DeleteSegment(ctx, &segmentationv1.DeleteSegmentRequest{Slug: "AVITO_VOICE"})
+			return err
+		}, codes.FailedPrecondition},
+		"empty user": {func() error {
+			_, err := c.CreateUser(ctx, &segmentationv1.CreateUserRequest{})
+			return err
+		}, codes.InvalidArgument},
+		"user exists": {func() error {
+			_, err := c.CreateUser(ctx, &segmentationv1.CreateUserRequest{UserId: 1000})
+			return err
+		}, codes.AlreadyExists},
+		"user not exists": {func() error {
+			_, err := c.GetUserSegments(ctx, &segmentationv1.GetUserSegmentsRequest{UserId: 1001})
+			return err
+		}, codes.NotFound},
+		"user has segments": {func() error {
+			_, err := c.DeleteUser(ctx, &segmentationv1.DeleteUserRequest{UserId: 1000})
+			return err
+		}, codes.FailedPrecondition},
+		"add to unknown user": {func() error {
+			_, err := c.AddSegmentsToUser(ctx, &segmentationv1.AddSegmentsToUserRequest{
+				UserId: 1001, Segments: []*segmentationv1.UserSegment{{Slug: "AVITO_VOICE"}},
+			})
+			return err
+		}, codes.NotFound},
+		"negative ttl": {func() error {
+			_, err := c.AddSegmentsToUser(ctx, &segmentationv1.AddSegmentsToUserRequest{
+				UserId: 1000, Segments: []*segmentationv1.UserSegment{{Slug: "AVITO_VOICE", Ttl: durationpb.New(-time.Hour)}},
+			})
+			return err
+		}, codes.InvalidArgument},
+		"remove from unknown user": {func() error {
+			_, err := c.RemoveSegmentsFromUser(ctx, &segmentationv1.RemoveSegmentsFromUserRequest{
+				UserId: 1001, Slugs: []string{"AVITO_VOICE"},
+			})
+			return err
+		}, codes.NotFound},
+	} {
+		require.Equal(t, tc.code, status.Code(tc.call()), name)
+	}
+
+	segments, err := c.GetUserSegments(ctx, &segmentationv1.GetUserSegmentsRequest{UserId: 1000})
+	require.NoError(t, err)
+	require.Equal(t, []string{"AVITO_VOICE"}, segments.GetSlugs())
+}
+
+// brokenStorage fails every read of user segments
+type brokenStorage struct {
+	segmentation.Storage
+}
+
+func (brokenStorage) GetUser(context.Context, int) ([]string, error) {
+	return nil, errors.New("connection refused")
+}
+
+func TestInternalErrorIsHidden(t *testing.T) {
+	c := newClient(t, brokenStorage{memory.New()})
+
+	_, err := c.GetUserSegments(as("reader"), &segmentationv1.GetUserSegmentsRequest{UserId: 1000})
+	require.Equal(t, codes.Internal, status.Code(err))
+	require.NotContains(t, status.Convert(err).Message(), "connection refused")
+}
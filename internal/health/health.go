@@ -0,0 +1,112 @@
+// Package health tracks whether the service should receive traffic.
+package health
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	StatusOK   = "ok"
+	StatusFail = "fail"
+
+	// Limit of a single check, so a hung dependency does not hang the probe
+	checkTimeout = 2 * time.Second
+)
+
+var ErrDraining = errors.New("service is shutting down")
+
+// Readiness is turned off before shutdown, so load balancers stop
+// routing new requests to the instance while in-flight ones are drained.
+// It is also off while any dependency check fails
+type Readiness struct {
+	draining atomic.Bool
+	checks   []check
+}
+
+type check struct {
+	name string
+	fn   func(ctx context.Context) error
+}
+
+// Result of a single check
+type CheckResult struct {
+	Name    string  `json:"name"`
+	Status  string  `json:"status"`
+	Latency float64 `json:"latency_ms"`
+	Error   string  `json:"error,omitempty"`
+}
+
+// Report of all checks, status is ok only if every check is ok
+type Report struct {
+	Status string        `json:"status"`
+	Checks []CheckResult `json:"checks"`
+}
+
+// Add registers dependency check, checks must be added before the service starts
+func (r *Readiness) Add(name string, fn func(ctx context.Context) error) {
+	r.checks = append(r.checks, check{name: name, fn: fn})
+}
+
+// Drain marks the service as going to stop
+func (r *Readiness) Drain() {
+	r.draining.Store(true)
+}
+
+// Draining reports whether the service is going to stop
+func (r *Readiness) Draining() bool {
+	return r.draining.Load()
+}
+
+// Check runs all checks concurrently
+func (r *Readiness) Check(ctx context.Context) Report {
+	results := make([]CheckResult, len(r.checks)+1)
+
+	results[0] = CheckResult{Name: "shutdown", Status: StatusOK}
+	if r.Draining() {
+		results[0].Status = StatusFail
+		results[0].Error = ErrDraining.Error()
+	}
+
+	var wg sync.WaitGroup
+	for i, c := range r.checks {
+		wg.Add(1)
+		go func(i int, c check) {
+			defer wg.Done()
+			results[i+1] = run(ctx, c)
+		}(i, c)
+	}
+	wg.Wait()
+
+	report := Report{Status: StatusOK, Checks: results}
+	for _, res := range results {
+		if res.Status != StatusOK {
+			report.Status = StatusFail
+		}
+	}
+
+	return report
+}
+
+func run(ctx context.Context, c check) CheckResult {
+	ctx, cancel := context.WithTimeout(ctx, checkTimeout)
+	defer cancel()
+
+	start := time.Now()
+	err := c.fn(ctx)
+
+	res := CheckResult{
+		Name:    c.name,
+		Status:  StatusOK,
+		Latency: float64(time.Since(start).Microseconds()) / 1000,
+	}
+	if err != nil {
+		res.Status = StatusFail
+		res.Error = err.Error()
+	}
+
+	return res
+}
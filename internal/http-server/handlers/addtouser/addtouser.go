@@ -1,14 +1,17 @@
 package addtouser
 
 import (
+	"context"
 	"errors"
 	"net/http"
 	"strconv"
+	"time"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
 	"github.com/go-chi/render"
 	"github.com/go-playground/validator/v10"
+	"github.com/m1al04949/avito-tech-service/internal/auth"
 	"github.com/m1al04949/avito-tech-service/internal/lib/response"
 	"github.com/m1al04949/avito-tech-service/internal/lib/response/segmentsconv"
 	"github.com/m1al04949/avito-tech-service/internal/logger"
@@ -23,13 +26,13 @@ type Request struct {
 
 type Response struct {
 	response.Response
-	UserID   int             `json:"user_id"`
-	Segments []model.Segment `json:"segments"`
+	UserID   int                   `json:"user_id"`
+	Segments []model.SegmentResult `json:"segments"`
 	Method   string
 }
 
 type UserSegmSaver interface {
-	SaveSegmToUser(int, []string) error
+	SaveSegmToUser(context.Context, int, []model.UserSegments) ([]model.SegmentResult, error)
 }
 
 func AddToUser(log *slog.Logger, userSegmSaver UserSegmSaver) http.HandlerFunc {
@@ -41,7 +44,7 @@ func AddToUser(log *slog.Logger, userSegmSaver UserSegmSaver) http.HandlerFunc {
 		if id == "" {
 			log.Info("id is empty")
 
-			render.JSON(w, r, response.Error("invalid request"))
+			response.Fail(w, r, http.StatusBadRequest, response.CodeInvalidRequest, "invalid request")
 
 			return
 		}
@@ -49,14 +52,16 @@ func AddToUser(log *slog.Logger, userSegmSaver UserSegmSaver) http.HandlerFunc {
 		if err != nil {
 			log.Info("id is not int")
 
-			render.JSON(w, r, response.Error("invalid id"))
+			response.Fail(w, r, http.StatusBadRequest, response.CodeInvalidRequest, "invalid id")
 
 			return
 		}
 
-		log = log.With(
+		log := log.With(
 			slog.String("op", op),
 			slog.String("request_id", middleware.GetReqID(r.Context())),
+			logger.Trace(r.Context()),
+			auth.Attr(r.Context()),
 		)
 
 		var req Request
@@ -65,7 +70,7 @@ func AddToUser(log *slog.Logger, userSegmSaver UserSegmSaver) http.HandlerFunc {
 		if err != nil {
 			log.Error("failed to decode request body", logger.Err(err))
 
-			render.JSON(w, r, response.Error("failed to decode request"))
+			response.Fail(w, r, http.StatusBadRequest, response.CodeInvalidRequest, "failed to decode request")
 
 			return
 		}
@@ -77,39 +82,50 @@ func AddToUser(log *slog.Logger, userSegmSaver UserSegmSaver) http.HandlerFunc {
 
 			log.Error("invalid request", logger.Err(err))
 
-			render.JSON(w, r, response.ValidationError(validateErr))
+			response.FailValidation(w, r, validateErr)
 
 			return
 		}
 
 		segms := req.Segments
-		segments := segmentsconv.SegmentsConv(segms)
+		segments, err := segmentsconv.UserSegmentsConv(user, segms, time.Now())
+		if err != nil {
+			log.Info("invalid segment expiration", logger.Err(err))
+
+			response.Fail(w, r, http.StatusUnprocessableEntity, response.CodeValidationFailed, err.Error())
 
-		err = userSegmSaver.SaveSegmToUser(user, segments)
-		if errors.Is(err, storage.ErrSegmentsNotExists) {
-			for _, v := range segments {
-				log.Info("segment not exists", slog.String("segment", v))
-			}
-			render.JSON(w, r, response.Error("segments not exists"))
+			return
+		}
+
+		results, err := userSegmSaver.SaveSegmToUser(r.Context(), user, segments)
+		if errors.Is(err, auth.ErrForbidden) {
+			log.Info("access denied", logger.Err(err))
+			response.Fail(w, r, http.StatusForbidden, response.CodeForbidden, "access to segment is denied")
 			return
 		}
 		if errors.Is(err, storage.ErrUserNotExists) {
 			log.Error("user not exists", logger.Err(err))
-			render.JSON(w, r, response.Error("user not exists"))
+			response.Fail(w, r, http.StatusNotFound, response.CodeUserNotFound, "user not exists")
 			return
 		}
 		if err != nil {
 			log.Error("failed to save segments for user", logger.Err(err))
-			render.JSON(w, r, response.Error("failed to save segments for user"))
+			response.Fail(w, r, http.StatusInternalServerError, response.CodeInternal, "failed to save segments for user")
 			return
 		}
 
+		for _, v := range results {
+			if v.Result == model.ResultUnknownSegment {
+				log.Info("segment not exists", slog.String("segment", v.Slug))
+			}
+		}
+
 		log.Info("segments added for user", slog.Int("user", user))
 
 		render.JSON(w, r, Response{
 			Response: response.OK(),
 			UserID:   user,
-			Segments: segms,
+			Segments: results,
 			Method:   r.Method,
 		})
 	}
@@ -1,13 +1,17 @@
 package adduser
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"net/http"
+	"strconv"
 
+	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
 	"github.com/go-chi/render"
 	"github.com/go-playground/validator/v10"
+	"github.com/m1al04949/avito-tech-service/internal/auth"
 	"github.com/m1al04949/avito-tech-service/internal/lib/response"
 	"github.com/m1al04949/avito-tech-service/internal/logger"
 	"github.com/m1al04949/avito-tech-service/internal/storage"
@@ -26,7 +30,7 @@ type Response struct {
 
 //go:generate go run github.com/vektra/mockery/v2 --name=UserSaver
 type UserSaver interface {
-	SaveUser(int) error
+	SaveUser(context.Context, int) error
 }
 
 func AddUser(log *slog.Logger, userSaver UserSaver) http.HandlerFunc {
@@ -34,49 +38,65 @@ func AddUser(log *slog.Logger, userSaver UserSaver) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		const op = "handlers.adduser"
 
-		log = log.With(
+		log := log.With(
 			slog.String("op", op),
 			slog.String("request_id", middleware.GetReqID(r.Context())),
+			logger.Trace(r.Context()),
+			auth.Attr(r.Context()),
 		)
 
 		var req Request
 
-		err := render.DecodeJSON(r.Body, &req)
-		if err != nil {
-			log.Error("failed to decode request body", logger.Err(err))
+		if id := chi.URLParam(r, "id"); id != "" {
+			user, err := strconv.Atoi(id)
+			if err != nil {
+				log.Info("id is not int")
 
-			render.JSON(w, r, response.Error("failed to decode request"))
+				response.Fail(w, r, http.StatusBadRequest, response.CodeInvalidRequest, "invalid id")
 
-			return
-		}
+				return
+			}
+			req.UserID = user
+		} else {
+			err := render.DecodeJSON(r.Body, &req)
+			if err != nil {
+				log.Error("failed to decode request body", logger.Err(err))
 
-		log.Info("request body decoded", slog.Any("request", req))
+				response.Fail(w, r, http.StatusBadRequest, response.CodeInvalidRequest, "failed to decode request")
 
-		if err := validator.New().Struct(req); err != nil {
-			validateErr := err.(validator.ValidationErrors)
+				return
+			}
 
-			log.Error("invalid request", logger.Err(err))
+			log.Info("request body decoded", slog.Any("request", req))
 
-			render.JSON(w, r, response.ValidationError(validateErr))
+			if err := validator.New().Struct(req); err != nil {
+				validateErr := err.(validator.ValidationErrors)
 
-			return
+				log.Error("invalid request", logger.Err(err))
+
+				response.FailValidation(w, r, validateErr)
+
+				return
+			}
 		}
 
 		user := req.UserID
 		if user == 0 {
 			err := fmt.Errorf("user_id is empty")
 			log.Error("user_id is empty", logger.Err(err))
-			render.JSON(w, r, response.Error("user_id is empty"))
+			response.Fail(w, r, http.StatusUnprocessableEntity, response.CodeValidationFailed, "user_id is empty")
 			return
 		}
 
-		err = userSaver.SaveUser(user)
+		err := userSaver.SaveUser(r.Context(), user)
 		if errors.Is(err, storage.ErrUserExists) {
 			log.Info("user already exists", slog.Int("user", user))
+			response.Fail(w, r, http.StatusConflict, response.CodeUserExists, "user already exists")
+			return
 		}
 		if err != nil {
 			log.Error("failed to save user", logger.Err(err))
-			render.JSON(w, r, response.Error("failed to save user"))
+			response.Fail(w, r, http.StatusInternalServerError, response.CodeInternal, "failed to save user")
 			return
 		}
 
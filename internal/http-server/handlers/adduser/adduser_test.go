@@ -11,6 +11,8 @@ import (
 
 	"github.com/m1al04949/avito-tech-service/internal/http-server/handlers/adduser"
 	"github.com/m1al04949/avito-tech-service/internal/http-server/handlers/adduser/mocks"
+	"github.com/m1al04949/avito-tech-service/internal/lib/response"
+	"github.com/m1al04949/avito-tech-service/internal/storage"
 	"github.com/m1al04949/avito-tech-service/pkg/slogdiscard"
 	"github.com/stretchr/testify/mock"
 	"github.com/stretchr/testify/require"
@@ -20,22 +22,45 @@ func TestAddUserHandler(t *testing.T) {
 	cases := []struct {
 		name      string
 		user      string
+		status    int
 		respError string
+		respCode  string
 		mockError error
 	}{
 		{
-			name: "Success",
-			user: "123",
+			name:   "Success",
+			user:   "123",
+			status: http.StatusOK,
 		},
 		{
 			name:      "Empty user",
-			user:      "",
+			user:      "0",
+			status:    http.StatusUnprocessableEntity,
 			respError: "user_id is empty",
+			respCode:  response.CodeValidationFailed,
 		},
 		{
 			name:      "Invalid USER",
 			user:      "someinvalidURL",
+			status:    http.StatusBadRequest,
+			respError: "failed to decode request",
+			respCode:  response.CodeInvalidRequest,
+		},
+		{
+			name:      "User exists",
+			user:      "123",
+			status:    http.StatusConflict,
+			respError: "user already exists",
+			respCode:  response.CodeUserExists,
+			mockError: storage.ErrUserExists,
+		},
+		{
+			name:      "Storage failure",
+			user:      "123",
+			status:    http.StatusInternalServerError,
 			respError: "failed to save user",
+			respCode:  response.CodeInternal,
+			mockError: fmt.Errorf("unexpected error"),
 		},
 	}
 
@@ -47,39 +72,75 @@ func TestAddUserHandler(t *testing.T) {
 
 			userSaverMock := mocks.NewUserSaver(t)
 
-			if tc.respError == "" || tc.mockError != nil {
-				userSaverMock.On("SaveUser", tc.user, mock.AnythingOfType("string")).
-					Return(int64(1), tc.mockError).
-					Once()
-			}
-
-			handler := adduser.AddUser(slogdiscard.NewDiscardLogger(), userSaverMock)
-
 			var input string
 			user, err := strconv.Atoi(tc.user)
 			if err != nil {
 				input = fmt.Sprintf(`{"user_id": "%s"}`, tc.user)
 			} else {
-				input = fmt.Sprintf(`{"user_id": "%d"}`, user)
+				input = fmt.Sprintf(`{"user_id": %d}`, user)
+			}
+
+			if tc.respError == "" || tc.mockError != nil {
+				userSaverMock.On("SaveUser", mock.Anything, user).
+					Return(tc.mockError).
+					Once()
 			}
 
+			handler := adduser.AddUser(slogdiscard.NewDiscardLogger(), userSaverMock)
+
 			req, err := http.NewRequest(http.MethodPost, "/users", bytes.NewReader([]byte(input)))
 			require.NoError(t, err)
 
 			rr := httptest.NewRecorder()
 			handler.ServeHTTP(rr, req)
 
-			require.Equal(t, rr.Code, http.StatusOK)
+			require.Equal(t, tc.status, rr.Code)
 
 			body := rr.Body.String()
 
-			var resp adduser.Response
+			if tc.respError == "" {
+				var resp adduser.Response
 
-			require.NoError(t, json.Unmarshal([]byte(body), &resp))
+				require.NoError(t, json.Unmarshal([]byte(body), &resp))
+
+				require.Equal(t, response.StatusOK, resp.Status)
+				require.Equal(t, user, resp.UserID)
+
+				return
+			}
 
-			require.Equal(t, tc.respError, resp.Error)
+			var resp response.Problem
 
-			// add more checks
+			require.NoError(t, json.Unmarshal([]byte(body), &resp))
+
+			require.Equal(t, response.ContentTypeProblem, rr.Header().Get("Content-Type"))
+			require.Equal(t, tc.respError, resp.Detail)
+			require.Equal(t, tc.respCode, resp.Code)
+			require.Equal(t, tc.status, resp.Status)
 		})
 	}
 }
+
+func TestAddUserHandlerLegacyErrors(t *testing.T) {
+	userSaverMock := mocks.NewUserSaver(t)
+	userSaverMock.On("SaveUser", mock.Anything, 123).
+		Return(storage.ErrUserExists).
+		Once()
+
+	handler := response.LegacyErrors(true)(adduser.AddUser(slogdiscard.NewDiscardLogger(), userSaverMock))
+
+	req, err := http.NewRequest(http.MethodPost, "/users", bytes.NewReader([]byte(`{"user_id": 123}`)))
+	require.NoError(t, err)
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+
+	require.Equal(t, http.StatusOK, rr.Code)
+
+	var resp response.Response
+
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &resp))
+
+	require.Equal(t, response.StatusError, resp.Status)
+	require.Equal(t, "user already exists", resp.Error)
+}
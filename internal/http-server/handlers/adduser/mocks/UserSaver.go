@@ -2,20 +2,24 @@
 
 package mocks
 
-import mock "github.com/stretchr/testify/mock"
+import (
+	context "context"
+
+	mock "github.com/stretchr/testify/mock"
+)
 
 // UserSaver is an autogenerated mock type for the UserSaver type
 type UserSaver struct {
 	mock.Mock
 }
 
-// SaveUser provides a mock function with given fields: _a0
-func (_m *UserSaver) SaveUser(_a0 int) error {
-	ret := _m.Called(_a0)
+// SaveUser provides a mock function with given fields: _a0, _a1
+func (_m *UserSaver) SaveUser(_a0 context.Context, _a1 int) error {
+	ret := _m.Called(_a0, _a1)
 
 	var r0 error
-	if rf, ok := ret.Get(0).(func(int) error); ok {
-		r0 = rf(_a0)
+	if rf, ok := ret.Get(0).(func(context.Context, int) error); ok {
+		r0 = rf(_a0, _a1)
 	} else {
 		r0 = ret.Error(0)
 	}
@@ -1,6 +1,7 @@
 package createsegment
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"net/http"
@@ -8,6 +9,7 @@ import (
 	"github.com/go-chi/chi/v5/middleware"
 	"github.com/go-chi/render"
 	"github.com/go-playground/validator/v10"
+	"github.com/m1al04949/avito-tech-service/internal/auth"
 	"github.com/m1al04949/avito-tech-service/internal/lib/response"
 	"github.com/m1al04949/avito-tech-service/internal/logger"
 	"github.com/m1al04949/avito-tech-service/internal/storage"
@@ -15,17 +17,19 @@ import (
 )
 
 type Request struct {
-	Slug string `json:"slug"`
+	Slug        string `json:"slug"`
+	AutoPercent int    `json:"auto_percent,omitempty" validate:"min=0,max=100"`
 }
 
 type Response struct {
 	response.Response
-	Segment string `json:"slug,omitempty"`
-	Method  string
+	Segment     string `json:"slug,omitempty"`
+	AutoPercent int    `json:"auto_percent,omitempty"`
+	Method      string
 }
 
 type SegmSaver interface {
-	SaveSegm(segmToSave string) error
+	SaveSegm(ctx context.Context, segmToSave string, autoPercent int) error
 }
 
 func NewSegment(log *slog.Logger, segmSaver SegmSaver) http.HandlerFunc {
@@ -33,9 +37,11 @@ func NewSegment(log *slog.Logger, segmSaver SegmSaver) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		const op = "handlers.createsegment"
 
-		log = log.With(
+		log := log.With(
 			slog.String("op", op),
 			slog.String("request_id", middleware.GetReqID(r.Context())),
+			logger.Trace(r.Context()),
+			auth.Attr(r.Context()),
 		)
 
 		var req Request
@@ -44,7 +50,7 @@ func NewSegment(log *slog.Logger, segmSaver SegmSaver) http.HandlerFunc {
 		if err != nil {
 			log.Error("failed to decode request body", logger.Err(err))
 
-			render.JSON(w, r, response.Error("failed to decode request"))
+			response.Fail(w, r, http.StatusBadRequest, response.CodeInvalidRequest, "failed to decode request")
 
 			return
 		}
@@ -56,7 +62,7 @@ func NewSegment(log *slog.Logger, segmSaver SegmSaver) http.HandlerFunc {
 
 			log.Error("invalid request", logger.Err(err))
 
-			render.JSON(w, r, response.ValidationError(validateErr))
+			response.FailValidation(w, r, validateErr)
 
 			return
 		}
@@ -65,33 +71,41 @@ func NewSegment(log *slog.Logger, segmSaver SegmSaver) http.HandlerFunc {
 		if segment == "" {
 			err := fmt.Errorf("segment name (slug) is empty")
 			log.Error("segment name (slug) is empty", logger.Err(err))
-			render.JSON(w, r, response.Error("segment name (slug) is empty"))
+			response.Fail(w, r, http.StatusUnprocessableEntity, response.CodeValidationFailed, "segment name (slug) is empty")
 			return
 		}
 
-		err = segmSaver.SaveSegm(segment)
+		err = segmSaver.SaveSegm(r.Context(), segment, req.AutoPercent)
 
+		if errors.Is(err, auth.ErrForbidden) {
+			log.Info("access denied", logger.Err(err))
+
+			response.Fail(w, r, http.StatusForbidden, response.CodeForbidden, "access to segment is denied")
+
+			return
+		}
 		if errors.Is(err, storage.ErrSegmentExists) {
 			log.Info("segment already exists", slog.String("segment", req.Slug))
 
-			render.JSON(w, r, response.Error("segment already exists"))
+			response.Fail(w, r, http.StatusConflict, response.CodeSegmentExists, "segment already exists")
 
 			return
 		}
 		if err != nil {
 			log.Error("failed to add segment", logger.Err(err))
 
-			render.JSON(w, r, response.Error("failed to add segment"))
+			response.Fail(w, r, http.StatusInternalServerError, response.CodeInternal, "failed to add segment")
 
 			return
 		}
 
-		log.Info("segment added", slog.String("segment", segment))
+		log.Info("segment added", slog.String("segment", segment), slog.Int("auto_percent", req.AutoPercent))
 
 		render.JSON(w, r, Response{
-			Response: response.OK(),
-			Segment:  segment,
-			Method:   r.Method,
+			Response:    response.OK(),
+			Segment:     segment,
+			AutoPercent: req.AutoPercent,
+			Method:      r.Method,
 		})
 	}
 }
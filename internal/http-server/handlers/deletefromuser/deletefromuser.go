@@ -1,6 +1,7 @@
 package deletefromuser
 
 import (
+	"context"
 	"errors"
 	"net/http"
 	"strconv"
@@ -9,6 +10,7 @@ import (
 	"github.com/go-chi/chi/v5/middleware"
 	"github.com/go-chi/render"
 	"github.com/go-playground/validator/v10"
+	"github.com/m1al04949/avito-tech-service/internal/auth"
 	"github.com/m1al04949/avito-tech-service/internal/lib/response"
 	"github.com/m1al04949/avito-tech-service/internal/lib/response/segmentsconv"
 	"github.com/m1al04949/avito-tech-service/internal/logger"
@@ -23,13 +25,13 @@ type Request struct {
 
 type Response struct {
 	response.Response
-	UserID   int             `json:"user_id"`
-	Segments []model.Segment `json:"segments"`
+	UserID   int                   `json:"user_id"`
+	Segments []model.SegmentResult `json:"segments"`
 	Method   string
 }
 
 type UserSegmDeleter interface {
-	DeleteSegmFromUser(int, []string) error
+	DeleteSegmFromUser(context.Context, int, []string) ([]model.SegmentResult, error)
 }
 
 func DeleteFromUser(log *slog.Logger, userSegmDeleter UserSegmDeleter) http.HandlerFunc {
@@ -41,7 +43,7 @@ func DeleteFromUser(log *slog.Logger, userSegmDeleter UserSegmDeleter) http.Hand
 		if id == "" {
 			log.Info("id is empty")
 
-			render.JSON(w, r, response.Error("invalid request"))
+			response.Fail(w, r, http.StatusBadRequest, response.CodeInvalidRequest, "invalid request")
 
 			return
 		}
@@ -49,67 +51,80 @@ func DeleteFromUser(log *slog.Logger, userSegmDeleter UserSegmDeleter) http.Hand
 		if err != nil {
 			log.Info("id is not int")
 
-			render.JSON(w, r, response.Error("invalid id"))
+			response.Fail(w, r, http.StatusBadRequest, response.CodeInvalidRequest, "invalid id")
 
 			return
 		}
 
-		log = log.With(
+		log := log.With(
 			slog.String("op", op),
 			slog.String("request_id", middleware.GetReqID(r.Context())),
+			logger.Trace(r.Context()),
+			auth.Attr(r.Context()),
 		)
 
 		var req Request
 
-		err = render.DecodeJSON(r.Body, &req)
-		if err != nil {
-			log.Error("failed to decode request body", logger.Err(err))
+		// Segments may be passed as ?slug= query parameters instead of request body
+		if slugs := r.URL.Query()["slug"]; len(slugs) > 0 {
+			for _, v := range slugs {
+				req.Segments = append(req.Segments, model.Segment{Slug: v})
+			}
+		} else {
+			err := render.DecodeJSON(r.Body, &req)
+			if err != nil {
+				log.Error("failed to decode request body", logger.Err(err))
 
-			render.JSON(w, r, response.Error("failed to decode request"))
+				response.Fail(w, r, http.StatusBadRequest, response.CodeInvalidRequest, "failed to decode request")
 
-			return
-		}
+				return
+			}
 
-		log.Info("request body decoded", slog.Any("request", req))
+			log.Info("request body decoded", slog.Any("request", req))
 
-		if err := validator.New().Struct(req); err != nil {
-			validateErr := err.(validator.ValidationErrors)
+			if err := validator.New().Struct(req); err != nil {
+				validateErr := err.(validator.ValidationErrors)
 
-			log.Error("invalid request", logger.Err(err))
+				log.Error("invalid request", logger.Err(err))
 
-			render.JSON(w, r, response.ValidationError(validateErr))
+				response.FailValidation(w, r, validateErr)
 
-			return
+				return
+			}
 		}
 
 		segms := req.Segments
 		segments := segmentsconv.SegmentsConv(segms)
 
-		err = userSegmDeleter.DeleteSegmFromUser(user, segments)
-		if errors.Is(err, storage.ErrSegmentsNotExists) {
-			for _, v := range segments {
-				log.Info("segment not exists", slog.String("segment", v))
-			}
-			render.JSON(w, r, response.Error("segments not exists"))
+		results, err := userSegmDeleter.DeleteSegmFromUser(r.Context(), user, segments)
+		if errors.Is(err, auth.ErrForbidden) {
+			log.Info("access denied", logger.Err(err))
+			response.Fail(w, r, http.StatusForbidden, response.CodeForbidden, "access to segment is denied")
 			return
 		}
 		if errors.Is(err, storage.ErrUserNotExists) {
 			log.Error("user not exists", logger.Err(err))
-			render.JSON(w, r, response.Error("user not exists"))
+			response.Fail(w, r, http.StatusNotFound, response.CodeUserNotFound, "user not exists")
 			return
 		}
 		if err != nil {
 			log.Error("failed to delete segments from user", logger.Err(err))
-			render.JSON(w, r, response.Error("failed to delete segments from user"))
+			response.Fail(w, r, http.StatusInternalServerError, response.CodeInternal, "failed to delete segments from user")
 			return
 		}
 
+		for _, v := range results {
+			if v.Result == model.ResultUnknownSegment {
+				log.Info("segment not exists", slog.String("segment", v.Slug))
+			}
+		}
+
 		log.Info("segments deleted from user", slog.Int("user", user))
 
 		render.JSON(w, r, Response{
 			Response: response.OK(),
 			UserID:   user,
-			Segments: segms,
+			Segments: results,
 			Method:   r.Method,
 		})
 	}
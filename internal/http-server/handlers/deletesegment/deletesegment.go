@@ -1,12 +1,15 @@
 package deletesegment
 
 import (
+	"context"
 	"errors"
 	"net/http"
 
+	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
 	"github.com/go-chi/render"
 	"github.com/go-playground/validator/v10"
+	"github.com/m1al04949/avito-tech-service/internal/auth"
 	"github.com/m1al04949/avito-tech-service/internal/lib/response"
 	"github.com/m1al04949/avito-tech-service/internal/logger"
 	"github.com/m1al04949/avito-tech-service/internal/storage"
@@ -24,7 +27,7 @@ type Response struct {
 }
 
 type SegmDeleter interface {
-	DeleteSegm(string) error
+	DeleteSegm(context.Context, string) error
 }
 
 func DelSegment(log *slog.Logger, segmDeleter SegmDeleter) http.HandlerFunc {
@@ -32,56 +35,69 @@ func DelSegment(log *slog.Logger, segmDeleter SegmDeleter) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		const op = "handlers.deletesegment"
 
-		log = log.With(
+		log := log.With(
 			slog.String("op", op),
 			slog.String("request_id", middleware.GetReqID(r.Context())),
+			logger.Trace(r.Context()),
+			auth.Attr(r.Context()),
 		)
 
 		var req Request
 
-		err := render.DecodeJSON(r.Body, &req)
-		if err != nil {
-			log.Error("failed to decode request body", logger.Err(err))
+		if slug := chi.URLParam(r, "slug"); slug != "" {
+			req.Slug = slug
+		} else {
+			err := render.DecodeJSON(r.Body, &req)
+			if err != nil {
+				log.Error("failed to decode request body", logger.Err(err))
 
-			render.JSON(w, r, response.Error("failed to decode request"))
+				response.Fail(w, r, http.StatusBadRequest, response.CodeInvalidRequest, "failed to decode request")
 
-			return
-		}
+				return
+			}
 
-		log.Info("request body decoded", slog.Any("request", req))
+			log.Info("request body decoded", slog.Any("request", req))
 
-		if err := validator.New().Struct(req); err != nil {
-			validateErr := err.(validator.ValidationErrors)
+			if err := validator.New().Struct(req); err != nil {
+				validateErr := err.(validator.ValidationErrors)
 
-			log.Error("invalid request", logger.Err(err))
+				log.Error("invalid request", logger.Err(err))
 
-			render.JSON(w, r, response.ValidationError(validateErr))
+				response.FailValidation(w, r, validateErr)
 
-			return
+				return
+			}
 		}
 
 		segment := req.Slug
 
-		err = segmDeleter.DeleteSegm(segment)
+		err := segmDeleter.DeleteSegm(r.Context(), segment)
 
+		if errors.Is(err, auth.ErrForbidden) {
+			log.Info("access denied", logger.Err(err))
+
+			response.Fail(w, r, http.StatusForbidden, response.CodeForbidden, "access to segment is denied")
+
+			return
+		}
 		if errors.Is(err, storage.ErrSegmentNotExists) {
 			log.Info("segment not exists", slog.String("segment", req.Slug))
 
-			render.JSON(w, r, response.Error("segment not exists"))
+			response.Fail(w, r, http.StatusNotFound, response.CodeSegmentNotFound, "segment not exists")
 
 			return
 		}
 		if errors.Is(err, storage.ErrSegmentDelete) {
 			log.Info("delete segment from user segments table", slog.String("segment", segment))
 
-			render.JSON(w, r, response.Error("delete segment from user segments table"))
+			response.Fail(w, r, http.StatusConflict, response.CodeSegmentInUse, "delete segment from user segments table")
 
 			return
 		}
 		if err != nil {
 			log.Error("failed to delete segment", logger.Err(err))
 
-			render.JSON(w, r, response.Error("failed to delete segment"))
+			response.Fail(w, r, http.StatusInternalServerError, response.CodeInternal, "failed to delete segment")
 
 			return
 		}
@@ -1,12 +1,16 @@
 package deleteuser
 
 import (
+	"context"
 	"errors"
 	"net/http"
+	"strconv"
 
+	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
 	"github.com/go-chi/render"
 	"github.com/go-playground/validator/v10"
+	"github.com/m1al04949/avito-tech-service/internal/auth"
 	"github.com/m1al04949/avito-tech-service/internal/lib/response"
 	"github.com/m1al04949/avito-tech-service/internal/logger"
 	"github.com/m1al04949/avito-tech-service/internal/storage"
@@ -24,7 +28,7 @@ type Response struct {
 }
 
 type UserDeleter interface {
-	DeleteUser(int) error
+	DeleteUser(context.Context, int) error
 }
 
 func DeleteUser(log *slog.Logger, userDeleter UserDeleter) http.HandlerFunc {
@@ -32,55 +36,76 @@ func DeleteUser(log *slog.Logger, userDeleter UserDeleter) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		const op = "handlers.deleteuser"
 
-		log = log.With(
+		log := log.With(
 			slog.String("op", op),
 			slog.String("request_id", middleware.GetReqID(r.Context())),
+			logger.Trace(r.Context()),
+			auth.Attr(r.Context()),
 		)
 
 		var req Request
 
-		err := render.DecodeJSON(r.Body, &req)
-		if err != nil {
-			log.Error("failed to decode request body", logger.Err(err))
+		if id := chi.URLParam(r, "id"); id != "" {
+			user, err := strconv.Atoi(id)
+			if err != nil {
+				log.Info("id is not int")
 
-			render.JSON(w, r, response.Error("failed to decode request"))
+				response.Fail(w, r, http.StatusBadRequest, response.CodeInvalidRequest, "invalid id")
 
-			return
-		}
+				return
+			}
+			req.UserID = user
+		} else {
+			err := render.DecodeJSON(r.Body, &req)
+			if err != nil {
+				log.Error("failed to decode request body", logger.Err(err))
 
-		log.Info("request body decoded", slog.Any("request", req))
+				response.Fail(w, r, http.StatusBadRequest, response.CodeInvalidRequest, "failed to decode request")
 
-		if err := validator.New().Struct(req); err != nil {
-			validateErr := err.(validator.ValidationErrors)
+				return
+			}
 
-			log.Error("invalid request", logger.Err(err))
+			log.Info("request body decoded", slog.Any("request", req))
 
-			render.JSON(w, r, response.ValidationError(validateErr))
+			if err := validator.New().Struct(req); err != nil {
+				validateErr := err.(validator.ValidationErrors)
 
-			return
+				log.Error("invalid request", logger.Err(err))
+
+				response.FailValidation(w, r, validateErr)
+
+				return
+			}
 		}
 
 		user := req.UserID
-		err = userDeleter.DeleteUser(user)
+		err := userDeleter.DeleteUser(r.Context(), user)
+
+		if errors.Is(err, auth.ErrForbidden) {
+			log.Info("access denied", logger.Err(err))
+
+			response.Fail(w, r, http.StatusForbidden, response.CodeForbidden, "access to segments of user is denied")
 
+			return
+		}
 		if errors.Is(err, storage.ErrUserNotExists) {
 			log.Info("user not exists", slog.Int("user", user))
 
-			render.JSON(w, r, response.Error("user not exists"))
+			response.Fail(w, r, http.StatusNotFound, response.CodeUserNotFound, "user not exists")
 
 			return
 		}
 		if errors.Is(err, storage.ErrUserDelete) {
 			log.Info("delete user from user segments table", slog.Int("user", user))
 
-			render.JSON(w, r, response.Error("delete user from user segments table"))
+			response.Fail(w, r, http.StatusConflict, response.CodeUserInUse, "delete user from user segments table")
 
 			return
 		}
 		if err != nil {
 			log.Error("failed to delete user", logger.Err(err))
 
-			render.JSON(w, r, response.Error("failed to delete user"))
+			response.Fail(w, r, http.StatusInternalServerError, response.CodeInternal, "failed to delete user")
 
 			return
 		}
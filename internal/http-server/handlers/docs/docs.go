@@ -0,0 +1,51 @@
+package docs
+
+import (
+	"embed"
+	"io/fs"
+	"net/http"
+)
+
+//go:embed openapi.json
+var spec []byte
+
+//go:embed swagger.html
+var swaggerUI []byte
+
+// Swagger UI is vendored, so documentation works without access to CDN
+//
+//go:embed swagger-ui/swagger-ui.css swagger-ui/swagger-ui-bundle.js
+var swaggerUIAssets embed.FS
+
+// Spec returns OpenAPI document describing service API
+func Spec() []byte {
+	return spec
+}
+
+// OpenAPI serves OpenAPI document
+func OpenAPI() http.HandlerFunc {
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(spec) //nolint:errcheck
+	}
+}
+
+// SwaggerUI serves Swagger UI page rendering OpenAPI document
+func SwaggerUI() http.HandlerFunc {
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Write(swaggerUI) //nolint:errcheck
+	}
+}
+
+// SwaggerUIAssets serves scripts and styles of Swagger UI page under /docs/
+func SwaggerUIAssets() http.Handler {
+	assets, err := fs.Sub(swaggerUIAssets, "swagger-ui")
+	if err != nil {
+		panic(err)
+	}
+
+	return http.StripPrefix("/docs/", http.FileServer(http.FS(assets)))
+}
@@ -0,0 +1,94 @@
+package gethistory
+
+import (
+	"context"
+	"encoding/csv"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/m1al04949/avito-tech-service/internal/auth"
+	"github.com/m1al04949/avito-tech-service/internal/lib/response"
+	"github.com/m1al04949/avito-tech-service/internal/logger"
+	"github.com/m1al04949/avito-tech-service/internal/model"
+	"golang.org/x/exp/slog"
+)
+
+const (
+	periodLayout   = "2006-01"
+	datetimeLayout = "2006-01-02 15:04:05"
+)
+
+//go:generate go run github.com/vektra/mockery/v2 --name=HistoryGetter
+type HistoryGetter interface {
+	GetHistory(ctx context.Context, from, to time.Time) ([]model.UserSegmentsHistory, error)
+}
+
+func GetHistory(log *slog.Logger, historyGetter HistoryGetter) http.HandlerFunc {
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "handlers.gethistory"
+
+		log := log.With(
+			slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+			logger.Trace(r.Context()),
+			auth.Attr(r.Context()),
+		)
+
+		period := r.URL.Query().Get("period")
+		if period == "" {
+			log.Info("period is empty")
+
+			response.Fail(w, r, http.StatusBadRequest, response.CodeInvalidRequest, "period is empty")
+
+			return
+		}
+		from, err := time.Parse(periodLayout, period)
+		if err != nil {
+			log.Info("invalid period", slog.String("period", period))
+
+			response.Fail(w, r, http.StatusBadRequest, response.CodeInvalidRequest, "invalid period, expected YYYY-MM")
+
+			return
+		}
+		to := from.AddDate(0, 1, 0)
+
+		history, err := historyGetter.GetHistory(r.Context(), from, to)
+		if err != nil {
+			log.Error("failed to get history", logger.Err(err))
+
+			response.Fail(w, r, http.StatusInternalServerError, response.CodeInternal, "failed to get history")
+
+			return
+		}
+
+		log.Info("history is getted", slog.String("period", period), slog.Int("records", len(history)))
+
+		w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+		w.Header().Set("Content-Disposition",
+			fmt.Sprintf("attachment; filename=\"history_%s.csv\"", period))
+
+		cw := csv.NewWriter(w)
+		cw.Comma = ';'
+
+		for _, h := range history {
+			if err := cw.Write([]string{
+				strconv.Itoa(h.UserID),
+				h.SegmentName,
+				h.Operation,
+				h.CreatedAt.Format(datetimeLayout),
+			}); err != nil {
+				log.Error("failed to write history", logger.Err(err))
+				return
+			}
+		}
+
+		cw.Flush()
+		if err := cw.Error(); err != nil {
+			log.Error("failed to write history", logger.Err(err))
+		}
+	}
+}
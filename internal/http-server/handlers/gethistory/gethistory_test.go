@@ -0,0 +1,153 @@
+package gethistory_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/m1al04949/avito-tech-service/internal/http-server/handlers/gethistory"
+	"github.com/m1al04949/avito-tech-service/internal/http-server/handlers/gethistory/mocks"
+	"github.com/m1al04949/avito-tech-service/internal/lib/response"
+	"github.com/m1al04949/avito-tech-service/internal/model"
+	"github.com/m1al04949/avito-tech-service/pkg/slogdiscard"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetHistoryHandler(t *testing.T) {
+	august := time.Date(2023, time.August, 1, 0, 0, 0, 0, time.UTC)
+	december := time.Date(2023, time.December, 1, 0, 0, 0, 0, time.UTC)
+
+	cases := []struct {
+		name      string
+		period    string
+		from, to  time.Time
+		history   []model.UserSegmentsHistory
+		status    int
+		respBody  string
+		respError string
+		respCode  string
+		mockError error
+	}{
+		{
+			name:   "Success",
+			period: "2023-08",
+			from:   august,
+			to:     august.AddDate(0, 1, 0),
+			history: []model.UserSegmentsHistory{
+				{UserID: 1000, SegmentName: "AVITO_VOICE", Operation: model.OperationAdd,
+					CreatedAt: time.Date(2023, time.August, 5, 10, 30, 0, 0, time.UTC)},
+				{UserID: 1000, SegmentName: "AVITO_VOICE", Operation: model.OperationRemove,
+					CreatedAt: time.Date(2023, time.August, 31, 23, 59, 59, 0, time.UTC)},
+			},
+			status: http.StatusOK,
+			respBody: "1000;AVITO_VOICE;add;2023-08-05 10:30:00\n" +
+				"1000;AVITO_VOICE;remove;2023-08-31 23:59:59\n",
+		},
+		{
+			name:   "Period ends with year",
+			period: "2023-12",
+			from:   december,
+			to:     time.Date(2024, time.January, 1, 0, 0, 0, 0, time.UTC),
+			status: http.StatusOK,
+		},
+		{
+			name:   "Empty month",
+			period: "2023-08",
+			from:   august,
+			to:     august.AddDate(0, 1, 0),
+			status: http.StatusOK,
+		},
+		{
+			name:      "Empty period",
+			status:    http.StatusBadRequest,
+			respError: "period is empty",
+			respCode:  response.CodeInvalidRequest,
+		},
+		{
+			name:      "Invalid month",
+			period:    "2023-13",
+			status:    http.StatusBadRequest,
+			respError: "invalid period, expected YYYY-MM",
+			respCode:  response.CodeInvalidRequest,
+		},
+		{
+			name:      "Month without leading zero",
+			period:    "2023-8",
+			status:    http.StatusBadRequest,
+			respError: "invalid period, expected YYYY-MM",
+			respCode:  response.CodeInvalidRequest,
+		},
+		{
+			name:      "Invalid year",
+			period:    "23-08",
+			status:    http.StatusBadRequest,
+			respError: "invalid period, expected YYYY-MM",
+			respCode:  response.CodeInvalidRequest,
+		},
+		{
+			name:      "Date instead of period",
+			period:    "2023-08-01",
+			status:    http.StatusBadRequest,
+			respError: "invalid period, expected YYYY-MM",
+			respCode:  response.CodeInvalidRequest,
+		},
+		{
+			name:      "Storage failure",
+			period:    "2023-08",
+			from:      august,
+			to:        august.AddDate(0, 1, 0),
+			status:    http.StatusInternalServerError,
+			respError: "failed to get history",
+			respCode:  response.CodeInternal,
+			mockError: fmt.Errorf("unexpected error"),
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			historyGetterMock := mocks.NewHistoryGetter(t)
+
+			if tc.respError == "" || tc.mockError != nil {
+				historyGetterMock.On("GetHistory", mock.Anything, tc.from, tc.to).
+					Return(tc.history, tc.mockError).
+					Once()
+			}
+
+			handler := gethistory.GetHistory(slogdiscard.NewDiscardLogger(), historyGetterMock)
+
+			req, err := http.NewRequest(http.MethodGet, "/reports/history?period="+tc.period, nil)
+			require.NoError(t, err)
+
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+
+			require.Equal(t, tc.status, rr.Code)
+
+			if tc.respError == "" {
+				require.Equal(t, "text/csv; charset=utf-8", rr.Header().Get("Content-Type"))
+				require.Equal(t, fmt.Sprintf("attachment; filename=\"history_%s.csv\"", tc.period),
+					rr.Header().Get("Content-Disposition"))
+				require.Equal(t, tc.respBody, rr.Body.String())
+
+				return
+			}
+
+			var resp response.Problem
+
+			require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &resp))
+
+			require.Equal(t, response.ContentTypeProblem, rr.Header().Get("Content-Type"))
+			require.Equal(t, tc.respError, resp.Detail)
+			require.Equal(t, tc.respCode, resp.Code)
+			require.Equal(t, tc.status, resp.Status)
+		})
+	}
+}
@@ -0,0 +1,81 @@
+package getsegment
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/go-chi/render"
+	"github.com/m1al04949/avito-tech-service/internal/auth"
+	"github.com/m1al04949/avito-tech-service/internal/lib/response"
+	"github.com/m1al04949/avito-tech-service/internal/logger"
+	"github.com/m1al04949/avito-tech-service/internal/model"
+	"github.com/m1al04949/avito-tech-service/internal/storage"
+	"golang.org/x/exp/slog"
+)
+
+type Response struct {
+	response.Response
+	model.Segments
+	Method string
+}
+
+type SegmGetter interface {
+	GetSegm(context.Context, string) (model.Segments, error)
+}
+
+func GetSegment(log *slog.Logger, segmGetter SegmGetter) http.HandlerFunc {
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "handlers.getsegment"
+
+		log := log.With(
+			slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+			logger.Trace(r.Context()),
+			auth.Attr(r.Context()),
+		)
+
+		segment := chi.URLParam(r, "slug")
+		if segment == "" {
+			log.Info("slug is empty")
+
+			response.Fail(w, r, http.StatusBadRequest, response.CodeInvalidRequest, "invalid request")
+
+			return
+		}
+
+		segm, err := segmGetter.GetSegm(r.Context(), segment)
+		if errors.Is(err, auth.ErrForbidden) {
+			log.Info("access denied", logger.Err(err))
+
+			response.Fail(w, r, http.StatusForbidden, response.CodeForbidden, "access to segment is denied")
+
+			return
+		}
+		if errors.Is(err, storage.ErrSegmentNotExists) {
+			log.Info("segment not exists", slog.String("segment", segment))
+
+			response.Fail(w, r, http.StatusNotFound, response.CodeSegmentNotFound, "segment not exists")
+
+			return
+		}
+		if err != nil {
+			log.Error("failed to get segment", logger.Err(err))
+
+			response.Fail(w, r, http.StatusInternalServerError, response.CodeInternal, "failed to get segment")
+
+			return
+		}
+
+		log.Info("segment is getted", slog.String("segment", segment))
+
+		render.JSON(w, r, Response{
+			Response: response.OK(),
+			Segments: segm,
+			Method:   r.Method,
+		})
+	}
+}
@@ -0,0 +1,286 @@
+package getsegmentusers
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/go-chi/render"
+	"github.com/m1al04949/avito-tech-service/internal/auth"
+	"github.com/m1al04949/avito-tech-service/internal/lib/cursor"
+	"github.com/m1al04949/avito-tech-service/internal/lib/response"
+	"github.com/m1al04949/avito-tech-service/internal/logger"
+	"github.com/m1al04949/avito-tech-service/internal/storage"
+	"golang.org/x/exp/slog"
+)
+
+const (
+	defaultLimit = 100
+	maxLimit     = 10000
+
+	formatNDJSON = "ndjson"
+	formatCSV    = "csv"
+
+	contentTypeNDJSON = "application/x-ndjson"
+	contentTypeCSV    = "text/csv"
+
+	// Rows written between flushes of streaming export
+	flushEvery = 1000
+)
+
+type Response struct {
+	response.Response
+	Segment    string `json:"slug"`
+	Users      []int  `json:"users"`
+	NextCursor string `json:"next_cursor,omitempty"`
+	Method     string
+}
+
+//go:generate go run github.com/vektra/mockery/v2 --name=SegmUsersGetter
+type SegmUsersGetter interface {
+	GetSegmUsers(ctx context.Context, segment string, after, limit int) ([]int, error)
+	StreamSegmUsers(ctx context.Context, segment string, fn func(user int) error) error
+}
+
+// Position of the last user on the page
+type pageCursor struct {
+	After int `json:"after"`
+}
+
+func GetSegmentUsers(log *slog.Logger, segmUsersGetter SegmUsersGetter) http.HandlerFunc {
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "handlers.getsegmentusers"
+
+		log := log.With(
+			slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+			logger.Trace(r.Context()),
+			auth.Attr(r.Context()),
+		)
+
+		segment := chi.URLParam(r, "slug")
+		if segment == "" {
+			log.Info("slug is empty")
+
+			response.Fail(w, r, http.StatusBadRequest, response.CodeInvalidRequest, "invalid request")
+
+			return
+		}
+
+		format, err := exportFormat(r)
+		if err != nil {
+			log.Info("invalid format", logger.Err(err))
+
+			response.Fail(w, r, http.StatusBadRequest, response.CodeInvalidRequest, err.Error())
+
+			return
+		}
+		if format != "" {
+			streamUsers(log, w, r, segmUsersGetter, segment, format)
+			return
+		}
+
+		limit := defaultLimit
+		if l := r.URL.Query().Get("limit"); l != "" {
+			var err error
+			limit, err = strconv.Atoi(l)
+			if err != nil || limit < 1 || limit > maxLimit {
+				log.Info("invalid limit", slog.String("limit", l))
+
+				response.Fail(w, r, http.StatusBadRequest, response.CodeInvalidRequest,
+					fmt.Sprintf("limit must be between 1 and %d", maxLimit))
+
+				return
+			}
+		}
+
+		var pc pageCursor
+		if c := r.URL.Query().Get("cursor"); c != "" {
+			err := cursor.Decode(c, &pc)
+			if err == nil && pc.After < 0 {
+				err = fmt.Errorf("negative position %d", pc.After)
+			}
+			if err != nil {
+				log.Info("invalid cursor", logger.Err(err))
+
+				response.Fail(w, r, http.StatusBadRequest, response.CodeInvalidRequest, "invalid cursor")
+
+				return
+			}
+		}
+
+		users, err := segmUsersGetter.GetSegmUsers(r.Context(), segment, pc.After, limit+1)
+		if errors.Is(err, auth.ErrForbidden) {
+			log.Info("access denied", logger.Err(err))
+
+			response.Fail(w, r, http.StatusForbidden, response.CodeForbidden, "access to segment is denied")
+
+			return
+		}
+		if errors.Is(err, storage.ErrSegmentNotExists) {
+			log.Info("segment not exists", slog.String("segment", segment))
+
+			response.Fail(w, r, http.StatusNotFound, response.CodeSegmentNotFound, "segment not exists")
+
+			return
+		}
+		if err != nil {
+			log.Error("failed to get segment users", logger.Err(err))
+
+			response.Fail(w, r, http.StatusInternalServerError, response.CodeInternal, "failed to get segment users")
+
+			return
+		}
+
+		var next string
+		if len(users) > limit {
+			users = users[:limit]
+			next, err = cursor.Encode(pageCursor{After: users[limit-1]})
+			if err != nil {
+				log.Error("failed to make cursor", logger.Err(err))
+
+				response.Fail(w, r, http.StatusInternalServerError, response.CodeInternal, "failed to get segment users")
+
+				return
+			}
+		}
+
+		log.Info("segment users are getted", slog.String("segment", segment), slog.Int("users", len(users)))
+
+		render.JSON(w, r, Response{
+			Response:   response.OK(),
+			Segment:    segment,
+			Users:      users,
+			NextCursor: next,
+			Method:     r.Method,
+		})
+	}
+}
+
+// Pick export format from format parameter, or else from Accept header.
+// Empty format means a page of users as JSON
+func exportFormat(r *http.Request) (string, error) {
+	switch format := r.URL.Query().Get("format"); format {
+	case "":
+	case formatNDJSON, formatCSV:
+		return format, nil
+	default:
+		return "", errors.New("format must be ndjson or csv")
+	}
+
+	for _, accept := range strings.Split(r.Header.Get("Accept"), ",") {
+		mediaType, _, _ := strings.Cut(accept, ";")
+
+		switch strings.TrimSpace(mediaType) {
+		case contentTypeNDJSON:
+			return formatNDJSON, nil
+		case contentTypeCSV:
+			return formatCSV, nil
+		case "application/json", "*/*":
+			return "", nil
+		}
+	}
+
+	return "", nil
+}
+
+// Write all users of segment as NDJSON or CSV, flushing them to client as they are read
+func streamUsers(log *slog.Logger, w http.ResponseWriter, r *http.Request,
+	segmUsersGetter SegmUsersGetter, segment, format string) {
+
+	rc := http.NewResponseController(w)
+
+	// Export of large segment outlives server write timeout
+	if err := rc.SetWriteDeadline(time.Time{}); err != nil {
+		log.Info("write deadline is not extended", logger.Err(err))
+	}
+
+	var (
+		rows int
+		enc  = json.NewEncoder(w)
+		cw   = csv.NewWriter(w)
+	)
+
+	writeHeader := func() {
+		if format == formatCSV {
+			w.Header().Set("Content-Type", contentTypeCSV+"; charset=utf-8")
+			w.Header().Set("Content-Disposition",
+				fmt.Sprintf("attachment; filename=\"segment_%s_users.csv\"", segment))
+		} else {
+			w.Header().Set("Content-Type", contentTypeNDJSON)
+		}
+		w.WriteHeader(http.StatusOK)
+	}
+
+	err := segmUsersGetter.StreamSegmUsers(r.Context(), segment, func(user int) error {
+		if rows == 0 {
+			writeHeader()
+		}
+		rows++
+
+		if format == formatCSV {
+			if err := cw.Write([]string{strconv.Itoa(user)}); err != nil {
+				return err
+			}
+		} else {
+			if err := enc.Encode(struct {
+				UserID int `json:"user_id"`
+			}{user}); err != nil {
+				return err
+			}
+		}
+
+		if rows%flushEvery == 0 {
+			cw.Flush()
+			if err := cw.Error(); err != nil {
+				return err
+			}
+			return rc.Flush()
+		}
+
+		return nil
+	})
+	if errors.Is(err, auth.ErrForbidden) {
+		log.Info("access denied", logger.Err(err))
+
+		response.Fail(w, r, http.StatusForbidden, response.CodeForbidden, "access to segment is denied")
+
+		return
+	}
+	if errors.Is(err, storage.ErrSegmentNotExists) {
+		log.Info("segment not exists", slog.String("segment", segment))
+
+		response.Fail(w, r, http.StatusNotFound, response.CodeSegmentNotFound, "segment not exists")
+
+		return
+	}
+	if err != nil {
+		log.Error("failed to export segment users", logger.Err(err), slog.Int("users", rows))
+
+		if rows == 0 {
+			response.Fail(w, r, http.StatusInternalServerError, response.CodeInternal, "failed to export segment users")
+		}
+
+		return
+	}
+
+	if rows == 0 {
+		writeHeader()
+	}
+	cw.Flush()
+	if err := cw.Error(); err != nil {
+		log.Error("failed to export segment users", logger.Err(err))
+		return
+	}
+
+	log.Info("segment users are exported", slog.String("segment", segment), slog.Int("users", rows))
+}
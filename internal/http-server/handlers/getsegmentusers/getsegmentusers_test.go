@@ -0,0 +1,278 @@
+package getsegmentusers_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/m1al04949/avito-tech-service/internal/auth"
+	"github.com/m1al04949/avito-tech-service/internal/http-server/handlers/getsegmentusers"
+	"github.com/m1al04949/avito-tech-service/internal/http-server/handlers/getsegmentusers/mocks"
+	"github.com/m1al04949/avito-tech-service/internal/lib/cursor"
+	"github.com/m1al04949/avito-tech-service/internal/lib/response"
+	"github.com/m1al04949/avito-tech-service/internal/storage"
+	"github.com/m1al04949/avito-tech-service/pkg/slogdiscard"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+const segment = "AVITO_VOICE"
+
+func TestGetSegmentUsersHandler(t *testing.T) {
+	cases := []struct {
+		name        string
+		query       string
+		accept      string
+		stream      bool
+		after       int
+		limit       int
+		users       []int
+		respUsers   []int
+		next        bool
+		status      int
+		contentType string
+		respBody    string
+		respError   string
+		respCode    string
+		mockError   error
+	}{
+		{
+			name:      "Page",
+			limit:     101,
+			users:     []int{1000, 1001},
+			respUsers: []int{1000, 1001},
+			status:    http.StatusOK,
+		},
+		{
+			name:      "Page is full",
+			query:     "limit=2",
+			limit:     3,
+			users:     []int{1000, 1001, 1002},
+			respUsers: []int{1000, 1001},
+			next:      true,
+			status:    http.StatusOK,
+		},
+		{
+			name:      "Page after cursor",
+			query:     "limit=2&cursor=" + mustEncode(t, `{"after":1001}`),
+			after:     1001,
+			limit:     3,
+			users:     []int{1002},
+			respUsers: []int{1002},
+			status:    http.StatusOK,
+		},
+		{
+			name:      "Accept JSON",
+			accept:    "application/json",
+			limit:     101,
+			users:     []int{1000},
+			respUsers: []int{1000},
+			status:    http.StatusOK,
+		},
+		{
+			name:        "Accept NDJSON",
+			accept:      "application/x-ndjson",
+			stream:      true,
+			users:       []int{1000, 1001},
+			status:      http.StatusOK,
+			contentType: "application/x-ndjson",
+			respBody:    "{\"user_id\":1000}\n{\"user_id\":1001}\n",
+		},
+		{
+			name:        "Accept CSV",
+			accept:      "text/csv;q=0.9, application/json;q=0.5",
+			stream:      true,
+			users:       []int{1000, 1001},
+			status:      http.StatusOK,
+			contentType: "text/csv; charset=utf-8",
+			respBody:    "1000\n1001\n",
+		},
+		{
+			name:        "Format overrides Accept",
+			query:       "format=csv",
+			accept:      "application/x-ndjson",
+			stream:      true,
+			users:       []int{1000},
+			status:      http.StatusOK,
+			contentType: "text/csv; charset=utf-8",
+			respBody:    "1000\n",
+		},
+		{
+			name:        "Empty export",
+			query:       "format=ndjson",
+			stream:      true,
+			status:      http.StatusOK,
+			contentType: "application/x-ndjson",
+		},
+		{
+			name:      "Unknown segment",
+			limit:     101,
+			status:    http.StatusNotFound,
+			respError: "segment not exists",
+			respCode:  response.CodeSegmentNotFound,
+			mockError: storage.ErrSegmentNotExists,
+		},
+		{
+			name:      "Unknown segment of export",
+			accept:    "application/x-ndjson",
+			stream:    true,
+			status:    http.StatusNotFound,
+			respError: "segment not exists",
+			respCode:  response.CodeSegmentNotFound,
+			mockError: storage.ErrSegmentNotExists,
+		},
+		{
+			name:      "Segment of other prefix",
+			query:     "format=csv",
+			stream:    true,
+			status:    http.StatusForbidden,
+			respError: "access to segment is denied",
+			respCode:  response.CodeForbidden,
+			mockError: auth.ErrForbidden,
+		},
+		{
+			name:      "Invalid format",
+			query:     "format=xml",
+			status:    http.StatusBadRequest,
+			respError: "format must be ndjson or csv",
+			respCode:  response.CodeInvalidRequest,
+		},
+		{
+			name:      "Zero limit",
+			query:     "limit=0",
+			status:    http.StatusBadRequest,
+			respError: "limit must be between 1 and 10000",
+			respCode:  response.CodeInvalidRequest,
+		},
+		{
+			name:      "Limit is too big",
+			query:     "limit=10001",
+			status:    http.StatusBadRequest,
+			respError: "limit must be between 1 and 10000",
+			respCode:  response.CodeInvalidRequest,
+		},
+		{
+			name:      "Invalid cursor",
+			query:     "cursor=%21%21%21",
+			status:    http.StatusBadRequest,
+			respError: "invalid cursor",
+			respCode:  response.CodeInvalidRequest,
+		},
+		{
+			name:      "Tampered cursor",
+			query:     "cursor=" + mustEncode(t, `{"after":"1001"}`),
+			status:    http.StatusBadRequest,
+			respError: "invalid cursor",
+			respCode:  response.CodeInvalidRequest,
+		},
+		{
+			name:      "Negative cursor",
+			query:     "cursor=" + mustEncode(t, `{"after":-1}`),
+			status:    http.StatusBadRequest,
+			respError: "invalid cursor",
+			respCode:  response.CodeInvalidRequest,
+		},
+		{
+			name:      "Storage failure",
+			limit:     101,
+			status:    http.StatusInternalServerError,
+			respError: "failed to get segment users",
+			respCode:  response.CodeInternal,
+			mockError: fmt.Errorf("unexpected error"),
+		},
+		{
+			name:      "Storage failure of export",
+			query:     "format=ndjson",
+			stream:    true,
+			status:    http.StatusInternalServerError,
+			respError: "failed to export segment users",
+			respCode:  response.CodeInternal,
+			mockError: fmt.Errorf("unexpected error"),
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			segmUsersGetterMock := mocks.NewSegmUsersGetter(t)
+
+			if tc.respError == "" || tc.mockError != nil {
+				if tc.stream {
+					segmUsersGetterMock.On("StreamSegmUsers", mock.Anything, segment, mock.Anything).
+						Run(func(args mock.Arguments) {
+							fn := args.Get(2).(func(int) error)
+							for _, user := range tc.users {
+								require.NoError(t, fn(user))
+							}
+						}).
+						Return(tc.mockError).
+						Once()
+				} else {
+					segmUsersGetterMock.On("GetSegmUsers", mock.Anything, segment, tc.after, tc.limit).
+						Return(tc.users, tc.mockError).
+						Once()
+				}
+			}
+
+			router := chi.NewRouter()
+			router.Get("/segments/{slug}/users",
+				getsegmentusers.GetSegmentUsers(slogdiscard.NewDiscardLogger(), segmUsersGetterMock))
+
+			req, err := http.NewRequest(http.MethodGet, "/segments/"+segment+"/users?"+tc.query, nil)
+			require.NoError(t, err)
+			if tc.accept != "" {
+				req.Header.Set("Accept", tc.accept)
+			}
+
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, req)
+
+			require.Equal(t, tc.status, rr.Code)
+
+			if tc.respError == "" && tc.stream {
+				require.Equal(t, tc.contentType, rr.Header().Get("Content-Type"))
+				require.Equal(t, tc.respBody, rr.Body.String())
+
+				return
+			}
+
+			if tc.respError == "" {
+				var resp getsegmentusers.Response
+
+				require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &resp))
+
+				require.Equal(t, response.StatusOK, resp.Status)
+				require.Equal(t, segment, resp.Segment)
+				require.Equal(t, tc.respUsers, resp.Users)
+				require.Equal(t, tc.next, resp.NextCursor != "")
+
+				return
+			}
+
+			// Body holds the problem only, so nothing of export was written before it
+			var resp response.Problem
+
+			require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &resp))
+
+			require.Equal(t, response.ContentTypeProblem, rr.Header().Get("Content-Type"))
+			require.Equal(t, tc.respError, resp.Detail)
+			require.Equal(t, tc.respCode, resp.Code)
+			require.Equal(t, tc.status, resp.Status)
+		})
+	}
+}
+
+func mustEncode(t *testing.T, raw string) string {
+	t.Helper()
+
+	c, err := cursor.Encode(json.RawMessage(raw))
+	require.NoError(t, err)
+
+	return c
+}
@@ -1,6 +1,7 @@
 package getuser
 
 import (
+	"context"
 	"errors"
 	"net/http"
 	"strconv"
@@ -8,6 +9,7 @@ import (
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
 	"github.com/go-chi/render"
+	"github.com/m1al04949/avito-tech-service/internal/auth"
 	"github.com/m1al04949/avito-tech-service/internal/lib/response"
 	"github.com/m1al04949/avito-tech-service/internal/logger"
 	"github.com/m1al04949/avito-tech-service/internal/storage"
@@ -22,7 +24,7 @@ type Response struct {
 }
 
 type UserGetter interface {
-	GetUser(int) ([]string, error)
+	GetUser(context.Context, int) ([]string, error)
 }
 
 func GetFromUser(log *slog.Logger, userGetter UserGetter) http.HandlerFunc {
@@ -34,7 +36,7 @@ func GetFromUser(log *slog.Logger, userGetter UserGetter) http.HandlerFunc {
 		if id == "" {
 			log.Info("id is empty")
 
-			render.JSON(w, r, response.Error("invalid request"))
+			response.Fail(w, r, http.StatusBadRequest, response.CodeInvalidRequest, "invalid request")
 
 			return
 		}
@@ -42,23 +44,27 @@ func GetFromUser(log *slog.Logger, userGetter UserGetter) http.HandlerFunc {
 		if err != nil {
 			log.Info("id is not int")
 
-			render.JSON(w, r, response.Error("invalid id"))
+			response.Fail(w, r, http.StatusBadRequest, response.CodeInvalidRequest, "invalid id")
 
 			return
 		}
 
-		log = log.With(
+		log := log.With(
 			slog.String("op", op),
 			slog.String("request_id", middleware.GetReqID(r.Context())),
+			logger.Trace(r.Context()),
+			auth.Attr(r.Context()),
 		)
 
-		segments, err := userGetter.GetUser(user)
+		segments, err := userGetter.GetUser(r.Context(), user)
 		if errors.Is(err, storage.ErrUserNotExists) {
 			log.Info("user not exists", slog.Int("user", user))
+			response.Fail(w, r, http.StatusNotFound, response.CodeUserNotFound, "user not exists")
+			return
 		}
 		if err != nil {
 			log.Error("failed to get user info", logger.Err(err))
-			render.JSON(w, r, response.Error("failed to get user info"))
+			response.Fail(w, r, http.StatusInternalServerError, response.CodeInternal, "failed to get user info")
 			return
 		}
 
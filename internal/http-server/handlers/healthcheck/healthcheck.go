@@ -0,0 +1,48 @@
+package healthcheck
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/go-chi/render"
+	"github.com/m1al04949/avito-tech-service/internal/health"
+	"github.com/m1al04949/avito-tech-service/internal/logger"
+	"golang.org/x/exp/slog"
+)
+
+type ReadinessChecker interface {
+	Check(ctx context.Context) health.Report
+}
+
+// Liveness reports that the process is alive and serves HTTP
+func Liveness() http.HandlerFunc {
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		render.JSON(w, r, health.Report{Status: health.StatusOK, Checks: []health.CheckResult{}})
+	}
+}
+
+// Readiness reports whether the service can serve requests with details of every check,
+// failed readiness is returned with 503 Service Unavailable
+func Readiness(log *slog.Logger, checker ReadinessChecker) http.HandlerFunc {
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "handlers.readiness"
+
+		report := checker.Check(r.Context())
+
+		if report.Status != health.StatusOK {
+			log.Warn("service is not ready",
+				slog.String("op", op),
+				slog.String("request_id", middleware.GetReqID(r.Context())),
+				logger.Trace(r.Context()),
+				slog.Any("checks", report.Checks),
+			)
+
+			render.Status(r, http.StatusServiceUnavailable)
+		}
+
+		render.JSON(w, r, report)
+	}
+}
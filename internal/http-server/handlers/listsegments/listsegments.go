@@ -0,0 +1,154 @@
+package listsegments
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/go-chi/render"
+	"github.com/m1al04949/avito-tech-service/internal/auth"
+	"github.com/m1al04949/avito-tech-service/internal/lib/cursor"
+	"github.com/m1al04949/avito-tech-service/internal/lib/response"
+	"github.com/m1al04949/avito-tech-service/internal/logger"
+	"github.com/m1al04949/avito-tech-service/internal/model"
+	"golang.org/x/exp/slog"
+)
+
+const (
+	defaultLimit = 50
+	maxLimit     = 1000
+)
+
+type Response struct {
+	response.Response
+	Segments   []model.Segments `json:"segments"`
+	NextCursor string           `json:"next_cursor,omitempty"`
+	Method     string
+}
+
+//go:generate go run github.com/vektra/mockery/v2 --name=SegmLister
+type SegmLister interface {
+	ListSegms(context.Context, model.SegmentsFilter) ([]model.Segments, error)
+}
+
+// Position of the last segment on the page, bound to filter and sorting it was made for
+type pageCursor struct {
+	Prefix string         `json:"prefix,omitempty"`
+	SortBy string         `json:"sort"`
+	Desc   bool           `json:"desc"`
+	After  model.Segments `json:"after"`
+}
+
+func ListSegments(log *slog.Logger, segmLister SegmLister) http.HandlerFunc {
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "handlers.listsegments"
+
+		log := log.With(
+			slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+			logger.Trace(r.Context()),
+			auth.Attr(r.Context()),
+		)
+
+		filter, err := parseFilter(r)
+		if err != nil {
+			log.Info("invalid query", logger.Err(err))
+
+			response.Fail(w, r, http.StatusBadRequest, response.CodeInvalidRequest, err.Error())
+
+			return
+		}
+		limit := filter.Limit
+		filter.Limit++
+
+		segments, err := segmLister.ListSegms(r.Context(), filter)
+		if err != nil {
+			log.Error("failed to list segments", logger.Err(err))
+
+			response.Fail(w, r, http.StatusInternalServerError, response.CodeInternal, "failed to list segments")
+
+			return
+		}
+
+		var next string
+		if len(segments) > limit {
+			segments = segments[:limit]
+			next, err = cursor.Encode(pageCursor{
+				Prefix: filter.Prefix,
+				SortBy: filter.SortBy,
+				Desc:   filter.Desc,
+				After:  segments[limit-1],
+			})
+			if err != nil {
+				log.Error("failed to make cursor", logger.Err(err))
+
+				response.Fail(w, r, http.StatusInternalServerError, response.CodeInternal, "failed to list segments")
+
+				return
+			}
+		}
+
+		log.Info("segments are listed", slog.Int("segments", len(segments)))
+
+		render.JSON(w, r, Response{
+			Response:   response.OK(),
+			Segments:   segments,
+			NextCursor: next,
+			Method:     r.Method,
+		})
+	}
+}
+
+func parseFilter(r *http.Request) (model.SegmentsFilter, error) {
+	q := r.URL.Query()
+
+	filter := model.SegmentsFilter{
+		Prefix: q.Get("prefix"),
+		SortBy: q.Get("sort"),
+		Limit:  defaultLimit,
+	}
+
+	switch filter.SortBy {
+	case "":
+		filter.SortBy = model.SortByName
+	case model.SortByName, model.SortByCreatedAt, model.SortBySize:
+	default:
+		return filter, errors.New("sort must be one of name, created_at, size")
+	}
+
+	switch q.Get("order") {
+	case "", "asc":
+	case "desc":
+		filter.Desc = true
+	default:
+		return filter, errors.New("order must be asc or desc")
+	}
+
+	if l := q.Get("limit"); l != "" {
+		limit, err := strconv.Atoi(l)
+		if err != nil || limit < 1 || limit > maxLimit {
+			return filter, fmt.Errorf("limit must be between 1 and %d", maxLimit)
+		}
+		filter.Limit = limit
+	}
+
+	if c := q.Get("cursor"); c != "" {
+		var pc pageCursor
+		if err := cursor.Decode(c, &pc); err != nil {
+			return filter, errors.New("invalid cursor")
+		}
+		if pc.SortBy != filter.SortBy || pc.Desc != filter.Desc {
+			return filter, errors.New("cursor does not match sort and order")
+		}
+		if pc.Prefix != filter.Prefix {
+			return filter, errors.New("cursor does not match prefix")
+		}
+		filter.After = &pc.After
+	}
+
+	return filter, nil
+}
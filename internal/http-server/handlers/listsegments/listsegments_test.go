@@ -0,0 +1,241 @@
+package listsegments_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/m1al04949/avito-tech-service/internal/http-server/handlers/listsegments"
+	"github.com/m1al04949/avito-tech-service/internal/http-server/handlers/listsegments/mocks"
+	"github.com/m1al04949/avito-tech-service/internal/lib/cursor"
+	"github.com/m1al04949/avito-tech-service/internal/lib/response"
+	"github.com/m1al04949/avito-tech-service/internal/model"
+	"github.com/m1al04949/avito-tech-service/pkg/slogdiscard"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+var (
+	voice = model.Segments{SegmentName: "AVITO_VOICE", AutoPercent: 30,
+		CreatedAt: time.Date(2023, time.August, 28, 10, 0, 0, 0, time.UTC), Users: 940}
+	discount = model.Segments{SegmentName: "AVITO_DISCOUNT_50",
+		CreatedAt: time.Date(2023, time.August, 29, 12, 0, 0, 0, time.UTC), Users: 1520}
+)
+
+func TestListSegmentsHandler(t *testing.T) {
+	cases := []struct {
+		name      string
+		query     string
+		filter    model.SegmentsFilter
+		segments  []model.Segments
+		respSegms []model.Segments
+		next      bool
+		status    int
+		respError string
+		respCode  string
+		mockError error
+	}{
+		{
+			name:      "Success",
+			filter:    model.SegmentsFilter{SortBy: model.SortByName, Limit: 51},
+			segments:  []model.Segments{discount, voice},
+			respSegms: []model.Segments{discount, voice},
+			status:    http.StatusOK,
+		},
+		{
+			name:      "Prefix filter",
+			query:     "prefix=AVITO_&sort=size&order=desc",
+			filter:    model.SegmentsFilter{Prefix: "AVITO_", SortBy: model.SortBySize, Desc: true, Limit: 51},
+			segments:  []model.Segments{discount, voice},
+			respSegms: []model.Segments{discount, voice},
+			status:    http.StatusOK,
+		},
+		{
+			name:      "Page is full",
+			query:     "limit=1",
+			filter:    model.SegmentsFilter{SortBy: model.SortByName, Limit: 2},
+			segments:  []model.Segments{discount, voice},
+			respSegms: []model.Segments{discount},
+			next:      true,
+			status:    http.StatusOK,
+		},
+		{
+			name:   "Max limit",
+			query:  "limit=1000",
+			filter: model.SegmentsFilter{SortBy: model.SortByName, Limit: 1001},
+			status: http.StatusOK,
+		},
+		{
+			name:      "Zero limit",
+			query:     "limit=0",
+			status:    http.StatusBadRequest,
+			respError: "limit must be between 1 and 1000",
+			respCode:  response.CodeInvalidRequest,
+		},
+		{
+			name:      "Limit is too big",
+			query:     "limit=1001",
+			status:    http.StatusBadRequest,
+			respError: "limit must be between 1 and 1000",
+			respCode:  response.CodeInvalidRequest,
+		},
+		{
+			name:      "Invalid sort",
+			query:     "sort=users",
+			status:    http.StatusBadRequest,
+			respError: "sort must be one of name, created_at, size",
+			respCode:  response.CodeInvalidRequest,
+		},
+		{
+			name:      "Invalid order",
+			query:     "order=up",
+			status:    http.StatusBadRequest,
+			respError: "order must be asc or desc",
+			respCode:  response.CodeInvalidRequest,
+		},
+		{
+			name:      "Invalid cursor",
+			query:     "cursor=%21%21%21",
+			status:    http.StatusBadRequest,
+			respError: "invalid cursor",
+			respCode:  response.CodeInvalidRequest,
+		},
+		{
+			name:      "Tampered cursor",
+			query:     "cursor=" + mustEncode(t, `{"sort":"name","after":"AVITO_VOICE"}`),
+			status:    http.StatusBadRequest,
+			respError: "invalid cursor",
+			respCode:  response.CodeInvalidRequest,
+		},
+		{
+			name:      "Storage failure",
+			filter:    model.SegmentsFilter{SortBy: model.SortByName, Limit: 51},
+			status:    http.StatusInternalServerError,
+			respError: "failed to list segments",
+			respCode:  response.CodeInternal,
+			mockError: fmt.Errorf("unexpected error"),
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			segmListerMock := mocks.NewSegmLister(t)
+
+			if tc.respError == "" || tc.mockError != nil {
+				segmListerMock.On("ListSegms", mock.Anything, tc.filter).
+					Return(tc.segments, tc.mockError).
+					Once()
+			}
+
+			handler := listsegments.ListSegments(slogdiscard.NewDiscardLogger(), segmListerMock)
+
+			rr := list(t, handler, tc.query)
+
+			require.Equal(t, tc.status, rr.Code)
+
+			if tc.respError == "" {
+				var resp listsegments.Response
+
+				require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &resp))
+
+				require.Equal(t, response.StatusOK, resp.Status)
+				require.Equal(t, tc.respSegms, resp.Segments)
+				require.Equal(t, tc.next, resp.NextCursor != "")
+
+				return
+			}
+
+			requireProblem(t, rr, tc.status, tc.respCode, tc.respError)
+		})
+	}
+}
+
+func TestListSegmentsCursor(t *testing.T) {
+	const first = "prefix=AVITO_&sort=size&order=desc&limit=1"
+
+	segmListerMock := mocks.NewSegmLister(t)
+	segmListerMock.On("ListSegms", mock.Anything,
+		model.SegmentsFilter{Prefix: "AVITO_", SortBy: model.SortBySize, Desc: true, Limit: 2}).
+		Return([]model.Segments{discount, voice}, nil).
+		Once()
+	segmListerMock.On("ListSegms", mock.Anything,
+		model.SegmentsFilter{Prefix: "AVITO_", SortBy: model.SortBySize, Desc: true, Limit: 2, After: &discount}).
+		Return([]model.Segments{voice}, nil).
+		Once()
+
+	handler := listsegments.ListSegments(slogdiscard.NewDiscardLogger(), segmListerMock)
+
+	rr := list(t, handler, first)
+	require.Equal(t, http.StatusOK, rr.Code)
+
+	var page listsegments.Response
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &page))
+	require.Equal(t, []model.Segments{discount}, page.Segments)
+	require.NotEmpty(t, page.NextCursor)
+
+	next := "&cursor=" + page.NextCursor
+
+	rr = list(t, handler, first+next)
+	require.Equal(t, http.StatusOK, rr.Code)
+
+	page = listsegments.Response{}
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &page))
+	require.Equal(t, []model.Segments{voice}, page.Segments)
+	require.Empty(t, page.NextCursor)
+
+	// Cursor is reused with another filter or sorting, which would skip or repeat rows
+	for _, tc := range []struct {
+		query     string
+		respError string
+	}{
+		{query: "prefix=AVITO_&sort=size&limit=1", respError: "cursor does not match sort and order"},
+		{query: "prefix=AVITO_&sort=name&order=desc&limit=1", respError: "cursor does not match sort and order"},
+		{query: "prefix=AVITO_DISCOUNT&sort=size&order=desc&limit=1", respError: "cursor does not match prefix"},
+		{query: "sort=size&order=desc&limit=1", respError: "cursor does not match prefix"},
+	} {
+		rr = list(t, handler, tc.query+next)
+		requireProblem(t, rr, http.StatusBadRequest, response.CodeInvalidRequest, tc.respError)
+	}
+}
+
+func list(t *testing.T, handler http.HandlerFunc, query string) *httptest.ResponseRecorder {
+	t.Helper()
+
+	req, err := http.NewRequest(http.MethodGet, "/segments?"+query, nil)
+	require.NoError(t, err)
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+
+	return rr
+}
+
+func requireProblem(t *testing.T, rr *httptest.ResponseRecorder, status int, code, detail string) {
+	t.Helper()
+
+	var resp response.Problem
+
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &resp))
+
+	require.Equal(t, status, rr.Code)
+	require.Equal(t, response.ContentTypeProblem, rr.Header().Get("Content-Type"))
+	require.Equal(t, detail, resp.Detail)
+	require.Equal(t, code, resp.Code)
+	require.Equal(t, status, resp.Status)
+}
+
+func mustEncode(t *testing.T, raw string) string {
+	t.Helper()
+
+	c, err := cursor.Encode(json.RawMessage(raw))
+	require.NoError(t, err)
+
+	return c
+}
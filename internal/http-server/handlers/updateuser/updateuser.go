@@ -0,0 +1,142 @@
+package updateuser
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/go-chi/render"
+	"github.com/go-playground/validator/v10"
+	"github.com/m1al04949/avito-tech-service/internal/auth"
+	"github.com/m1al04949/avito-tech-service/internal/lib/response"
+	"github.com/m1al04949/avito-tech-service/internal/lib/response/segmentsconv"
+	"github.com/m1al04949/avito-tech-service/internal/logger"
+	"github.com/m1al04949/avito-tech-service/internal/model"
+	"github.com/m1al04949/avito-tech-service/internal/storage"
+	"golang.org/x/exp/slog"
+)
+
+type Request struct {
+	Add    []model.Segment `json:"add,omitempty"`
+	Remove []model.Segment `json:"remove,omitempty"`
+}
+
+type Response struct {
+	response.Response
+	UserID   int                   `json:"user_id"`
+	Segments []string              `json:"segments"`
+	Results  []model.SegmentResult `json:"results"`
+	Method   string
+}
+
+//go:generate go run github.com/vektra/mockery/v2 --name=UserSegmUpdater
+type UserSegmUpdater interface {
+	UpdateUserSegments(context.Context, int, []model.UserSegments, []string) ([]string, []model.SegmentResult, error)
+}
+
+func UpdateUser(log *slog.Logger, userSegmUpdater UserSegmUpdater) http.HandlerFunc {
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "handlers.updateuser"
+
+		id := chi.URLParam(r, "id")
+		if id == "" {
+			log.Info("id is empty")
+
+			response.Fail(w, r, http.StatusBadRequest, response.CodeInvalidRequest, "invalid request")
+
+			return
+		}
+		user, err := strconv.Atoi(id)
+		if err != nil {
+			log.Info("id is not int")
+
+			response.Fail(w, r, http.StatusBadRequest, response.CodeInvalidRequest, "invalid id")
+
+			return
+		}
+
+		log := log.With(
+			slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+			logger.Trace(r.Context()),
+			auth.Attr(r.Context()),
+		)
+
+		var req Request
+
+		err = render.DecodeJSON(r.Body, &req)
+		if err != nil {
+			log.Error("failed to decode request body", logger.Err(err))
+
+			response.Fail(w, r, http.StatusBadRequest, response.CodeInvalidRequest, "failed to decode request")
+
+			return
+		}
+
+		log.Info("request body decoded", slog.Any("request", req))
+
+		if err := validator.New().Struct(req); err != nil {
+			validateErr := err.(validator.ValidationErrors)
+
+			log.Error("invalid request", logger.Err(err))
+
+			response.FailValidation(w, r, validateErr)
+
+			return
+		}
+
+		add, err := segmentsconv.UserSegmentsConv(user, req.Add, time.Now())
+		if err != nil {
+			log.Info("invalid segment expiration", logger.Err(err))
+
+			response.Fail(w, r, http.StatusUnprocessableEntity, response.CodeValidationFailed, err.Error())
+
+			return
+		}
+		remove := segmentsconv.SegmentsConv(req.Remove)
+
+		segments, results, err := userSegmUpdater.UpdateUserSegments(r.Context(), user, add, remove)
+		if errors.Is(err, auth.ErrForbidden) {
+			log.Info("access denied", logger.Err(err))
+			response.Fail(w, r, http.StatusForbidden, response.CodeForbidden, "access to segment is denied")
+			return
+		}
+		if errors.Is(err, storage.ErrSegmentsConflict) {
+			log.Info("segments are both added and removed", logger.Err(err))
+			response.Fail(w, r, http.StatusConflict, response.CodeSegmentsConflict, "segments are both added and removed")
+			return
+		}
+		if errors.Is(err, storage.ErrUserNotExists) {
+			log.Error("user not exists", logger.Err(err))
+			response.Fail(w, r, http.StatusNotFound, response.CodeUserNotFound, "user not exists")
+			return
+		}
+		if err != nil {
+			log.Error("failed to update segments for user", logger.Err(err))
+			response.Fail(w, r, http.StatusInternalServerError, response.CodeInternal, "failed to update segments for user")
+			return
+		}
+
+		for _, v := range results {
+			if v.Result == model.ResultUnknownSegment {
+				log.Info("segment not exists", slog.String("segment", v.Slug))
+			}
+		}
+
+		log.Info("segments updated for user", slog.Int("user", user))
+
+		render.JSON(w, r, Response{
+			Response: response.OK(),
+			UserID:   user,
+			Segments: segments,
+			Results:  results,
+			Method:   r.Method,
+		})
+	}
+
+}
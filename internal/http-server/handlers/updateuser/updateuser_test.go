@@ -0,0 +1,182 @@
+package updateuser_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/m1al04949/avito-tech-service/internal/auth"
+	"github.com/m1al04949/avito-tech-service/internal/http-server/handlers/updateuser"
+	"github.com/m1al04949/avito-tech-service/internal/http-server/handlers/updateuser/mocks"
+	"github.com/m1al04949/avito-tech-service/internal/lib/response"
+	"github.com/m1al04949/avito-tech-service/internal/model"
+	"github.com/m1al04949/avito-tech-service/internal/storage"
+	"github.com/m1al04949/avito-tech-service/pkg/slogdiscard"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUpdateUserHandler(t *testing.T) {
+	cases := []struct {
+		name      string
+		id        string
+		body      string
+		add       []model.UserSegments
+		remove    []string
+		segments  []string
+		results   []model.SegmentResult
+		status    int
+		respError string
+		respCode  string
+		mockError error
+	}{
+		{
+			name:     "Success",
+			id:       "1000",
+			body:     `{"add": [{"slug": "AVITO_VOICE"}, {"slug": "UNKNOWN"}], "remove": [{"slug": "AVITO_DISCOUNT_30"}]}`,
+			add:      []model.UserSegments{{UserID: 1000, SegmentName: "AVITO_VOICE"}, {UserID: 1000, SegmentName: "UNKNOWN"}},
+			remove:   []string{"AVITO_DISCOUNT_30"},
+			segments: []string{"AVITO_VOICE"},
+			results: []model.SegmentResult{
+				{Slug: "AVITO_VOICE", Result: model.ResultAdded},
+				{Slug: "UNKNOWN", Result: model.ResultUnknownSegment},
+				{Slug: "AVITO_DISCOUNT_30", Result: model.ResultRemoved},
+			},
+			status: http.StatusOK,
+		},
+		{
+			name:      "Segment is added and removed",
+			id:        "1000",
+			body:      `{"add": [{"slug": "AVITO_VOICE"}], "remove": [{"slug": "AVITO_VOICE"}]}`,
+			add:       []model.UserSegments{{UserID: 1000, SegmentName: "AVITO_VOICE"}},
+			remove:    []string{"AVITO_VOICE"},
+			status:    http.StatusConflict,
+			respError: "segments are both added and removed",
+			respCode:  response.CodeSegmentsConflict,
+			mockError: fmt.Errorf("storage.updateusersegments: %w: AVITO_VOICE", storage.ErrSegmentsConflict),
+		},
+		{
+			name:      "Unknown user",
+			id:        "1000",
+			body:      `{"remove": [{"slug": "AVITO_VOICE"}]}`,
+			remove:    []string{"AVITO_VOICE"},
+			status:    http.StatusNotFound,
+			respError: "user not exists",
+			respCode:  response.CodeUserNotFound,
+			mockError: storage.ErrUserNotExists,
+		},
+		{
+			name:      "Segment of other prefix",
+			id:        "1000",
+			body:      `{"add": [{"slug": "OZON_VOICE"}]}`,
+			add:       []model.UserSegments{{UserID: 1000, SegmentName: "OZON_VOICE"}},
+			status:    http.StatusForbidden,
+			respError: "access to segment is denied",
+			respCode:  response.CodeForbidden,
+			mockError: auth.ErrForbidden,
+		},
+		{
+			name:      "Invalid id",
+			id:        "someinvalidID",
+			body:      `{"add": [{"slug": "AVITO_VOICE"}]}`,
+			status:    http.StatusBadRequest,
+			respError: "invalid id",
+			respCode:  response.CodeInvalidRequest,
+		},
+		{
+			name:      "Invalid body",
+			id:        "1000",
+			body:      `{"add": "AVITO_VOICE"}`,
+			status:    http.StatusBadRequest,
+			respError: "failed to decode request",
+			respCode:  response.CodeInvalidRequest,
+		},
+		{
+			name:      "Invalid ttl",
+			id:        "1000",
+			body:      `{"add": [{"slug": "AVITO_VOICE", "ttl": "week"}]}`,
+			status:    http.StatusUnprocessableEntity,
+			respError: `segment AVITO_VOICE: invalid ttl "week"`,
+			respCode:  response.CodeValidationFailed,
+		},
+		{
+			name:      "Both ttl and expires_at",
+			id:        "1000",
+			body:      `{"add": [{"slug": "AVITO_VOICE", "ttl": "24h", "expires_at": "2030-01-01T00:00:00Z"}]}`,
+			status:    http.StatusUnprocessableEntity,
+			respError: "segment AVITO_VOICE: both ttl and expires_at are set",
+			respCode:  response.CodeValidationFailed,
+		},
+		{
+			name:      "Expiration in the past",
+			id:        "1000",
+			body:      `{"add": [{"slug": "AVITO_VOICE", "expires_at": "2020-01-01T00:00:00Z"}]}`,
+			status:    http.StatusUnprocessableEntity,
+			respError: "segment AVITO_VOICE: expires_at is in the past",
+			respCode:  response.CodeValidationFailed,
+		},
+		{
+			name:      "Storage failure",
+			id:        "1000",
+			body:      `{"remove": [{"slug": "AVITO_VOICE"}]}`,
+			remove:    []string{"AVITO_VOICE"},
+			status:    http.StatusInternalServerError,
+			respError: "failed to update segments for user",
+			respCode:  response.CodeInternal,
+			mockError: fmt.Errorf("unexpected error"),
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			userSegmUpdaterMock := mocks.NewUserSegmUpdater(t)
+
+			if tc.respError == "" || tc.mockError != nil {
+				userSegmUpdaterMock.On("UpdateUserSegments", mock.Anything, 1000, tc.add, tc.remove).
+					Return(tc.segments, tc.results, tc.mockError).
+					Once()
+			}
+
+			router := chi.NewRouter()
+			router.Patch("/users/{id}/segments", updateuser.UpdateUser(slogdiscard.NewDiscardLogger(), userSegmUpdaterMock))
+
+			req, err := http.NewRequest(http.MethodPatch, "/users/"+tc.id+"/segments", strings.NewReader(tc.body))
+			require.NoError(t, err)
+
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, req)
+
+			require.Equal(t, tc.status, rr.Code)
+
+			if tc.respError == "" {
+				var resp updateuser.Response
+
+				require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &resp))
+
+				require.Equal(t, response.StatusOK, resp.Status)
+				require.Equal(t, 1000, resp.UserID)
+				require.Equal(t, tc.segments, resp.Segments)
+				require.Equal(t, tc.results, resp.Results)
+
+				return
+			}
+
+			var resp response.Problem
+
+			require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &resp))
+
+			require.Equal(t, response.ContentTypeProblem, rr.Header().Get("Content-Type"))
+			require.Equal(t, tc.respError, resp.Detail)
+			require.Equal(t, tc.respCode, resp.Code)
+			require.Equal(t, tc.status, resp.Status)
+		})
+	}
+}
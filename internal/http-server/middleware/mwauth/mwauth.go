@@ -0,0 +1,90 @@
+package mwauth
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/m1al04949/avito-tech-service/internal/auth"
+	"github.com/m1al04949/avito-tech-service/internal/lib/response"
+	"github.com/m1al04949/avito-tech-service/internal/logger"
+	semconv "go.opentelemetry.io/otel/semconv/v1.21.0"
+	"go.opentelemetry.io/otel/trace"
+	"golang.org/x/exp/slog"
+)
+
+// New authenticates the caller and stores its principal in request context
+func New(log *slog.Logger, realm string, authenticator auth.Authenticator) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		log := log.With(
+			slog.String("component", "middleware/mwauth"),
+		)
+
+		challenger, _ := authenticator.(interface{ Challenges(realm string) []string })
+
+		fn := func(w http.ResponseWriter, r *http.Request) {
+			// Client certificate is already verified by TLS handshake
+			if r.TLS != nil && len(r.TLS.PeerCertificates) > 0 {
+				r = r.WithContext(auth.WithClientCert(r.Context(), r.TLS.PeerCertificates[0]))
+			}
+
+			principal, err := authenticator.Authenticate(r.Context(), r.Header)
+			if err != nil {
+				if !errors.Is(err, auth.ErrNoCredentials) {
+					log.Info("authentication failed",
+						slog.String("request_id", middleware.GetReqID(r.Context())),
+						logger.Trace(r.Context()),
+						logger.Err(err),
+					)
+				}
+				if challenger != nil {
+					for _, c := range challenger.Challenges(realm) {
+						w.Header().Add("WWW-Authenticate", c)
+					}
+				}
+				response.Fail(w, r, http.StatusUnauthorized, response.CodeUnauthorized, "invalid credentials")
+				return
+			}
+
+			trace.SpanFromContext(r.Context()).SetAttributes(semconv.EnduserID(principal.User))
+
+			next.ServeHTTP(w, r.WithContext(auth.WithPrincipal(r.Context(), principal)))
+		}
+
+		return http.HandlerFunc(fn)
+	}
+}
+
+// Require lets through only principals with at least role
+func Require(role auth.Role) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		fn := func(w http.ResponseWriter, r *http.Request) {
+			principal := auth.FromContext(r.Context())
+			if principal == nil || !principal.Allows(role) {
+				response.Fail(w, r, http.StatusForbidden, response.CodeForbidden, role.String()+" role is required")
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		}
+
+		return http.HandlerFunc(fn)
+	}
+}
+
+// RequireUnrestricted lets through only principals allowed to use every segment
+func RequireUnrestricted() func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		fn := func(w http.ResponseWriter, r *http.Request) {
+			principal := auth.FromContext(r.Context())
+			if principal == nil || !principal.Unrestricted() {
+				response.Fail(w, r, http.StatusForbidden, response.CodeForbidden, "access to all segments is required")
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		}
+
+		return http.HandlerFunc(fn)
+	}
+}
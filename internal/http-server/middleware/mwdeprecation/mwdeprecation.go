@@ -0,0 +1,21 @@
+package mwdeprecation
+
+import (
+	"fmt"
+	"net/http"
+)
+
+// New marks responses of deprecated routes with Deprecation header
+// and links to the successor API version
+func New(successor string) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		fn := func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Deprecation", "true")
+			w.Header().Set("Link", fmt.Sprintf("<%s>; rel=\"successor-version\"", successor))
+
+			next.ServeHTTP(w, r)
+		}
+
+		return http.HandlerFunc(fn)
+	}
+}
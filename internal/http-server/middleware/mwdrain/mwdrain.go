@@ -0,0 +1,23 @@
+package mwdrain
+
+import (
+	"net/http"
+
+	"github.com/m1al04949/avito-tech-service/internal/health"
+)
+
+// New asks clients to close keep-alive connections once the service is draining,
+// so their next requests are routed to other instances
+func New(readiness *health.Readiness) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		fn := func(w http.ResponseWriter, r *http.Request) {
+			if readiness.Draining() {
+				w.Header().Set("Connection", "close")
+			}
+
+			next.ServeHTTP(w, r)
+		}
+
+		return http.HandlerFunc(fn)
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"time"
 
 	"github.com/go-chi/chi/v5/middleware"
+	"github.com/m1al04949/avito-tech-service/internal/logger"
 	"golang.org/x/exp/slog"
 )
 
@@ -23,6 +24,7 @@ func New(log *slog.Logger) func(next http.Handler) http.Handler {
 				slog.String("remote_addr", r.RemoteAddr),
 				slog.String("user_agent", r.UserAgent()),
 				slog.String("request_id", middleware.GetReqID(r.Context())),
+				logger.Trace(r.Context()),
 			)
 			ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
 
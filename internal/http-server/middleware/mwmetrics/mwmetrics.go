@@ -0,0 +1,61 @@
+package mwmetrics
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+)
+
+const (
+	// Route label of requests which matched no route
+	unmatchedRoute = "unmatched"
+	// Method label of requests with nonstandard method
+	otherMethod = "OTHER"
+)
+
+type Observer interface {
+	ObserveHTTP(route, method, status string, seconds float64)
+}
+
+// New records count and duration of requests labeled with chi route pattern,
+// so paths with ids and slugs do not produce a series per value
+func New(observer Observer) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		fn := func(w http.ResponseWriter, r *http.Request) {
+			ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+
+			t1 := time.Now()
+			defer func() {
+				route := unmatchedRoute
+				if rctx := chi.RouteContext(r.Context()); rctx != nil && rctx.RoutePattern() != "" {
+					route = rctx.RoutePattern()
+				}
+
+				status := ww.Status()
+				if status == 0 {
+					status = http.StatusOK
+				}
+
+				observer.ObserveHTTP(route, method(r.Method), strconv.Itoa(status), time.Since(t1).Seconds())
+			}()
+
+			next.ServeHTTP(ww, r)
+		}
+
+		return http.HandlerFunc(fn)
+	}
+}
+
+// Method is sent by client, so unknown ones share a label instead of a series per value
+func method(m string) string {
+	switch m {
+	case http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodPatch,
+		http.MethodDelete, http.MethodConnect, http.MethodOptions, http.MethodTrace:
+		return m
+	}
+
+	return otherMethod
+}
@@ -0,0 +1,102 @@
+package response
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/go-chi/render"
+	"github.com/go-playground/validator/v10"
+)
+
+const ContentTypeProblem = "application/problem+json"
+
+// Machine-readable error codes
+const (
+	CodeUnauthorized     = "unauthorized"
+	CodeForbidden        = "forbidden"
+	CodeInvalidRequest   = "invalid_request"
+	CodeValidationFailed = "validation_failed"
+	CodeUserNotFound     = "user_not_found"
+	CodeUserExists       = "user_exists"
+	CodeUserInUse        = "user_in_use"
+	CodeSegmentNotFound  = "segment_not_found"
+	CodeSegmentExists    = "segment_exists"
+	CodeSegmentInUse     = "segment_in_use"
+	CodeSegmentsConflict = "segments_conflict"
+	CodeInternal         = "internal_error"
+)
+
+const problemTypePrefix = "urn:avito-tech-service:problem:"
+
+// Problem is RFC 7807 problem details body
+type Problem struct {
+	Type      string `json:"type"`
+	Title     string `json:"title"`
+	Status    int    `json:"status"`
+	Detail    string `json:"detail,omitempty"`
+	Instance  string `json:"instance,omitempty"`
+	Code      string `json:"code"`
+	RequestID string `json:"request_id,omitempty"`
+}
+
+type ctxKeyLegacy struct{}
+
+// LegacyErrors makes Fail render legacy {"status":"Error"} bodies with HTTP 200
+// unless client explicitly accepts problem+json
+func LegacyErrors(enabled bool) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		fn := func(w http.ResponseWriter, r *http.Request) {
+			if enabled && !strings.Contains(r.Header.Get("Accept"), ContentTypeProblem) {
+				r = r.WithContext(context.WithValue(r.Context(), ctxKeyLegacy{}, true))
+			}
+
+			next.ServeHTTP(w, r)
+		}
+
+		return http.HandlerFunc(fn)
+	}
+}
+
+func isLegacy(r *http.Request) bool {
+	legacy, _ := r.Context().Value(ctxKeyLegacy{}).(bool)
+
+	return legacy
+}
+
+// Fail renders error response with given HTTP status and error code
+func Fail(w http.ResponseWriter, r *http.Request, status int, code, detail string) {
+	if isLegacy(r) {
+		// Legacy API always answered access errors with their status
+		if status == http.StatusUnauthorized || status == http.StatusForbidden {
+			render.Status(r, status)
+		}
+		render.JSON(w, r, Error(detail))
+		return
+	}
+
+	body, err := json.Marshal(Problem{
+		Type:      problemTypePrefix + code,
+		Title:     http.StatusText(status),
+		Status:    status,
+		Detail:    detail,
+		Instance:  r.URL.Path,
+		Code:      code,
+		RequestID: middleware.GetReqID(r.Context()),
+	})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", ContentTypeProblem)
+	w.WriteHeader(status)
+	w.Write(body) //nolint:errcheck
+}
+
+// FailValidation renders validation errors with HTTP 422
+func FailValidation(w http.ResponseWriter, r *http.Request, errs validator.ValidationErrors) {
+	Fail(w, r, http.StatusUnprocessableEntity, CodeValidationFailed, ValidationError(errs).Error)
+}
@@ -1,6 +1,11 @@
 package segmentsconv
 
-import "github.com/m1al04949/avito-tech-service/internal/model"
+import (
+	"fmt"
+	"time"
+
+	"github.com/m1al04949/avito-tech-service/internal/model"
+)
 
 func SegmentsConv(s []model.Segment) []string {
 
@@ -12,3 +17,37 @@ func SegmentsConv(s []model.Segment) []string {
 
 	return segments
 }
+
+// Convert request segments to user segments resolving ttl to expiration time
+func UserSegmentsConv(user int, s []model.Segment, now time.Time) ([]model.UserSegments, error) {
+
+	var segments []model.UserSegments
+
+	for i := 0; i < len(s); i++ {
+		expiresAt := s[i].ExpiresAt
+
+		if s[i].TTL != "" {
+			if expiresAt != nil {
+				return nil, fmt.Errorf("segment %s: both ttl and expires_at are set", s[i].Slug)
+			}
+			ttl, err := time.ParseDuration(s[i].TTL)
+			if err != nil || ttl <= 0 {
+				return nil, fmt.Errorf("segment %s: invalid ttl %q", s[i].Slug, s[i].TTL)
+			}
+			t := now.Add(ttl)
+			expiresAt = &t
+		}
+
+		if expiresAt != nil && !expiresAt.After(now) {
+			return nil, fmt.Errorf("segment %s: expires_at is in the past", s[i].Slug)
+		}
+
+		segments = append(segments, model.UserSegments{
+			UserID:      user,
+			SegmentName: s[i].Slug,
+			ExpiresAt:   expiresAt,
+		})
+	}
+
+	return segments, nil
+}
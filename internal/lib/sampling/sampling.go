@@ -0,0 +1,24 @@
+package sampling
+
+import (
+	"crypto/md5"
+	"encoding/binary"
+	"strconv"
+)
+
+// InPercent reports whether user falls into the given percent of segment audience.
+// Selection depends only on user and segment, so it is the same on every call.
+// User gets bucket from the first 4 bytes of md5("segment:user"), which DB computes
+// the same way to enroll all users in one statement
+func InPercent(user int, segment string, percent int) bool {
+	if percent <= 0 {
+		return false
+	}
+	if percent >= 100 {
+		return true
+	}
+
+	sum := md5.Sum([]byte(segment + ":" + strconv.Itoa(user)))
+
+	return int(binary.BigEndian.Uint32(sum[:4])%100) < percent
+}
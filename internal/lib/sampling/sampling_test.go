@@ -0,0 +1,65 @@
+package sampling_test
+
+import (
+	"strconv"
+	"testing"
+
+	"github.com/m1al04949/avito-tech-service/internal/lib/sampling"
+	"github.com/stretchr/testify/require"
+)
+
+func TestInPercentIsStable(t *testing.T) {
+	// Buckets are pinned, since Postgres enrolls existing users by the same hash in SQL
+	for _, tc := range []struct {
+		user    int
+		segment string
+		bucket  int
+	}{
+		{user: 1000, segment: "AVITO_VOICE_MESSAGES", bucket: 20},
+		{user: 1001, segment: "AVITO_VOICE_MESSAGES", bucket: 36},
+		{user: 1, segment: "AUTO", bucket: 79},
+		{user: 42, segment: "AUTO", bucket: 69},
+	} {
+		name := tc.segment + ":" + strconv.Itoa(tc.user)
+		require.False(t, sampling.InPercent(tc.user, tc.segment, tc.bucket), name)
+		require.True(t, sampling.InPercent(tc.user, tc.segment, tc.bucket+1), name)
+	}
+
+	for user := 1; user <= 1000; user++ {
+		require.Equal(t, sampling.InPercent(user, "AUTO", 30), sampling.InPercent(user, "AUTO", 30))
+	}
+}
+
+func TestInPercentDistribution(t *testing.T) {
+	const users = 100000
+
+	for _, percent := range []int{1, 10, 30, 50, 99} {
+		var in int
+		for user := 1; user <= users; user++ {
+			if sampling.InPercent(user, "AVITO_VOICE_MESSAGES", percent) {
+				in++
+			}
+		}
+		require.InDelta(t, percent, float64(in)*100/users, 0.5, "percent %d", percent)
+	}
+
+	// Bigger percent keeps users of smaller one
+	for user := 1; user <= 1000; user++ {
+		for percent := 0; percent < 100; percent++ {
+			if sampling.InPercent(user, "AUTO", percent) {
+				require.True(t, sampling.InPercent(user, "AUTO", percent+1))
+			}
+		}
+		require.False(t, sampling.InPercent(user, "AUTO", 0))
+		require.True(t, sampling.InPercent(user, "AUTO", 100))
+	}
+
+	// Segments select different users
+	var both int
+	for user := 1; user <= users; user++ {
+		if sampling.InPercent(user, "A", 50) && sampling.InPercent(user, "B", 50) {
+			both++
+		}
+	}
+	require.InDelta(t, 25, float64(both)*100/users, 0.5)
+}
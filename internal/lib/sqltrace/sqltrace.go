@@ -0,0 +1,64 @@
+// Package sqltrace opens database/sql pools which create a span for every query.
+package sqltrace
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"strings"
+
+	"github.com/XSAM/otelsql"
+	"go.opentelemetry.io/otel/attribute"
+	semconv "go.opentelemetry.io/otel/semconv/v1.21.0"
+)
+
+// Open opens pool of driver, spans are created by global tracer provider,
+// so queries cost nothing extra while tracing is not set up
+func Open(driverName, dsn string, system attribute.KeyValue) (*sql.DB, error) {
+	return otelsql.Open(driverName, dsn, options(system)...)
+}
+
+// OpenDB opens pool of connector the same way as Open
+func OpenDB(connector driver.Connector, system attribute.KeyValue) *sql.DB {
+	return otelsql.OpenDB(connector, options(system)...)
+}
+
+func options(system attribute.KeyValue) []otelsql.Option {
+	return []otelsql.Option{
+		otelsql.WithAttributes(system),
+		otelsql.WithSpanNameFormatter(spanName),
+		otelsql.WithAttributesGetter(operation),
+		otelsql.WithSpanOptions(otelsql.SpanOptions{
+			DisableErrSkip:       true,
+			OmitConnResetSession: true,
+			OmitRows:             true,
+		}),
+	}
+}
+
+// Name spans of queries by SQL operation, the statement itself is an attribute
+func spanName(_ context.Context, method otelsql.Method, query string) string {
+	if op := sqlOperation(query); op != "" {
+		return op
+	}
+
+	return string(method)
+}
+
+func operation(_ context.Context, _ otelsql.Method, query string, _ []driver.NamedValue) []attribute.KeyValue {
+	if op := sqlOperation(query); op != "" {
+		return []attribute.KeyValue{semconv.DBOperation(op)}
+	}
+
+	return nil
+}
+
+// First keyword of statement, such as SELECT or INSERT
+func sqlOperation(query string) string {
+	fields := strings.Fields(query)
+	if len(fields) == 0 {
+		return ""
+	}
+
+	return strings.ToUpper(fields[0])
+}
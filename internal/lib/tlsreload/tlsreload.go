@@ -0,0 +1,170 @@
+package tlsreload
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+	"sync/atomic"
+	"time"
+
+	"github.com/m1al04949/avito-tech-service/internal/config"
+	"github.com/m1al04949/avito-tech-service/internal/logger"
+	"golang.org/x/exp/slog"
+)
+
+// Reloader keeps server certificate and CA bundle of clients and re-reads them
+// when files change on disk, so rotated certificates apply without restart.
+// Connections which are already established keep the previous certificate
+type Reloader struct {
+	log      *slog.Logger
+	cfg      config.TLS
+	current  atomic.Pointer[bundle]
+	modified string
+}
+
+type bundle struct {
+	cert      *tls.Certificate
+	clientCAs *x509.CertPool
+}
+
+func New(log *slog.Logger, cfg config.TLS) (*Reloader, error) {
+	const op = "tlsreload.New"
+
+	if cfg.CertFile == "" || cfg.KeyFile == "" {
+		return nil, fmt.Errorf("%s: both cert_file and key_file are required", op)
+	}
+	if cfg.ReloadInterval <= 0 {
+		return nil, fmt.Errorf("%s: reload_interval must be positive", op)
+	}
+	if cfg.RequireClientCert && cfg.ClientCAFile == "" {
+		return nil, fmt.Errorf("%s: require_client_cert needs client_ca_file", op)
+	}
+
+	r := &Reloader{
+		log: log.With(
+			slog.String("component", "tlsreload"),
+		),
+		cfg: cfg,
+	}
+	if err := r.load(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return r, nil
+}
+
+// Config returns TLS config of servers which always uses the latest loaded files
+func (r *Reloader) Config() *tls.Config {
+	cfg := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		GetCertificate: func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+			return r.current.Load().cert, nil
+		},
+	}
+
+	if r.cfg.ClientCAFile != "" {
+		// Chain is verified here rather than by ClientCAs, which could not be replaced
+		// without rebuilding the config. Unlike VerifyPeerCertificate, VerifyConnection
+		// also runs on resumed sessions, so a CA removed from the bundle stops them too
+		cfg.ClientAuth = tls.RequestClientCert
+		if r.cfg.RequireClientCert {
+			cfg.ClientAuth = tls.RequireAnyClientCert
+		}
+		cfg.VerifyConnection = r.verifyClient
+	}
+
+	return cfg
+}
+
+// Run checks files for changes every interval until context is done
+func (r *Reloader) Run(ctx context.Context) {
+	ticker := time.NewTicker(r.cfg.ReloadInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if r.stamp() == r.modified {
+				continue
+			}
+			// Files may be replaced one by one, a broken pair is retried on the next tick
+			if err := r.load(); err != nil {
+				r.log.Error("failed to reload certificates, previous ones are kept", logger.Err(err))
+				continue
+			}
+			r.log.Info("certificates are reloaded")
+		}
+	}
+}
+
+func (r *Reloader) load() error {
+	stamp := r.stamp()
+
+	cert, err := tls.LoadX509KeyPair(r.cfg.CertFile, r.cfg.KeyFile)
+	if err != nil {
+		return fmt.Errorf("cannot load certificate: %w", err)
+	}
+
+	b := &bundle{cert: &cert}
+	if r.cfg.ClientCAFile != "" {
+		pem, err := os.ReadFile(r.cfg.ClientCAFile)
+		if err != nil {
+			return fmt.Errorf("cannot read client CA bundle: %w", err)
+		}
+		b.clientCAs = x509.NewCertPool()
+		if !b.clientCAs.AppendCertsFromPEM(pem) {
+			return errors.New("client CA bundle has no certificates")
+		}
+	}
+
+	r.current.Store(b)
+	r.modified = stamp
+
+	return nil
+}
+
+// stamp describes size and modification time of files, symlinks are followed
+// as mounted secrets are swapped by replacing the link
+func (r *Reloader) stamp() string {
+	var stamp string
+	for _, path := range []string{r.cfg.CertFile, r.cfg.KeyFile, r.cfg.ClientCAFile} {
+		if path == "" {
+			continue
+		}
+		info, err := os.Stat(path)
+		if err != nil {
+			stamp += path + ":missing;"
+			continue
+		}
+		stamp += fmt.Sprintf("%s:%d:%d;", path, info.Size(), info.ModTime().UnixNano())
+	}
+
+	return stamp
+}
+
+func (r *Reloader) verifyClient(cs tls.ConnectionState) error {
+	// Without certificate client has to use other credentials
+	if len(cs.PeerCertificates) == 0 {
+		return nil
+	}
+
+	opts := x509.VerifyOptions{
+		Roots:         r.current.Load().clientCAs,
+		Intermediates: x509.NewCertPool(),
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	for _, cert := range cs.PeerCertificates[1:] {
+		opts.Intermediates.AddCert(cert)
+	}
+
+	if _, err := cs.PeerCertificates[0].Verify(opts); err != nil {
+		return fmt.Errorf("client certificate is not trusted: %w", err)
+	}
+
+	return nil
+}
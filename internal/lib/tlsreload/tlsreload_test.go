@@ -0,0 +1,307 @@
+package tlsreload_test
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/m1al04949/avito-tech-service/internal/config"
+	"github.com/m1al04949/avito-tech-service/internal/lib/tlsreload"
+	"github.com/m1al04949/avito-tech-service/pkg/slogdiscard"
+	"github.com/stretchr/testify/require"
+)
+
+func TestServerCertificateReload(t *testing.T) {
+	dir := t.TempDir()
+	ca := newCA(t, "test-ca")
+	cfg := config.TLS{
+		CertFile:       filepath.Join(dir, "tls.crt"),
+		KeyFile:        filepath.Join(dir, "tls.key"),
+		ReloadInterval: 10 * time.Millisecond,
+	}
+	ca.issue(t, "server-1", x509.ExtKeyUsageServerAuth).write(t, cfg.CertFile, cfg.KeyFile)
+
+	r, err := tlsreload.New(slogdiscard.NewDiscardLogger(), cfg)
+	require.NoError(t, err)
+
+	client := &tls.Config{RootCAs: ca.pool(), ServerName: "localhost"}
+
+	_, state, err := handshake(r.Config(), client)
+	require.NoError(t, err)
+	require.Equal(t, "server-1", state.PeerCertificates[0].Subject.CommonName)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go r.Run(ctx)
+
+	// Broken pair keeps the previous certificate
+	require.NoError(t, os.WriteFile(cfg.KeyFile, []byte("garbage"), 0o600))
+	time.Sleep(50 * time.Millisecond)
+	_, state, err = handshake(r.Config(), client)
+	require.NoError(t, err)
+	require.Equal(t, "server-1", state.PeerCertificates[0].Subject.CommonName)
+
+	ca.issue(t, "server-2", x509.ExtKeyUsageServerAuth).write(t, cfg.CertFile, cfg.KeyFile)
+	require.Eventually(t, func() bool {
+		_, state, err := handshake(r.Config(), client)
+		return err == nil && state.PeerCertificates[0].Subject.CommonName == "server-2"
+	}, time.Second, 10*time.Millisecond)
+}
+
+func TestClientCertificates(t *testing.T) {
+	dir := t.TempDir()
+	ca := newCA(t, "clients-ca")
+	other := newCA(t, "other-ca")
+
+	cfg := config.TLS{
+		CertFile:       filepath.Join(dir, "tls.crt"),
+		KeyFile:        filepath.Join(dir, "tls.key"),
+		ClientCAFile:   filepath.Join(dir, "ca.crt"),
+		ReloadInterval: time.Minute,
+	}
+	ca.issue(t, "localhost", x509.ExtKeyUsageServerAuth).write(t, cfg.CertFile, cfg.KeyFile)
+	require.NoError(t, os.WriteFile(cfg.ClientCAFile, ca.certPEM, 0o600))
+
+	trusted := ca.issue(t, "billing", x509.ExtKeyUsageClientAuth).keyPair(t)
+	serverOnly := ca.issue(t, "web", x509.ExtKeyUsageServerAuth).keyPair(t)
+	untrusted := other.issue(t, "billing", x509.ExtKeyUsageClientAuth).keyPair(t)
+
+	client := func(certs ...tls.Certificate) *tls.Config {
+		return &tls.Config{RootCAs: ca.pool(), ServerName: "localhost", Certificates: certs}
+	}
+
+	t.Run("optional", func(t *testing.T) {
+		r, err := tlsreload.New(slogdiscard.NewDiscardLogger(), cfg)
+		require.NoError(t, err)
+
+		state, _, err := handshake(r.Config(), client())
+		require.NoError(t, err)
+		require.Empty(t, state.PeerCertificates)
+
+		state, _, err = handshake(r.Config(), client(trusted))
+		require.NoError(t, err)
+		require.Equal(t, "billing", state.PeerCertificates[0].Subject.CommonName)
+
+		_, _, err = handshake(r.Config(), client(untrusted))
+		require.Error(t, err)
+
+		_, _, err = handshake(r.Config(), client(serverOnly))
+		require.Error(t, err)
+	})
+
+	t.Run("required", func(t *testing.T) {
+		cfg := cfg
+		cfg.RequireClientCert = true
+
+		r, err := tlsreload.New(slogdiscard.NewDiscardLogger(), cfg)
+		require.NoError(t, err)
+
+		_, _, err = handshake(r.Config(), client())
+		require.Error(t, err)
+
+		_, _, err = handshake(r.Config(), client(trusted))
+		require.NoError(t, err)
+	})
+}
+
+func TestClientCAReloadStopsResumedSessions(t *testing.T) {
+	dir := t.TempDir()
+	ca := newCA(t, "clients-ca")
+	other := newCA(t, "other-ca")
+
+	cfg := config.TLS{
+		CertFile:       filepath.Join(dir, "tls.crt"),
+		KeyFile:        filepath.Join(dir, "tls.key"),
+		ClientCAFile:   filepath.Join(dir, "ca.crt"),
+		ReloadInterval: 10 * time.Millisecond,
+	}
+	ca.issue(t, "localhost", x509.ExtKeyUsageServerAuth).write(t, cfg.CertFile, cfg.KeyFile)
+	require.NoError(t, os.WriteFile(cfg.ClientCAFile, ca.certPEM, 0o600))
+
+	r, err := tlsreload.New(slogdiscard.NewDiscardLogger(), cfg)
+	require.NoError(t, err)
+	server := r.Config()
+
+	client := &tls.Config{
+		RootCAs:            ca.pool(),
+		ServerName:         "localhost",
+		Certificates:       []tls.Certificate{ca.issue(t, "billing", x509.ExtKeyUsageClientAuth).keyPair(t)},
+		ClientSessionCache: tls.NewLRUClientSessionCache(8),
+	}
+
+	state, _, err := handshake(server, client)
+	require.NoError(t, err)
+	require.False(t, state.DidResume)
+
+	state, _, err = handshake(server, client)
+	require.NoError(t, err)
+	require.True(t, state.DidResume)
+	require.Equal(t, "billing", state.PeerCertificates[0].Subject.CommonName)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go r.Run(ctx)
+
+	// CA of the client is dropped from the bundle, its sessions must not resume
+	require.NoError(t, os.WriteFile(cfg.ClientCAFile, other.certPEM, 0o600))
+	require.Eventually(t, func() bool {
+		_, _, err := handshake(server, client)
+		return err != nil
+	}, time.Second, 10*time.Millisecond)
+}
+
+func TestNewValidates(t *testing.T) {
+	log := slogdiscard.NewDiscardLogger()
+
+	_, err := tlsreload.New(log, config.TLS{CertFile: "tls.crt", ReloadInterval: time.Second})
+	require.Error(t, err)
+
+	_, err = tlsreload.New(log, config.TLS{
+		CertFile: "tls.crt", KeyFile: "tls.key", RequireClientCert: true, ReloadInterval: time.Second,
+	})
+	require.Error(t, err)
+
+	_, err = tlsreload.New(log, config.TLS{
+		CertFile: "missing.crt", KeyFile: "missing.key", ReloadInterval: time.Second,
+	})
+	require.Error(t, err)
+}
+
+// handshake connects client to server over loopback and returns states seen by both sides.
+// Error is of the server, which is the side rejecting client certificates
+func handshake(server, client *tls.Config) (tls.ConnectionState, tls.ConnectionState, error) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return tls.ConnectionState{}, tls.ConnectionState{}, err
+	}
+	defer lis.Close()
+
+	clientState := make(chan tls.ConnectionState, 1)
+	go func() {
+		conn, err := tls.Dial("tcp", lis.Addr().String(), client)
+		if err != nil {
+			clientState <- tls.ConnectionState{}
+			return
+		}
+		defer conn.Close()
+		// Session tickets of TLS 1.3 are received after handshake, read until server closes
+		_ = conn.SetDeadline(time.Now().Add(5 * time.Second))
+		_, _ = conn.Read(make([]byte, 1))
+		clientState <- conn.ConnectionState()
+	}()
+
+	conn, err := lis.Accept()
+	if err != nil {
+		return tls.ConnectionState{}, tls.ConnectionState{}, err
+	}
+	srv := tls.Server(conn, server)
+	_ = srv.SetDeadline(time.Now().Add(5 * time.Second))
+
+	err = srv.Handshake()
+	state := srv.ConnectionState()
+	srv.Close()
+
+	return state, <-clientState, err
+}
+
+type authority struct {
+	cert    *x509.Certificate
+	key     *ecdsa.PrivateKey
+	certPEM []byte
+}
+
+type issued struct {
+	certPEM []byte
+	keyPEM  []byte
+}
+
+func newCA(t *testing.T, cn string) *authority {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: cn},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+
+	return &authority{
+		cert:    cert,
+		key:     key,
+		certPEM: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+	}
+}
+
+func (a *authority) pool() *x509.CertPool {
+	pool := x509.NewCertPool()
+	pool.AddCert(a.cert)
+
+	return pool
+}
+
+func (a *authority) issue(t *testing.T, cn string, usage x509.ExtKeyUsage) issued {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	serial, err := rand.Int(rand.Reader, big.NewInt(1<<62))
+	require.NoError(t, err)
+
+	tmpl := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: cn},
+		DNSNames:     []string{"localhost"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{usage},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, a.cert, &key.PublicKey, a.key)
+	require.NoError(t, err)
+
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+
+	return issued{
+		certPEM: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		keyPEM:  pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}),
+	}
+}
+
+func (i issued) write(t *testing.T, certFile, keyFile string) {
+	t.Helper()
+
+	require.NoError(t, os.WriteFile(certFile, i.certPEM, 0o600))
+	require.NoError(t, os.WriteFile(keyFile, i.keyPEM, 0o600))
+}
+
+func (i issued) keyPair(t *testing.T) tls.Certificate {
+	t.Helper()
+
+	cert, err := tls.X509KeyPair(i.certPEM, i.keyPEM)
+	require.NoError(t, err)
+
+	return cert
+}
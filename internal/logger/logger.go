@@ -1,9 +1,11 @@
 package logger
 
 import (
+	"context"
 	"os"
 
 	"github.com/m1al04949/avito-tech-service/pkg/slogpretty"
+	"go.opentelemetry.io/otel/trace"
 	"golang.org/x/exp/slog"
 )
 
@@ -51,3 +53,14 @@ func Err(err error) slog.Attr {
 		Value: slog.StringValue(err.Error()),
 	}
 }
+
+// Trace is ID of the trace of ctx, so records of a request can be found from its trace.
+// Without a trace the attr is empty and ignored by handlers
+func Trace(ctx context.Context) slog.Attr {
+	sc := trace.SpanContextFromContext(ctx)
+	if !sc.HasTraceID() {
+		return slog.Attr{}
+	}
+
+	return slog.String("trace_id", sc.TraceID().String())
+}
@@ -0,0 +1,125 @@
+// Package metrics exposes Prometheus metrics of HTTP API, storage and segmentation.
+package metrics
+
+import (
+	"database/sql"
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "segmentation"
+
+type Metrics struct {
+	registry *prometheus.Registry
+
+	httpRequests *prometheus.CounterVec
+	httpDuration *prometheus.HistogramVec
+
+	storageDuration *prometheus.HistogramVec
+
+	segmentsCreated    prometheus.Counter
+	segmentsDeleted    prometheus.Counter
+	usersCreated       prometheus.Counter
+	usersDeleted       prometheus.Counter
+	membershipsAdded   *prometheus.CounterVec
+	membershipsRemoved *prometheus.CounterVec
+	membershipsExpired prometheus.Counter
+}
+
+// Get instance with its own registry, which also has Go runtime and process metrics
+func New() *Metrics {
+	m := &Metrics{
+		registry: prometheus.NewRegistry(),
+
+		httpRequests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "http_requests_total",
+			Help:      "HTTP requests by route pattern, method and status.",
+		}, []string{"route", "method", "status"}),
+		httpDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "http_request_duration_seconds",
+			Help:      "Duration of HTTP requests by route pattern, method and status.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"route", "method", "status"}),
+
+		storageDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "storage_operation_duration_seconds",
+			Help:      "Duration of storage operations by operation and result.",
+			Buckets:   []float64{.001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10},
+		}, []string{"operation", "result"}),
+
+		segmentsCreated: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "segments_created_total",
+			Help:      "Segments created.",
+		}),
+		segmentsDeleted: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "segments_deleted_total",
+			Help:      "Segments deleted.",
+		}),
+		usersCreated: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "users_created_total",
+			Help:      "Users created.",
+		}),
+		usersDeleted: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "users_deleted_total",
+			Help:      "Users deleted.",
+		}),
+		membershipsAdded: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "memberships_added_total",
+			Help:      "Users added to segment by API, without automatic enrollment.",
+		}, []string{"segment"}),
+		membershipsRemoved: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "memberships_removed_total",
+			Help:      "Users removed from segment by API.",
+		}, []string{"segment"}),
+		membershipsExpired: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "memberships_expired_total",
+			Help:      "Expired memberships deleted by reaper.",
+		}),
+	}
+
+	m.registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		m.httpRequests,
+		m.httpDuration,
+		m.storageDuration,
+		m.segmentsCreated,
+		m.segmentsDeleted,
+		m.usersCreated,
+		m.usersDeleted,
+		m.membershipsAdded,
+		m.membershipsRemoved,
+		m.membershipsExpired,
+	)
+
+	return m
+}
+
+// Handler serves metrics in Prometheus exposition format
+func (m *Metrics) Handler() http.Handler {
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{})
+}
+
+// ObserveHTTP records completed HTTP request, route must be a pattern and not a raw path
+func (m *Metrics) ObserveHTTP(route, method, status string, seconds float64) {
+	m.httpRequests.WithLabelValues(route, method, status).Inc()
+	m.httpDuration.WithLabelValues(route, method, status).Observe(seconds)
+}
+
+// RegisterDB exposes connection pool stats of DB
+func (m *Metrics) RegisterDB(db *sql.DB, name string) {
+	m.registry.MustRegister(collectors.NewDBStatsCollector(db, name))
+}
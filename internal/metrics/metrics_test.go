@@ -0,0 +1,91 @@
+package metrics_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/m1al04949/avito-tech-service/internal/app"
+	"github.com/m1al04949/avito-tech-service/internal/auth"
+	"github.com/m1al04949/avito-tech-service/internal/config"
+	"github.com/m1al04949/avito-tech-service/internal/health"
+	"github.com/m1al04949/avito-tech-service/internal/metrics"
+	"github.com/m1al04949/avito-tech-service/internal/storage/memory"
+	"github.com/m1al04949/avito-tech-service/pkg/slogdiscard"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMetrics(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.HTTPServer.User = "myuser"
+	cfg.HTTPServer.Password = "mypass"
+
+	m := metrics.New()
+	store := m.Storage(memory.New())
+	sizes, err := m.RegisterSegmentSizes(slogdiscard.NewDiscardLogger(), store, 10*time.Millisecond)
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go sizes.Run(ctx)
+
+	authenticator, err := auth.New(cfg.HTTPServer)
+	require.NoError(t, err)
+
+	router := app.NewRouter(slogdiscard.NewDiscardLogger(), cfg, store, &health.Readiness{}, m, authenticator)
+
+	call := func(method, path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.SetBasicAuth("myuser", "mypass")
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		return rr
+	}
+
+	require.Equal(t, http.StatusOK, call(http.MethodPost, "/api/v1/segments", `{"slug":"AVITO_VOICE"}`).Code)
+	for _, user := range []string{"1000", "1001"} {
+		require.Equal(t, http.StatusOK, call(http.MethodPut, "/api/v1/users/"+user, "").Code)
+		require.Equal(t, http.StatusOK,
+			call(http.MethodPost, "/api/v1/users/"+user+"/segments", `{"segments":[{"slug":"AVITO_VOICE"}]}`).Code)
+	}
+	require.Equal(t, http.StatusOK,
+		call(http.MethodDelete, "/api/v1/users/1001/segments?slug=AVITO_VOICE", "").Code)
+	require.Equal(t, http.StatusNotFound, call(http.MethodGet, "/api/v1/users/1002", "").Code)
+	call("FOO", "/api/v1/users/1000", "")
+	call("BAR", "/api/v1/users/1000", "")
+
+	// Sizes are counted in background
+	var text string
+	require.Eventually(t, func() bool {
+		rr := call(http.MethodGet, "/metrics", "")
+		text = rr.Body.String()
+		return rr.Code == http.StatusOK && strings.Contains(text, `segmentation_segment_users{segment="AVITO_VOICE"} 1`)
+	}, time.Second, 10*time.Millisecond)
+
+	for _, line := range []string{
+		`segmentation_http_requests_total{method="PUT",route="/api/v1/users/{id}",status="200"} 2`,
+		`segmentation_http_requests_total{method="GET",route="/api/v1/users/{id}",status="404"} 1`,
+		`segmentation_storage_operation_duration_seconds_count{operation="storage.SaveUser",result="ok"} 2`,
+		`segmentation_storage_operation_duration_seconds_count{operation="storage.GetUser",result="error"} 1`,
+		`segmentation_segments_created_total 1`,
+		`segmentation_users_created_total 2`,
+		`segmentation_memberships_added_total{segment="AVITO_VOICE"} 2`,
+		`segmentation_memberships_removed_total{segment="AVITO_VOICE"} 1`,
+		`segmentation_segment_users{segment="AVITO_VOICE"} 1`,
+	} {
+		require.Contains(t, text, line)
+	}
+
+	// Raw paths and unknown methods never become labels
+	require.NotContains(t, text, `route="/api/v1/users/1000"`)
+	require.NotContains(t, text, `method="FOO"`)
+	require.Regexp(t, `segmentation_http_requests_total\{method="OTHER",route="[^"]+",status="405"\} 2`, text)
+}
+
+func TestSegmentSizesInterval(t *testing.T) {
+	_, err := metrics.New().RegisterSegmentSizes(slogdiscard.NewDiscardLogger(), memory.New(), 0)
+	require.Error(t, err)
+}
@@ -0,0 +1,119 @@
+package metrics
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/m1al04949/avito-tech-service/internal/logger"
+	"github.com/m1al04949/avito-tech-service/internal/model"
+	"github.com/prometheus/client_golang/prometheus"
+	"golang.org/x/exp/slog"
+)
+
+const (
+	// Limit of segment sizes query
+	segmentSizesTimeout = 30 * time.Second
+	segmentSizesPage    = 1000
+)
+
+type SegmLister interface {
+	ListSegms(ctx context.Context, filter model.SegmentsFilter) ([]model.Segments, error)
+}
+
+// SegmentSizes is current number of users in every segment. Counting reads the whole
+// memberships table, so it is done every interval in background and scrapes get the last result
+type SegmentSizes struct {
+	log      *slog.Logger
+	lister   SegmLister
+	interval time.Duration
+	desc     *prometheus.Desc
+
+	sizes atomic.Pointer[[]model.Segments]
+}
+
+// RegisterSegmentSizes exposes current number of active users of every segment,
+// which is counted by Run
+func (m *Metrics) RegisterSegmentSizes(log *slog.Logger, lister SegmLister, interval time.Duration) (
+	*SegmentSizes, error) {
+	const op = "metrics.RegisterSegmentSizes"
+
+	if interval <= 0 {
+		return nil, fmt.Errorf("%s: interval must be positive", op)
+	}
+
+	c := &SegmentSizes{
+		log: log.With(
+			slog.String("component", "metrics"),
+		),
+		lister:   lister,
+		interval: interval,
+		desc: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "segment_users"),
+			"Users in segment, without expired memberships.",
+			[]string{"segment"}, nil,
+		),
+	}
+	m.registry.MustRegister(c)
+
+	return c, nil
+}
+
+// Run counts users of segments every interval until context is done.
+// Failed count keeps the previous values
+func (c *SegmentSizes) Run(ctx context.Context) {
+	ticker := time.NewTicker(c.interval)
+	defer ticker.Stop()
+
+	for {
+		if err := c.count(ctx); err != nil && ctx.Err() == nil {
+			c.log.Error("failed to count users of segments", logger.Err(err))
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (c *SegmentSizes) count(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, segmentSizesTimeout)
+	defer cancel()
+
+	var sizes []model.Segments
+	filter := model.SegmentsFilter{SortBy: model.SortByName, Limit: segmentSizesPage}
+	for {
+		segments, err := c.lister.ListSegms(ctx, filter)
+		if err != nil {
+			return err
+		}
+		sizes = append(sizes, segments...)
+
+		if len(segments) < segmentSizesPage {
+			break
+		}
+		filter.After = &segments[len(segments)-1]
+	}
+
+	c.sizes.Store(&sizes)
+
+	return nil
+}
+
+func (c *SegmentSizes) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.desc
+}
+
+func (c *SegmentSizes) Collect(ch chan<- prometheus.Metric) {
+	sizes := c.sizes.Load()
+	if sizes == nil {
+		return
+	}
+
+	for _, s := range *sizes {
+		ch <- prometheus.MustNewConstMetric(c.desc, prometheus.GaugeValue, float64(s.Users), s.SegmentName)
+	}
+}
@@ -0,0 +1,180 @@
+package metrics
+
+import (
+	"context"
+	"time"
+
+	"github.com/m1al04949/avito-tech-service/internal/model"
+	"github.com/m1al04949/avito-tech-service/internal/storage"
+)
+
+const (
+	resultOK    = "ok"
+	resultError = "error"
+)
+
+type instrumentedRepository struct {
+	repo storage.Repository
+	m    *Metrics
+}
+
+// Storage wraps repo so latency of every operation and segmentation events are recorded
+func (m *Metrics) Storage(repo storage.Repository) storage.Repository {
+	return &instrumentedRepository{
+		repo: repo,
+		m:    m,
+	}
+}
+
+func (r *instrumentedRepository) observe(op string, start time.Time, err *error) {
+	result := resultOK
+	if *err != nil {
+		result = resultError
+	}
+
+	r.m.storageDuration.WithLabelValues(op, result).Observe(time.Since(start).Seconds())
+}
+
+// Count memberships changed by API
+func (r *instrumentedRepository) countResults(results []model.SegmentResult) {
+	for _, res := range results {
+		switch res.Result {
+		case model.ResultAdded:
+			r.m.membershipsAdded.WithLabelValues(res.Slug).Inc()
+		case model.ResultRemoved:
+			r.m.membershipsRemoved.WithLabelValues(res.Slug).Inc()
+		}
+	}
+}
+
+func (r *instrumentedRepository) SaveSegm(ctx context.Context, segmToSave string, autoPercent int) (err error) {
+	defer r.observe("storage.SaveSegm", time.Now(), &err)
+
+	err = r.repo.SaveSegm(ctx, segmToSave, autoPercent)
+	if err == nil {
+		r.m.segmentsCreated.Inc()
+	}
+
+	return err
+}
+
+func (r *instrumentedRepository) DeleteSegm(ctx context.Context, segmToDelete string) (err error) {
+	defer r.observe("storage.DeleteSegm", time.Now(), &err)
+
+	err = r.repo.DeleteSegm(ctx, segmToDelete)
+	if err == nil {
+		r.m.segmentsDeleted.Inc()
+		r.m.membershipsAdded.DeleteLabelValues(segmToDelete)
+		r.m.membershipsRemoved.DeleteLabelValues(segmToDelete)
+	}
+
+	return err
+}
+
+func (r *instrumentedRepository) GetSegm(ctx context.Context, segment string) (m model.Segments, err error) {
+	defer r.observe("storage.GetSegm", time.Now(), &err)
+
+	return r.repo.GetSegm(ctx, segment)
+}
+
+func (r *instrumentedRepository) ListSegms(ctx context.Context, filter model.SegmentsFilter) (
+	segments []model.Segments, err error) {
+	defer r.observe("storage.ListSegms", time.Now(), &err)
+
+	return r.repo.ListSegms(ctx, filter)
+}
+
+func (r *instrumentedRepository) GetSegmUsers(ctx context.Context, segment string, after, limit int) (
+	users []int, err error) {
+	defer r.observe("storage.GetSegmUsers", time.Now(), &err)
+
+	return r.repo.GetSegmUsers(ctx, segment, after, limit)
+}
+
+func (r *instrumentedRepository) StreamSegmUsers(ctx context.Context, segment string, fn func(user int) error) (err error) {
+	defer r.observe("storage.StreamSegmUsers", time.Now(), &err)
+
+	return r.repo.StreamSegmUsers(ctx, segment, fn)
+}
+
+func (r *instrumentedRepository) SaveUser(ctx context.Context, userToSave int) (err error) {
+	defer r.observe("storage.SaveUser", time.Now(), &err)
+
+	err = r.repo.SaveUser(ctx, userToSave)
+	if err == nil {
+		r.m.usersCreated.Inc()
+	}
+
+	return err
+}
+
+func (r *instrumentedRepository) DeleteUser(ctx context.Context, userToDelete int) (err error) {
+	defer r.observe("storage.DeleteUser", time.Now(), &err)
+
+	err = r.repo.DeleteUser(ctx, userToDelete)
+	if err == nil {
+		r.m.usersDeleted.Inc()
+	}
+
+	return err
+}
+
+func (r *instrumentedRepository) GetUser(ctx context.Context, user int) (segments []string, err error) {
+	defer r.observe("storage.GetUser", time.Now(), &err)
+
+	return r.repo.GetUser(ctx, user)
+}
+
+func (r *instrumentedRepository) SaveSegmToUser(ctx context.Context, user int, segments []model.UserSegments) (
+	results []model.SegmentResult, err error) {
+	defer r.observe("storage.SaveSegmToUser", time.Now(), &err)
+
+	results, err = r.repo.SaveSegmToUser(ctx, user, segments)
+	if err == nil {
+		r.countResults(results)
+	}
+
+	return results, err
+}
+
+func (r *instrumentedRepository) DeleteSegmFromUser(ctx context.Context, user int, segments []string) (
+	results []model.SegmentResult, err error) {
+	defer r.observe("storage.DeleteSegmFromUser", time.Now(), &err)
+
+	results, err = r.repo.DeleteSegmFromUser(ctx, user, segments)
+	if err == nil {
+		r.countResults(results)
+	}
+
+	return results, err
+}
+
+func (r *instrumentedRepository) UpdateUserSegments(ctx context.Context, user int, add []model.UserSegments, remove []string) (
+	segments []string, results []model.SegmentResult, err error) {
+	defer r.observe("storage.UpdateUserSegments", time.Now(), &err)
+
+	segments, results, err = r.repo.UpdateUserSegments(ctx, user, add, remove)
+	if err == nil {
+		r.countResults(results)
+	}
+
+	return segments, results, err
+}
+
+func (r *instrumentedRepository) GetHistory(ctx context.Context, from, to time.Time) (
+	history []model.UserSegmentsHistory, err error) {
+	defer r.observe("storage.GetHistory", time.Now(), &err)
+
+	return r.repo.GetHistory(ctx, from, to)
+}
+
+func (r *instrumentedRepository) DeleteExpired(ctx context.Context) (deleted int, err error) {
+	defer r.observe("storage.DeleteExpired", time.Now(), &err)
+
+	deleted, err = r.repo.DeleteExpired(ctx)
+	if err == nil {
+		r.m.membershipsExpired.Add(float64(deleted))
+	}
+
+	return deleted, err
+}
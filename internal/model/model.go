@@ -3,8 +3,25 @@ package model
 import "time"
 
 type Segments struct {
-	SegmentName string
-	CreatedAt   time.Time
+	SegmentName string    `json:"slug"`
+	AutoPercent int       `json:"auto_percent"`
+	CreatedAt   time.Time `json:"created_at"`
+	Users       int       `json:"users"`
+}
+
+const (
+	SortByName      = "name"
+	SortByCreatedAt = "created_at"
+	SortBySize      = "size"
+)
+
+type SegmentsFilter struct {
+	Prefix string
+	SortBy string
+	Desc   bool
+	Limit  int
+	// Last segment of previous page, nil for the first page
+	After *Segments
 }
 
 type Users struct {
@@ -15,8 +32,36 @@ type Users struct {
 type UserSegments struct {
 	UserID      int
 	SegmentName string
+	ExpiresAt   *time.Time
+}
+
+const (
+	OperationAdd    = "add"
+	OperationRemove = "remove"
+)
+
+type UserSegmentsHistory struct {
+	UserID      int
+	SegmentName string
+	Operation   string
+	CreatedAt   time.Time
 }
 
 type Segment struct {
-	Slug string `json:"slug,omitempty"`
+	Slug      string     `json:"slug,omitempty"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+	TTL       string     `json:"ttl,omitempty"`
+}
+
+const (
+	ResultAdded          = "added"
+	ResultAlreadyMember  = "already_member"
+	ResultUnknownSegment = "unknown_segment"
+	ResultRemoved        = "removed"
+	ResultNotMember      = "not_member"
+)
+
+type SegmentResult struct {
+	Slug   string `json:"slug"`
+	Result string `json:"result"`
 }
@@ -0,0 +1,100 @@
+package reaper
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/m1al04949/avito-tech-service/internal/logger"
+	"golang.org/x/exp/slog"
+)
+
+type ExpiredDeleter interface {
+	DeleteExpired(ctx context.Context) (int, error)
+}
+
+// Reaper periodically deletes expired segment memberships
+type Reaper struct {
+	log      *slog.Logger
+	deleter  ExpiredDeleter
+	interval time.Duration
+
+	running atomic.Bool
+	// Unix nanoseconds of the last successful run or of the start
+	lastSuccess atomic.Int64
+}
+
+// Reaper is unhealthy if it has not deleted expired memberships for this many intervals
+const unhealthyIntervals = 3
+
+var ErrNotRunning = errors.New("reaper is not running")
+
+// Get instance
+func New(log *slog.Logger, deleter ExpiredDeleter, interval time.Duration) (*Reaper, error) {
+	const op = "reaper.New"
+
+	if interval <= 0 {
+		return nil, fmt.Errorf("%s: interval must be positive", op)
+	}
+
+	return &Reaper{
+		log: log.With(
+			slog.String("component", "reaper"),
+		),
+		deleter:  deleter,
+		interval: interval,
+	}, nil
+}
+
+// Run deletes expired memberships every interval until context is done
+func (rp *Reaper) Run(ctx context.Context) {
+	rp.log.Info("reaper started", slog.String("interval", rp.interval.String()))
+
+	rp.lastSuccess.Store(time.Now().UnixNano())
+	rp.running.Store(true)
+	defer rp.running.Store(false)
+
+	ticker := time.NewTicker(rp.interval)
+	defer ticker.Stop()
+
+	for {
+		rp.reap(ctx)
+
+		select {
+		case <-ctx.Done():
+			rp.log.Info("reaper stopped")
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (rp *Reaper) reap(ctx context.Context) {
+	deleted, err := rp.deleter.DeleteExpired(ctx)
+	if err != nil {
+		rp.log.Error("failed to delete expired segments", logger.Err(err))
+		return
+	}
+
+	rp.lastSuccess.Store(time.Now().UnixNano())
+
+	if deleted > 0 {
+		rp.log.Info("expired segments deleted", slog.Int("deleted", deleted))
+	}
+}
+
+// Check reports whether reaper is running and deletes expired memberships
+func (rp *Reaper) Check(_ context.Context) error {
+	if !rp.running.Load() {
+		return ErrNotRunning
+	}
+
+	since := time.Since(time.Unix(0, rp.lastSuccess.Load()))
+	if since > unhealthyIntervals*rp.interval {
+		return fmt.Errorf("no successful run for %s", since.Round(time.Second))
+	}
+
+	return nil
+}
@@ -0,0 +1,40 @@
+package reaper_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/m1al04949/avito-tech-service/internal/reaper"
+	"github.com/m1al04949/avito-tech-service/internal/storage/memory"
+	"github.com/m1al04949/avito-tech-service/pkg/slogdiscard"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewRejectsInterval(t *testing.T) {
+	for _, interval := range []time.Duration{0, -time.Minute} {
+		_, err := reaper.New(slogdiscard.NewDiscardLogger(), memory.New(), interval)
+		require.Error(t, err)
+	}
+}
+
+func TestCheck(t *testing.T) {
+	rp, err := reaper.New(slogdiscard.NewDiscardLogger(), memory.New(), 10*time.Millisecond)
+	require.NoError(t, err)
+	require.ErrorIs(t, rp.Check(context.Background()), reaper.ErrNotRunning)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		rp.Run(ctx)
+	}()
+
+	require.Eventually(t, func() bool {
+		return rp.Check(context.Background()) == nil
+	}, time.Second, 10*time.Millisecond)
+
+	cancel()
+	<-done
+	require.ErrorIs(t, rp.Check(context.Background()), reaper.ErrNotRunning)
+}
@@ -0,0 +1,546 @@
+// Package memory is an in-memory implementation of storage.Repository
+// with the same semantics as Postgres storage. Data is lost on restart.
+package memory
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/m1al04949/avito-tech-service/internal/lib/sampling"
+	"github.com/m1al04949/avito-tech-service/internal/model"
+	"github.com/m1al04949/avito-tech-service/internal/storage"
+)
+
+type Storage struct {
+	mu sync.RWMutex
+
+	segments map[string]model.Segments
+	users    map[int]time.Time
+	// Memberships by segment and user with optional expiration
+	members map[string]map[int]*time.Time
+	history []model.UserSegmentsHistory
+}
+
+var _ storage.Repository = (*Storage)(nil)
+
+// Get instance
+func New() *Storage {
+	return &Storage{
+		segments: make(map[string]model.Segments),
+		users:    make(map[int]time.Time),
+		members:  make(map[string]map[int]*time.Time),
+	}
+}
+
+// Save Segment, enrolling autoPercent of existing users into it
+func (s *Storage) SaveSegm(ctx context.Context, segmToSave string, autoPercent int) error {
+	const op = "memory.SaveSegm"
+
+	if err := ctx.Err(); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if m, ok := s.segments[segmToSave]; ok {
+		return fmt.Errorf("%s: %w, created at %s", op, storage.ErrSegmentExists, m.CreatedAt)
+	}
+
+	now := time.Now()
+
+	s.segments[segmToSave] = model.Segments{
+		SegmentName: segmToSave,
+		AutoPercent: autoPercent,
+		CreatedAt:   now.UTC(),
+	}
+	s.members[segmToSave] = make(map[int]*time.Time)
+
+	if autoPercent > 0 {
+		for user := range s.users {
+			if sampling.InPercent(user, segmToSave, autoPercent) {
+				s.saveUserSegm(user, segmToSave, nil, now)
+			}
+		}
+	}
+
+	return nil
+}
+
+// Delete Segment
+func (s *Storage) DeleteSegm(ctx context.Context, segmToDelete string) error {
+	const op = "memory.DeleteSegm"
+
+	if err := ctx.Err(); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.segments[segmToDelete]; !ok {
+		return fmt.Errorf("%s: %w", op, storage.ErrSegmentNotExists)
+	}
+	// Memberships reference the segment until they are deleted, even expired ones
+	if len(s.members[segmToDelete]) > 0 {
+		return fmt.Errorf("%s: %w", op, storage.ErrSegmentDelete)
+	}
+
+	delete(s.segments, segmToDelete)
+	delete(s.members, segmToDelete)
+
+	return nil
+}
+
+// Get Segment
+func (s *Storage) GetSegm(ctx context.Context, segment string) (model.Segments, error) {
+	const op = "memory.getsegment"
+
+	if err := ctx.Err(); err != nil {
+		return model.Segments{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	m, ok := s.segments[segment]
+	if !ok {
+		return model.Segments{}, fmt.Errorf("%s: %w", op, storage.ErrSegmentNotExists)
+	}
+	m.Users = len(s.activeUsers(segment, time.Now()))
+
+	return m, nil
+}
+
+// Get page of Segments with member counts
+func (s *Storage) ListSegms(ctx context.Context, filter model.SegmentsFilter) ([]model.Segments, error) {
+	const op = "memory.listsegments"
+
+	if err := ctx.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	now := time.Now()
+
+	var segments []model.Segments
+	for name, m := range s.segments {
+		if !strings.HasPrefix(name, filter.Prefix) {
+			continue
+		}
+		m.Users = len(s.activeUsers(name, now))
+		segments = append(segments, m)
+	}
+
+	// Ascending order by sort key and name
+	less := func(a, b model.Segments) bool {
+		switch filter.SortBy {
+		case model.SortByCreatedAt:
+			if !a.CreatedAt.Equal(b.CreatedAt) {
+				return a.CreatedAt.Before(b.CreatedAt)
+			}
+		case model.SortBySize:
+			if a.Users != b.Users {
+				return a.Users < b.Users
+			}
+		}
+		return a.SegmentName < b.SegmentName
+	}
+	if filter.Desc {
+		asc := less
+		less = func(a, b model.Segments) bool { return asc(b, a) }
+	}
+
+	sort.Slice(segments, func(i, j int) bool { return less(segments[i], segments[j]) })
+
+	if filter.After != nil {
+		i := sort.Search(len(segments), func(i int) bool { return less(*filter.After, segments[i]) })
+		segments = segments[i:]
+	}
+	if len(segments) > filter.Limit {
+		segments = segments[:filter.Limit]
+	}
+
+	return segments, nil
+}
+
+// Get page of Users of Segment with user_id greater than after
+func (s *Storage) GetSegmUsers(ctx context.Context, segment string, after, limit int) ([]int, error) {
+	const op = "memory.getsegmentusers"
+
+	if err := ctx.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if _, ok := s.segments[segment]; !ok {
+		return nil, fmt.Errorf("%s: %w", op, storage.ErrSegmentNotExists)
+	}
+
+	users := s.activeUsers(segment, time.Now())
+	i := sort.SearchInts(users, after+1)
+	users = users[i:]
+	if len(users) > limit {
+		users = users[:limit]
+	}
+
+	return users, nil
+}
+
+// Stream all Users of Segment to fn.
+// ErrSegmentNotExists is returned before fn is called for the first time.
+func (s *Storage) StreamSegmUsers(ctx context.Context, segment string, fn func(user int) error) error {
+	const op = "memory.streamsegmentusers"
+
+	if err := ctx.Err(); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	s.mu.RLock()
+	if _, ok := s.segments[segment]; !ok {
+		s.mu.RUnlock()
+		return fmt.Errorf("%s: %w", op, storage.ErrSegmentNotExists)
+	}
+	users := s.activeUsers(segment, time.Now())
+	s.mu.RUnlock()
+
+	// Lock is not held while the caller writes users out
+	for _, user := range users {
+		if err := ctx.Err(); err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+		if err := fn(user); err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+	}
+
+	return nil
+}
+
+// Save User, enrolling it into segments with auto percent
+func (s *Storage) SaveUser(ctx context.Context, userToSave int) error {
+	const op = "memory.SaveUser"
+
+	if err := ctx.Err(); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if createdAt, ok := s.users[userToSave]; ok {
+		return fmt.Errorf("%s: %w, created at %s", op, storage.ErrUserExists, createdAt)
+	}
+
+	now := time.Now()
+
+	s.users[userToSave] = now.UTC()
+
+	for name, m := range s.segments {
+		if m.AutoPercent > 0 && sampling.InPercent(userToSave, name, m.AutoPercent) {
+			s.saveUserSegm(userToSave, name, nil, now)
+		}
+	}
+
+	return nil
+}
+
+// Delete User
+func (s *Storage) DeleteUser(ctx context.Context, userToDelete int) error {
+	const op = "memory.DeleteUser"
+
+	if err := ctx.Err(); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.users[userToDelete]; !ok {
+		return fmt.Errorf("%s: %w", op, storage.ErrUserNotExists)
+	}
+	for _, users := range s.members {
+		if _, ok := users[userToDelete]; ok {
+			return fmt.Errorf("%s: %w", op, storage.ErrUserDelete)
+		}
+	}
+
+	delete(s.users, userToDelete)
+
+	return nil
+}
+
+// Get active Segments of User
+func (s *Storage) GetUser(ctx context.Context, user int) ([]string, error) {
+	const op = "memory.getuser"
+
+	if err := ctx.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if _, ok := s.users[user]; !ok {
+		return nil, fmt.Errorf("%s: %w", op, storage.ErrUserNotExists)
+	}
+
+	return s.userSegments(user, time.Now()), nil
+}
+
+// Save Segments for User, returning outcome for every segment
+func (s *Storage) SaveSegmToUser(ctx context.Context, user int, segments []model.UserSegments) ([]model.SegmentResult, error) {
+	const op = "memory.AddToUser"
+
+	if err := ctx.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.users[user]; !ok {
+		return nil, fmt.Errorf("%s: %w", op, storage.ErrUserNotExists)
+	}
+
+	return s.saveUserSegms(user, segments, time.Now()), nil
+}
+
+// Delete Segments for User, returning outcome for every segment
+func (s *Storage) DeleteSegmFromUser(ctx context.Context, user int, segments []string) ([]model.SegmentResult, error) {
+	const op = "memory.deletesegmentsfromuser"
+
+	if err := ctx.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.users[user]; !ok {
+		return nil, fmt.Errorf("%s: %w", op, storage.ErrUserNotExists)
+	}
+
+	return s.deleteUserSegms(user, segments, time.Now()), nil
+}
+
+// Add and delete Segments for User atomically, returning resulting Segments
+func (s *Storage) UpdateUserSegments(ctx context.Context, user int, add []model.UserSegments, remove []string) (
+	[]string, []model.SegmentResult, error) {
+	const op = "memory.updateusersegments"
+
+	if err := ctx.Err(); err != nil {
+		return nil, nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	removeSet := make(map[string]struct{}, len(remove))
+	for _, v := range remove {
+		removeSet[v] = struct{}{}
+	}
+	for _, v := range add {
+		if _, ok := removeSet[v.SegmentName]; ok {
+			return nil, nil, fmt.Errorf("%s: %w: %s", op, storage.ErrSegmentsConflict, v.SegmentName)
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.users[user]; !ok {
+		return nil, nil, fmt.Errorf("%s: %w", op, storage.ErrUserNotExists)
+	}
+
+	now := time.Now()
+
+	results := append(s.saveUserSegms(user, add, now), s.deleteUserSegms(user, remove, now)...)
+
+	return s.userSegments(user, now), results, nil
+}
+
+// Get History of User Segments for period [from, to)
+func (s *Storage) GetHistory(ctx context.Context, from, to time.Time) ([]model.UserSegmentsHistory, error) {
+	const op = "memory.gethistory"
+
+	if err := ctx.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var history []model.UserSegmentsHistory
+	for _, h := range s.history {
+		if !h.CreatedAt.Before(from) && h.CreatedAt.Before(to) {
+			history = append(history, h)
+		}
+	}
+
+	return history, nil
+}
+
+// Delete expired Segments from all Users
+func (s *Storage) DeleteExpired(ctx context.Context) (int, error) {
+	const op = "memory.deleteexpired"
+
+	if err := ctx.Err(); err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+
+	var deleted int
+	for segment, users := range s.members {
+		for user, expiresAt := range users {
+			if !active(expiresAt, now) {
+				delete(users, user)
+				s.saveHistory(user, segment, model.OperationRemove, now)
+				deleted++
+			}
+		}
+	}
+
+	return deleted, nil
+}
+
+func (s *Storage) saveUserSegms(user int, segments []model.UserSegments, now time.Time) []model.SegmentResult {
+	results := make([]model.SegmentResult, 0, len(segments))
+
+	for _, v := range segments {
+		result := model.SegmentResult{Slug: v.SegmentName}
+
+		switch {
+		case !s.segmExists(v.SegmentName):
+			result.Result = model.ResultUnknownSegment
+		case s.saveUserSegm(user, v.SegmentName, v.ExpiresAt, now):
+			result.Result = model.ResultAdded
+		default:
+			result.Result = model.ResultAlreadyMember
+		}
+
+		results = append(results, result)
+	}
+
+	return results
+}
+
+func (s *Storage) deleteUserSegms(user int, segments []string, now time.Time) []model.SegmentResult {
+	results := make([]model.SegmentResult, 0, len(segments))
+
+	for _, v := range segments {
+		result := model.SegmentResult{Slug: v}
+
+		switch {
+		case !s.segmExists(v):
+			result.Result = model.ResultUnknownSegment
+		case s.deleteUserSegm(user, v, now):
+			result.Result = model.ResultRemoved
+		default:
+			result.Result = model.ResultNotMember
+		}
+
+		results = append(results, result)
+	}
+
+	return results
+}
+
+// Save Segment for User, updating expiration of existing membership.
+// Expired membership which is not deleted yet is recorded as removed and added again.
+func (s *Storage) saveUserSegm(user int, segment string, expiresAt *time.Time, now time.Time) (added bool) {
+	s.deleteExpiredUserSegm(user, segment, now)
+
+	if expiresAt != nil {
+		t := *expiresAt
+		expiresAt = &t
+	}
+
+	users := s.members[segment]
+	if _, ok := users[user]; ok {
+		users[user] = expiresAt
+		return false
+	}
+
+	users[user] = expiresAt
+	s.saveHistory(user, segment, model.OperationAdd, now)
+
+	return true
+}
+
+// Delete Segment from User.
+// Expired membership which is not deleted yet is recorded as removed but reported as not a member.
+func (s *Storage) deleteUserSegm(user int, segment string, now time.Time) (removed bool) {
+	s.deleteExpiredUserSegm(user, segment, now)
+
+	users := s.members[segment]
+	if _, ok := users[user]; !ok {
+		return false
+	}
+
+	delete(users, user)
+	s.saveHistory(user, segment, model.OperationRemove, now)
+
+	return true
+}
+
+func (s *Storage) deleteExpiredUserSegm(user int, segment string, now time.Time) {
+	users := s.members[segment]
+	if expiresAt, ok := users[user]; ok && !active(expiresAt, now) {
+		delete(users, user)
+		s.saveHistory(user, segment, model.OperationRemove, now)
+	}
+}
+
+func (s *Storage) segmExists(segment string) bool {
+	_, ok := s.segments[segment]
+	return ok
+}
+
+// Sorted active Users of Segment
+func (s *Storage) activeUsers(segment string, now time.Time) []int {
+	var users []int
+	for user, expiresAt := range s.members[segment] {
+		if active(expiresAt, now) {
+			users = append(users, user)
+		}
+	}
+	sort.Ints(users)
+
+	return users
+}
+
+// Sorted active Segments of User
+func (s *Storage) userSegments(user int, now time.Time) []string {
+	var segments []string
+	for segment, users := range s.members {
+		if expiresAt, ok := users[user]; ok && active(expiresAt, now) {
+			segments = append(segments, segment)
+		}
+	}
+	sort.Strings(segments)
+
+	return segments
+}
+
+func (s *Storage) saveHistory(user int, segment, operation string, now time.Time) {
+	s.history = append(s.history, model.UserSegmentsHistory{
+		UserID:      user,
+		SegmentName: segment,
+		Operation:   operation,
+		CreatedAt:   now.UTC(),
+	})
+}
+
+func active(expiresAt *time.Time, now time.Time) bool {
+	return expiresAt == nil || expiresAt.After(now)
+}
@@ -0,0 +1,73 @@
+package migrate
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+const Usage = "migrate [up | down [N] | version]"
+
+// Run executes migrate subcommand and reports its result to w.
+// Without arguments pending migrations are applied, down reverts one migration by default
+func (mg *Migrator) Run(ctx context.Context, args []string, w io.Writer) error {
+	cmd := "up"
+	if len(args) > 0 {
+		cmd, args = args[0], args[1:]
+	}
+
+	switch cmd {
+	case "up":
+		if len(args) > 0 {
+			return fmt.Errorf("usage: %s", Usage)
+		}
+		applied, err := mg.Up(ctx)
+		for _, v := range applied {
+			fmt.Fprintf(w, "applied %d\n", v)
+		}
+		if err != nil {
+			return err
+		}
+		if len(applied) == 0 {
+			fmt.Fprintln(w, "no pending migrations")
+		}
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			return fmt.Errorf("usage: %s", Usage)
+		}
+		if len(args) == 1 {
+			n, err := strconv.Atoi(args[0])
+			if err != nil || n < 1 {
+				return fmt.Errorf("invalid number of migrations %q", args[0])
+			}
+			steps = n
+		}
+		reverted, err := mg.Down(ctx, steps)
+		for _, v := range reverted {
+			fmt.Fprintf(w, "reverted %d\n", v)
+		}
+		if errors.Is(err, ErrNoMigration) {
+			fmt.Fprintln(w, "no applied migrations")
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	case "version":
+		if len(args) > 0 {
+			return fmt.Errorf("usage: %s", Usage)
+		}
+		version, err := mg.Version(ctx)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(w, "version %d, latest %d\n", version, mg.Latest())
+	default:
+		return fmt.Errorf("usage: %s", Usage)
+	}
+
+	return nil
+}
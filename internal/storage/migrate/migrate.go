@@ -0,0 +1,324 @@
+// Package migrate applies versioned SQL migrations embedded into the binary.
+//
+// Migrations are files named NNNN_description.up.sql and NNNN_description.down.sql.
+// Applied versions are recorded in schema_migrations table, every migration
+// runs in its own transaction under a lock held for the whole run, so
+// concurrent starts of the service apply each migration once.
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+)
+
+var (
+	ErrSchemaTooNew = errors.New("database schema is newer than the binary")
+	ErrNoMigration  = errors.New("no migration to apply")
+)
+
+var fileName = regexp.MustCompile(`^(\d+)_(\w+)\.(up|down)\.sql$`)
+
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+}
+
+// Dialect describes differences of databases which matter for migrations
+type Dialect struct {
+	Name string
+	// Lock and Unlock serialize migrations across processes on the connection
+	Lock   string
+	Unlock string
+	// Begin starts migration transaction
+	Begin string
+	// CreateTable creates schema_migrations table
+	CreateTable string
+	// TableExists reports whether schema_migrations table exists
+	TableExists string
+}
+
+var (
+	Postgres = Dialect{
+		Name:   "postgres",
+		Lock:   "SELECT pg_advisory_lock(4127901521)",
+		Unlock: "SELECT pg_advisory_unlock(4127901521)",
+		Begin:  "BEGIN",
+		CreateTable: `CREATE TABLE IF NOT EXISTS schema_migrations(
+			version INT NOT NULL PRIMARY KEY,
+			applied_at TIMESTAMP NOT NULL DEFAULT current_timestamp)`,
+		TableExists: "SELECT to_regclass('schema_migrations') IS NOT NULL",
+	}
+	// Write transaction of SQLite locks the whole database file
+	SQLite = Dialect{
+		Name:  "sqlite",
+		Begin: "BEGIN IMMEDIATE",
+		CreateTable: `CREATE TABLE IF NOT EXISTS schema_migrations(
+			version INT NOT NULL PRIMARY KEY,
+			applied_at TEXT NOT NULL DEFAULT current_timestamp)`,
+		TableExists: "SELECT COUNT(*) > 0 FROM sqlite_master WHERE type = 'table' AND name = 'schema_migrations'",
+	}
+)
+
+type Migrator struct {
+	db         *sql.DB
+	dialect    Dialect
+	migrations []Migration
+}
+
+// Get instance with migrations read from root of fsys
+func New(db *sql.DB, dialect Dialect, fsys fs.FS) (*Migrator, error) {
+	const op = "migrate.New"
+
+	migrations, err := Load(fsys)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return &Migrator{
+		db:         db,
+		dialect:    dialect,
+		migrations: migrations,
+	}, nil
+}
+
+// Load migrations sorted by version, every migration must have up and down files
+func Load(fsys fs.FS) ([]Migration, error) {
+	files, err := fs.Glob(fsys, "*.sql")
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := make(map[int]*Migration)
+	for _, file := range files {
+		m := fileName.FindStringSubmatch(path.Base(file))
+		if m == nil {
+			return nil, fmt.Errorf("invalid migration file name %q", file)
+		}
+		version, err := strconv.Atoi(m[1])
+		if err != nil || version <= 0 {
+			return nil, fmt.Errorf("invalid migration version %q", file)
+		}
+
+		body, err := fs.ReadFile(fsys, file)
+		if err != nil {
+			return nil, err
+		}
+
+		migration, ok := byVersion[version]
+		if !ok {
+			migration = &Migration{Version: version, Name: m[2]}
+			byVersion[version] = migration
+		}
+		if migration.Name != m[2] {
+			return nil, fmt.Errorf("migration %d has different names %q and %q", version, migration.Name, m[2])
+		}
+		if m[3] == "up" {
+			migration.Up = string(body)
+		} else {
+			migration.Down = string(body)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.Up == "" || m.Down == "" {
+			return nil, fmt.Errorf("migration %d must have up and down files", m.Version)
+		}
+		migrations = append(migrations, *m)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+
+	return migrations, nil
+}
+
+// Latest version known to the binary
+func (mg *Migrator) Latest() int {
+	if len(mg.migrations) == 0 {
+		return 0
+	}
+	return mg.migrations[len(mg.migrations)-1].Version
+}
+
+// Version of database schema, zero for empty database. It only reads, so it suits
+// read-only roles and readiness probes
+func (mg *Migrator) Version(ctx context.Context) (int, error) {
+	const op = "migrate.Version"
+
+	var exists bool
+	if err := mg.db.QueryRowContext(ctx, mg.dialect.TableExists).Scan(&exists); err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+	if !exists {
+		return 0, nil
+	}
+
+	var version int
+	err := mg.db.QueryRowContext(ctx, "SELECT COALESCE(MAX(version), 0) FROM schema_migrations").Scan(&version)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return version, nil
+}
+
+// Check returns ErrSchemaTooNew if database was migrated by a newer binary
+func (mg *Migrator) Check(ctx context.Context) error {
+	version, err := mg.Version(ctx)
+	if err != nil {
+		return err
+	}
+	if version > mg.Latest() {
+		return fmt.Errorf("migrate.Check: %w: version %d, known %d", ErrSchemaTooNew, version, mg.Latest())
+	}
+
+	return nil
+}
+
+// Up applies all pending migrations and returns their versions
+func (mg *Migrator) Up(ctx context.Context) (applied []int, err error) {
+	const op = "migrate.Up"
+
+	err = mg.locked(ctx, func(conn *sql.Conn) error {
+		version, err := currentVersion(ctx, conn)
+		if err != nil {
+			return err
+		}
+		if version > mg.Latest() {
+			return fmt.Errorf("%w: version %d, known %d", ErrSchemaTooNew, version, mg.Latest())
+		}
+
+		for _, m := range mg.migrations {
+			if m.Version <= version {
+				continue
+			}
+			done, err := mg.apply(ctx, conn, m.Up,
+				fmt.Sprintf("INSERT INTO schema_migrations(version) VALUES (%d)", m.Version),
+				func(current int) bool { return current < m.Version })
+			if err != nil {
+				return fmt.Errorf("migration %d_%s: %w", m.Version, m.Name, err)
+			}
+			if done {
+				applied = append(applied, m.Version)
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return applied, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return applied, nil
+}
+
+// Down reverts steps latest migrations and returns their versions
+func (mg *Migrator) Down(ctx context.Context, steps int) (reverted []int, err error) {
+	const op = "migrate.Down"
+
+	err = mg.locked(ctx, func(conn *sql.Conn) error {
+		version, err := currentVersion(ctx, conn)
+		if err != nil {
+			return err
+		}
+		if version > mg.Latest() {
+			return fmt.Errorf("%w: version %d, known %d", ErrSchemaTooNew, version, mg.Latest())
+		}
+
+		for i := len(mg.migrations) - 1; i >= 0 && len(reverted) < steps; i-- {
+			m := mg.migrations[i]
+			if m.Version > version {
+				continue
+			}
+			done, err := mg.apply(ctx, conn, m.Down,
+				fmt.Sprintf("DELETE FROM schema_migrations WHERE version = %d", m.Version),
+				func(current int) bool { return current == m.Version })
+			if err != nil {
+				return fmt.Errorf("migration %d_%s: %w", m.Version, m.Name, err)
+			}
+			if !done {
+				break
+			}
+			reverted = append(reverted, m.Version)
+		}
+
+		if len(reverted) == 0 {
+			return ErrNoMigration
+		}
+
+		return nil
+	})
+	if err != nil {
+		return reverted, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return reverted, nil
+}
+
+// Run fn on a single connection holding migration lock
+func (mg *Migrator) locked(ctx context.Context, fn func(conn *sql.Conn) error) error {
+	conn, err := mg.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if mg.dialect.Lock != "" {
+		if _, err := conn.ExecContext(ctx, mg.dialect.Lock); err != nil {
+			return fmt.Errorf("lock: %w", err)
+		}
+		defer conn.ExecContext(context.Background(), mg.dialect.Unlock)
+	}
+
+	if _, err := conn.ExecContext(ctx, mg.dialect.CreateTable); err != nil {
+		return err
+	}
+
+	return fn(conn)
+}
+
+// Run migration script and record it in one transaction if the version
+// read inside the transaction still needs it. SQLite has no session lock,
+// so another process may have migrated the database in the meantime
+func (mg *Migrator) apply(ctx context.Context, conn *sql.Conn, script, record string,
+	needed func(current int) bool) (done bool, err error) {
+	if _, err := conn.ExecContext(ctx, mg.dialect.Begin); err != nil {
+		return false, err
+	}
+	defer func() {
+		if !done {
+			conn.ExecContext(context.Background(), "ROLLBACK")
+		}
+	}()
+
+	current, err := currentVersion(ctx, conn)
+	if err != nil || !needed(current) {
+		return false, err
+	}
+
+	if _, err := conn.ExecContext(ctx, script); err != nil {
+		return false, err
+	}
+	if _, err := conn.ExecContext(ctx, record); err != nil {
+		return false, err
+	}
+	if _, err := conn.ExecContext(ctx, "COMMIT"); err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+func currentVersion(ctx context.Context, conn *sql.Conn) (version int, err error) {
+	err = conn.QueryRowContext(ctx, "SELECT COALESCE(MAX(version), 0) FROM schema_migrations").Scan(&version)
+
+	return version, err
+}
@@ -0,0 +1,215 @@
+package migrate_test
+
+import (
+	"context"
+	"database/sql"
+	"path/filepath"
+	"sync"
+	"testing"
+	"testing/fstest"
+
+	"github.com/m1al04949/avito-tech-service/internal/storage/migrate"
+	"github.com/stretchr/testify/require"
+	_ "modernc.org/sqlite"
+)
+
+var migrations = fstest.MapFS{
+	"0001_init.up.sql":     {Data: []byte("CREATE TABLE a(id INT);")},
+	"0001_init.down.sql":   {Data: []byte("DROP TABLE a;")},
+	"0002_add_b.up.sql":    {Data: []byte("CREATE TABLE b(id INT); INSERT INTO b VALUES (1);")},
+	"0002_add_b.down.sql":  {Data: []byte("DROP TABLE b;")},
+	"0003_broken.up.sql":   {Data: []byte("CREATE TABLE c(id INT); SELECT * FROM missing;")},
+	"0003_broken.down.sql": {Data: []byte("DROP TABLE c;")},
+}
+
+func openDB(t *testing.T, path string) *sql.DB {
+	t.Helper()
+
+	db, err := sql.Open("sqlite", "file:"+path+"?_pragma=busy_timeout(5000)")
+	require.NoError(t, err)
+	db.SetMaxOpenConns(1)
+	t.Cleanup(func() { db.Close() })
+
+	return db
+}
+
+func newMigrator(t *testing.T, db *sql.DB, fsys fstest.MapFS) *migrate.Migrator {
+	t.Helper()
+
+	m, err := migrate.New(db, migrate.SQLite, fsys)
+	require.NoError(t, err)
+
+	return m
+}
+
+func tableExists(t *testing.T, db *sql.DB, table string) bool {
+	t.Helper()
+
+	var n int
+	require.NoError(t, db.QueryRow("SELECT COUNT(*) FROM sqlite_master WHERE type='table' AND name=?",
+		table).Scan(&n))
+
+	return n > 0
+}
+
+func TestLoad(t *testing.T) {
+	_, err := migrate.Load(fstest.MapFS{"0001_init.up.sql": {}})
+	require.ErrorContains(t, err, "must have up and down")
+
+	_, err = migrate.Load(fstest.MapFS{"init.up.sql": {}})
+	require.ErrorContains(t, err, "invalid migration file name")
+
+	_, err = migrate.Load(fstest.MapFS{
+		"0001_init.up.sql":    {Data: []byte("x")},
+		"0001_other.down.sql": {Data: []byte("x")},
+	})
+	require.ErrorContains(t, err, "different names")
+}
+
+func TestUpDown(t *testing.T) {
+	ctx := context.Background()
+	db := openDB(t, filepath.Join(t.TempDir(), "test.db"))
+
+	fsys := fstest.MapFS{}
+	for name, f := range migrations {
+		if name != "0003_broken.up.sql" && name != "0003_broken.down.sql" {
+			fsys[name] = f
+		}
+	}
+
+	m := newMigrator(t, db, fsys)
+	require.Equal(t, 2, m.Latest())
+
+	version, err := m.Version(ctx)
+	require.NoError(t, err)
+	require.Zero(t, version)
+
+	applied, err := m.Up(ctx)
+	require.NoError(t, err)
+	require.Equal(t, []int{1, 2}, applied)
+	require.True(t, tableExists(t, db, "b"))
+
+	applied, err = m.Up(ctx)
+	require.NoError(t, err)
+	require.Empty(t, applied)
+
+	reverted, err := m.Down(ctx, 1)
+	require.NoError(t, err)
+	require.Equal(t, []int{2}, reverted)
+	require.False(t, tableExists(t, db, "b"))
+	require.True(t, tableExists(t, db, "a"))
+
+	reverted, err = m.Down(ctx, 5)
+	require.NoError(t, err)
+	require.Equal(t, []int{1}, reverted)
+
+	_, err = m.Down(ctx, 1)
+	require.ErrorIs(t, err, migrate.ErrNoMigration)
+}
+
+func TestVersionIsReadOnly(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "test.db")
+	db := openDB(t, path)
+
+	version, err := newMigrator(t, db, migrations).Version(ctx)
+	require.NoError(t, err)
+	require.Zero(t, version)
+	require.False(t, tableExists(t, db, "schema_migrations"))
+
+	fsys := fstest.MapFS{
+		"0001_init.up.sql":   migrations["0001_init.up.sql"],
+		"0001_init.down.sql": migrations["0001_init.down.sql"],
+	}
+	_, err = newMigrator(t, db, fsys).Up(ctx)
+	require.NoError(t, err)
+
+	// Probes may connect with a role which cannot change schema
+	ro, err := sql.Open("sqlite", "file:"+path+"?mode=ro")
+	require.NoError(t, err)
+	defer ro.Close()
+
+	version, err = newMigrator(t, ro, fsys).Version(ctx)
+	require.NoError(t, err)
+	require.Equal(t, 1, version)
+}
+
+func TestFailedMigrationIsRolledBack(t *testing.T) {
+	ctx := context.Background()
+	db := openDB(t, filepath.Join(t.TempDir(), "test.db"))
+
+	applied, err := newMigrator(t, db, migrations).Up(ctx)
+	require.Error(t, err)
+	require.Equal(t, []int{1, 2}, applied)
+	require.False(t, tableExists(t, db, "c"))
+
+	version, err := newMigrator(t, db, migrations).Version(ctx)
+	require.NoError(t, err)
+	require.Equal(t, 2, version)
+}
+
+func TestSchemaTooNew(t *testing.T) {
+	ctx := context.Background()
+	db := openDB(t, filepath.Join(t.TempDir(), "test.db"))
+
+	_, err := newMigrator(t, db, fstest.MapFS{
+		"0001_init.up.sql":    migrations["0001_init.up.sql"],
+		"0001_init.down.sql":  migrations["0001_init.down.sql"],
+		"0002_add_b.up.sql":   migrations["0002_add_b.up.sql"],
+		"0002_add_b.down.sql": migrations["0002_add_b.down.sql"],
+	}).Up(ctx)
+	require.NoError(t, err)
+
+	old := newMigrator(t, db, fstest.MapFS{
+		"0001_init.up.sql":   migrations["0001_init.up.sql"],
+		"0001_init.down.sql": migrations["0001_init.down.sql"],
+	})
+
+	require.ErrorIs(t, old.Check(ctx), migrate.ErrSchemaTooNew)
+	_, err = old.Up(ctx)
+	require.ErrorIs(t, err, migrate.ErrSchemaTooNew)
+	_, err = old.Down(ctx, 1)
+	require.ErrorIs(t, err, migrate.ErrSchemaTooNew)
+	require.True(t, tableExists(t, db, "b"))
+}
+
+func TestConcurrentUp(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "test.db")
+
+	fsys := fstest.MapFS{
+		"0001_init.up.sql":    migrations["0001_init.up.sql"],
+		"0001_init.down.sql":  migrations["0001_init.down.sql"],
+		"0002_add_b.up.sql":   migrations["0002_add_b.up.sql"],
+		"0002_add_b.down.sql": migrations["0002_add_b.down.sql"],
+	}
+
+	// Separate pools act as separate service instances
+	var (
+		wg    sync.WaitGroup
+		mu    sync.Mutex
+		total []int
+	)
+	for i := 0; i < 4; i++ {
+		m := newMigrator(t, openDB(t, path), fsys)
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			applied, err := m.Up(ctx)
+			require.NoError(t, err)
+
+			mu.Lock()
+			total = append(total, applied...)
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+
+	require.ElementsMatch(t, []int{1, 2}, total)
+
+	var rows int
+	require.NoError(t, openDB(t, path).QueryRow("SELECT COUNT(*) FROM b").Scan(&rows))
+	require.Equal(t, 1, rows)
+}
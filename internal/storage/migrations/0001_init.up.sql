@@ -0,0 +1,27 @@
+-- Tables of the service. Statements are idempotent, so databases
+-- created before versioned migrations are adopted as is.
+CREATE TABLE IF NOT EXISTS segments(
+    segment_name TEXT NOT NULL PRIMARY KEY,
+    created_at TIMESTAMP DEFAULT current_timestamp);
+ALTER TABLE segments ADD COLUMN IF NOT EXISTS auto_percent INT NOT NULL DEFAULT 0;
+
+CREATE TABLE IF NOT EXISTS users(
+    user_id INT PRIMARY KEY,
+    created_at TIMESTAMP DEFAULT current_timestamp);
+
+CREATE TABLE IF NOT EXISTS user_segments(
+    user_id INT REFERENCES users(user_id),
+    segment_name TEXT REFERENCES segments(segment_name),
+    PRIMARY KEY (user_id, segment_name));
+ALTER TABLE user_segments ADD COLUMN IF NOT EXISTS expires_at TIMESTAMPTZ;
+CREATE INDEX IF NOT EXISTS user_segments_expires_at_idx
+    ON user_segments(expires_at) WHERE expires_at IS NOT NULL;
+
+CREATE TABLE IF NOT EXISTS user_segments_history(
+    id SERIAL PRIMARY KEY,
+    user_id INT NOT NULL,
+    segment_name TEXT NOT NULL,
+    operation TEXT NOT NULL,
+    created_at TIMESTAMP DEFAULT current_timestamp);
+CREATE INDEX IF NOT EXISTS user_segments_history_created_at_idx
+    ON user_segments_history(created_at);
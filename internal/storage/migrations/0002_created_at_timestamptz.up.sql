@@ -0,0 +1,9 @@
+-- Creation times are stored with time zone, so reports and listings do not
+-- depend on TimeZone of the DB session. Existing values were written in the
+-- session time zone by current_timestamp and are converted from it.
+ALTER TABLE user_segments_history
+    ALTER COLUMN created_at TYPE TIMESTAMPTZ USING created_at AT TIME ZONE current_setting('TimeZone');
+ALTER TABLE segments
+    ALTER COLUMN created_at TYPE TIMESTAMPTZ USING created_at AT TIME ZONE current_setting('TimeZone');
+ALTER TABLE users
+    ALTER COLUMN created_at TYPE TIMESTAMPTZ USING created_at AT TIME ZONE current_setting('TimeZone');
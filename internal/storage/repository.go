@@ -0,0 +1,32 @@
+package storage
+
+import (
+	"context"
+	"time"
+
+	"github.com/m1al04949/avito-tech-service/internal/model"
+)
+
+// Repository is the full set of operations of segmentation storage.
+// Implementations return the errors declared in this package and stop
+// the operation when ctx is done
+type Repository interface {
+	SaveSegm(ctx context.Context, segmToSave string, autoPercent int) error
+	DeleteSegm(ctx context.Context, segmToDelete string) error
+	GetSegm(ctx context.Context, segment string) (model.Segments, error)
+	ListSegms(ctx context.Context, filter model.SegmentsFilter) ([]model.Segments, error)
+	GetSegmUsers(ctx context.Context, segment string, after, limit int) ([]int, error)
+	StreamSegmUsers(ctx context.Context, segment string, fn func(user int) error) error
+
+	SaveUser(ctx context.Context, userToSave int) error
+	DeleteUser(ctx context.Context, userToDelete int) error
+	GetUser(ctx context.Context, user int) ([]string, error)
+	SaveSegmToUser(ctx context.Context, user int, segments []model.UserSegments) ([]model.SegmentResult, error)
+	DeleteSegmFromUser(ctx context.Context, user int, segments []string) ([]model.SegmentResult, error)
+	UpdateUserSegments(ctx context.Context, user int, add []model.UserSegments, remove []string) ([]string, []model.SegmentResult, error)
+
+	GetHistory(ctx context.Context, from, to time.Time) ([]model.UserSegmentsHistory, error)
+	DeleteExpired(ctx context.Context) (int, error)
+}
+
+var _ Repository = (*Storage)(nil)
@@ -0,0 +1,26 @@
+-- Timestamps are fixed width UTC text, see timeLayout
+CREATE TABLE IF NOT EXISTS segments(
+    segment_name TEXT NOT NULL PRIMARY KEY,
+    created_at TEXT NOT NULL,
+    auto_percent INT NOT NULL DEFAULT 0);
+
+CREATE TABLE IF NOT EXISTS users(
+    user_id INT PRIMARY KEY,
+    created_at TEXT NOT NULL);
+
+CREATE TABLE IF NOT EXISTS user_segments(
+    user_id INT REFERENCES users(user_id),
+    segment_name TEXT REFERENCES segments(segment_name),
+    expires_at TEXT,
+    PRIMARY KEY (user_id, segment_name));
+CREATE INDEX IF NOT EXISTS user_segments_expires_at_idx
+    ON user_segments(expires_at) WHERE expires_at IS NOT NULL;
+
+CREATE TABLE IF NOT EXISTS user_segments_history(
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id INT NOT NULL,
+    segment_name TEXT NOT NULL,
+    operation TEXT NOT NULL,
+    created_at TEXT NOT NULL);
+CREATE INDEX IF NOT EXISTS user_segments_history_created_at_idx
+    ON user_segments_history(created_at);
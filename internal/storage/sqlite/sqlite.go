@@ -0,0 +1,856 @@
+// Package sqlite is a single file implementation of storage.Repository
+// with the same schema and semantics as Postgres storage.
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/url"
+	"time"
+
+	"github.com/m1al04949/avito-tech-service/internal/lib/sampling"
+	"github.com/m1al04949/avito-tech-service/internal/lib/sqltrace"
+	"github.com/m1al04949/avito-tech-service/internal/model"
+	"github.com/m1al04949/avito-tech-service/internal/storage"
+	"github.com/m1al04949/avito-tech-service/internal/storage/migrate"
+	semconv "go.opentelemetry.io/otel/semconv/v1.21.0"
+	"modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+// Timestamps are kept as fixed width UTC text, so they are compared as strings
+const timeLayout = "2006-01-02 15:04:05.000000"
+
+// Users of segment streamed per query, connection is released between batches
+const streamBatch = 1000
+
+//go:embed migrations/*.sql
+var migrations embed.FS
+
+type Storage struct {
+	path string
+	db   *sql.DB
+}
+
+var _ storage.Repository = (*Storage)(nil)
+
+// Get instance for DB file at path
+func New(path string) *Storage {
+	return &Storage{
+		path: path,
+	}
+}
+
+// Open DB file, creating it if needed
+func (s *Storage) Open() error {
+	if s.path == "" {
+		return errors.New("sqlite: storage path is empty")
+	}
+
+	dsn := "file:" + s.path + "?" + url.Values{
+		"_pragma": {"foreign_keys(1)", "busy_timeout(5000)", "journal_mode(WAL)"},
+	}.Encode()
+
+	db, err := sqltrace.Open("sqlite", dsn, semconv.DBSystemSqlite)
+	if err != nil {
+		return err
+	}
+
+	// SQLite has a single writer, transactions are serialized on one connection
+	db.SetMaxOpenConns(1)
+
+	if err := db.Ping(); err != nil {
+		db.Close()
+		return err
+	}
+
+	s.db = db
+
+	return nil
+}
+
+// Close connection
+func (s *Storage) Close() {
+	s.db.Close()
+}
+
+// DB is the underlying connection pool, for metrics of its stats
+func (s *Storage) DB() *sql.DB {
+	return s.db
+}
+
+// Ping checks connection to DB
+func (s *Storage) Ping(ctx context.Context) error {
+	return s.db.PingContext(ctx)
+}
+
+// Migrator of DB schema with migrations embedded into the binary
+func (s *Storage) Migrator() (*migrate.Migrator, error) {
+	const op = "sqlite.Migrator"
+
+	sub, err := fs.Sub(migrations, "migrations")
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return migrate.New(s.db, migrate.SQLite, sub)
+}
+
+// Save Segment, enrolling autoPercent of existing users into it
+func (s *Storage) SaveSegm(ctx context.Context, segmToSave string, autoPercent int) error {
+	const op = "sqlite.SaveSegm"
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	defer tx.Rollback()
+
+	now := time.Now()
+
+	_, err = tx.ExecContext(ctx, "INSERT INTO segments(segment_name, created_at, auto_percent) VALUES (?, ?, ?)",
+		segmToSave, formatTime(now), autoPercent)
+	if isConstraint(err, sqlite3.SQLITE_CONSTRAINT_PRIMARYKEY) {
+		return fmt.Errorf("%s: %w", op, storage.ErrSegmentExists)
+	}
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if autoPercent > 0 {
+		if err := enrollUsers(ctx, tx, segmToSave, autoPercent, now); err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// Delete Segment
+func (s *Storage) DeleteSegm(ctx context.Context, segmToDelete string) error {
+	const op = "sqlite.DeleteSegm"
+
+	res, err := s.db.ExecContext(ctx, "DELETE FROM segments WHERE segment_name=?", segmToDelete)
+	if isConstraint(err, sqlite3.SQLITE_CONSTRAINT_FOREIGNKEY) {
+		return fmt.Errorf("%s: %w", op, storage.ErrSegmentDelete)
+	}
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if affected, err := res.RowsAffected(); err != nil || affected == 0 {
+		return fmt.Errorf("%s: %w", op, storage.ErrSegmentNotExists)
+	}
+
+	return nil
+}
+
+// Get Segment
+func (s *Storage) GetSegm(ctx context.Context, segment string) (m model.Segments, err error) {
+	const op = "sqlite.getsegment"
+
+	var createdAt string
+
+	now := formatTime(time.Now())
+
+	err = s.db.QueryRowContext(ctx, `SELECT segment_name, auto_percent, created_at,
+		(SELECT COUNT(*) FROM user_segments
+		WHERE segment_name = ?1 AND (expires_at IS NULL OR expires_at > ?2))
+		FROM segments WHERE segment_name=?1`,
+		segment, now).Scan(&m.SegmentName, &m.AutoPercent, &createdAt, &m.Users)
+	if errors.Is(err, sql.ErrNoRows) {
+		return m, fmt.Errorf("%s: %w", op, storage.ErrSegmentNotExists)
+	}
+	if err != nil {
+		return m, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if m.CreatedAt, err = parseTime(createdAt); err != nil {
+		return m, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return m, nil
+}
+
+// Get page of Segments with member counts
+func (s *Storage) ListSegms(ctx context.Context, filter model.SegmentsFilter) (segments []model.Segments, err error) {
+	const op = "sqlite.listsegments"
+
+	var key string
+	switch filter.SortBy {
+	case model.SortByCreatedAt:
+		key = "created_at"
+	case model.SortBySize:
+		key = "users"
+	default:
+		key = "segment_name"
+	}
+
+	cmp, order := ">", "ASC"
+	if filter.Desc {
+		cmp, order = "<", "DESC"
+	}
+
+	// LIKE is case insensitive in SQLite, prefix is compared as is
+	args := []any{filter.Prefix, formatTime(time.Now())}
+	where := ""
+	if filter.After != nil {
+		switch key {
+		case "created_at":
+			args = append(args, formatTime(filter.After.CreatedAt))
+		case "users":
+			args = append(args, filter.After.Users)
+		}
+		args = append(args, filter.After.SegmentName)
+		if key == "segment_name" {
+			where = fmt.Sprintf("WHERE segment_name %s ?", cmp)
+		} else {
+			where = fmt.Sprintf("WHERE (%s, segment_name) %s (?, ?)", key, cmp)
+		}
+	}
+	orderBy := fmt.Sprintf("segment_name %s", order)
+	if key != "segment_name" {
+		orderBy = fmt.Sprintf("%s %s, %s", key, order, orderBy)
+	}
+	args = append(args, filter.Limit)
+
+	query := fmt.Sprintf(`WITH s AS (
+		SELECT sg.segment_name, sg.auto_percent, sg.created_at, COUNT(us.user_id) AS users
+		FROM segments sg
+		LEFT JOIN user_segments us ON us.segment_name = sg.segment_name
+			AND (us.expires_at IS NULL OR us.expires_at > ?2)
+		WHERE substr(sg.segment_name, 1, length(?1)) = ?1
+		GROUP BY sg.segment_name, sg.auto_percent, sg.created_at)
+		SELECT segment_name, auto_percent, created_at, users FROM s
+		%s ORDER BY %s LIMIT ?`, where, orderBy)
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return segments, fmt.Errorf("%s: %w", op, err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			m         model.Segments
+			createdAt string
+		)
+		if err := rows.Scan(&m.SegmentName, &m.AutoPercent, &createdAt, &m.Users); err != nil {
+			return segments, fmt.Errorf("%s: %w", op, err)
+		}
+		if m.CreatedAt, err = parseTime(createdAt); err != nil {
+			return segments, fmt.Errorf("%s: %w", op, err)
+		}
+		segments = append(segments, m)
+	}
+	if err := rows.Err(); err != nil {
+		return segments, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return segments, nil
+}
+
+// Get page of Users of Segment with user_id greater than after
+func (s *Storage) GetSegmUsers(ctx context.Context, segment string, after, limit int) (users []int, err error) {
+	const op = "sqlite.getsegmentusers"
+
+	var segmentExists bool
+
+	if err := s.db.QueryRowContext(ctx, "SELECT EXISTS(SELECT 1 FROM segments WHERE segment_name=?)",
+		segment).Scan(&segmentExists); err != nil {
+		return users, fmt.Errorf("%s: %w", op, err)
+	}
+	if !segmentExists {
+		return users, fmt.Errorf("%s: %w", op, storage.ErrSegmentNotExists)
+	}
+
+	users, err = s.segmUsers(ctx, segment, after, limit)
+	if err != nil {
+		return users, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return users, nil
+}
+
+// Stream all Users of Segment to fn in batches, so the only connection
+// is not held while the caller writes users out.
+// ErrSegmentNotExists is returned before fn is called for the first time.
+func (s *Storage) StreamSegmUsers(ctx context.Context, segment string, fn func(user int) error) error {
+	const op = "sqlite.streamsegmentusers"
+
+	var segmentExists bool
+
+	if err := s.db.QueryRowContext(ctx, "SELECT EXISTS(SELECT 1 FROM segments WHERE segment_name=?)",
+		segment).Scan(&segmentExists); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if !segmentExists {
+		return fmt.Errorf("%s: %w", op, storage.ErrSegmentNotExists)
+	}
+
+	after := 0
+	for {
+		users, err := s.segmUsers(ctx, segment, after, streamBatch)
+		if err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+
+		for _, user := range users {
+			if err := ctx.Err(); err != nil {
+				return fmt.Errorf("%s: %w", op, err)
+			}
+			if err := fn(user); err != nil {
+				return fmt.Errorf("%s: %w", op, err)
+			}
+		}
+
+		if len(users) < streamBatch {
+			return nil
+		}
+		after = users[len(users)-1]
+	}
+}
+
+// Save User, enrolling it into segments with auto percent
+func (s *Storage) SaveUser(ctx context.Context, userToSave int) error {
+	const op = "sqlite.SaveUser"
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	defer tx.Rollback()
+
+	now := time.Now()
+
+	_, err = tx.ExecContext(ctx, "INSERT INTO users(user_id, created_at) VALUES (?, ?)", userToSave, formatTime(now))
+	if isConstraint(err, sqlite3.SQLITE_CONSTRAINT_PRIMARYKEY) {
+		return fmt.Errorf("%s: %w", op, storage.ErrUserExists)
+	}
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := enrollUser(ctx, tx, userToSave, now); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// Delete User
+func (s *Storage) DeleteUser(ctx context.Context, userToDelete int) error {
+	const op = "sqlite.DeleteUser"
+
+	res, err := s.db.ExecContext(ctx, "DELETE FROM users WHERE user_id=?", userToDelete)
+	if isConstraint(err, sqlite3.SQLITE_CONSTRAINT_FOREIGNKEY) {
+		return fmt.Errorf("%s: %w", op, storage.ErrUserDelete)
+	}
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if affected, err := res.RowsAffected(); err != nil || affected == 0 {
+		return fmt.Errorf("%s: %w", op, storage.ErrUserNotExists)
+	}
+
+	return nil
+}
+
+// Save Segments for User, returning outcome for every segment
+func (s *Storage) SaveSegmToUser(ctx context.Context, user int, segments []model.UserSegments) (results []model.SegmentResult, err error) {
+	const op = "sqlite.AddToUser"
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return results, fmt.Errorf("%s: %w", op, err)
+	}
+	defer tx.Rollback()
+
+	userExists, err := userExists(ctx, tx, user)
+	if err != nil {
+		return results, fmt.Errorf("%s: %w", op, err)
+	}
+	if !userExists {
+		return results, fmt.Errorf("%s: %w", op, storage.ErrUserNotExists)
+	}
+
+	results, err = saveUserSegms(ctx, tx, user, segments, time.Now())
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return results, nil
+}
+
+// Delete Segments for User, returning outcome for every segment
+func (s *Storage) DeleteSegmFromUser(ctx context.Context, user int, segments []string) (results []model.SegmentResult, err error) {
+	const op = "sqlite.deletesegmentsfromuser"
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return results, fmt.Errorf("%s: %w", op, err)
+	}
+	defer tx.Rollback()
+
+	userExists, err := userExists(ctx, tx, user)
+	if err != nil {
+		return results, fmt.Errorf("%s: %w", op, err)
+	}
+	if !userExists {
+		return results, fmt.Errorf("%s: %w", op, storage.ErrUserNotExists)
+	}
+
+	results, err = deleteUserSegms(ctx, tx, user, segments, time.Now())
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return results, nil
+}
+
+// Get User Info
+func (s *Storage) GetUser(ctx context.Context, user int) (segments []string, err error) {
+	const op = "sqlite.getuser"
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return segments, fmt.Errorf("%s: %w", op, err)
+	}
+	defer tx.Rollback()
+
+	userExists, err := userExists(ctx, tx, user)
+	if err != nil {
+		return segments, fmt.Errorf("%s: %w", op, err)
+	}
+	if !userExists {
+		return segments, fmt.Errorf("%s: %w", op, storage.ErrUserNotExists)
+	}
+
+	segments, err = userSegms(ctx, tx, user, time.Now())
+	if err != nil {
+		return segments, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return segments, nil
+}
+
+// Add and delete Segments for User in single transaction, returning resulting Segments
+func (s *Storage) UpdateUserSegments(ctx context.Context, user int, add []model.UserSegments, remove []string) (
+	segments []string, results []model.SegmentResult, err error) {
+	const op = "sqlite.updateusersegments"
+
+	removeSet := make(map[string]struct{}, len(remove))
+	for _, v := range remove {
+		removeSet[v] = struct{}{}
+	}
+	for _, v := range add {
+		if _, ok := removeSet[v.SegmentName]; ok {
+			return segments, results, fmt.Errorf("%s: %w: %s", op, storage.ErrSegmentsConflict, v.SegmentName)
+		}
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return segments, results, fmt.Errorf("%s: %w", op, err)
+	}
+	defer tx.Rollback()
+
+	userExists, err := userExists(ctx, tx, user)
+	if err != nil {
+		return segments, results, fmt.Errorf("%s: %w", op, err)
+	}
+	if !userExists {
+		return segments, results, fmt.Errorf("%s: %w", op, storage.ErrUserNotExists)
+	}
+
+	now := time.Now()
+
+	added, err := saveUserSegms(ctx, tx, user, add, now)
+	if err != nil {
+		return segments, results, fmt.Errorf("%s: %w", op, err)
+	}
+	removed, err := deleteUserSegms(ctx, tx, user, remove, now)
+	if err != nil {
+		return segments, results, fmt.Errorf("%s: %w", op, err)
+	}
+	results = append(added, removed...)
+
+	segments, err = userSegms(ctx, tx, user, now)
+	if err != nil {
+		return segments, results, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return segments, results, nil
+}
+
+// Get History of User Segments for period [from, to)
+func (s *Storage) GetHistory(ctx context.Context, from, to time.Time) (history []model.UserSegmentsHistory, err error) {
+	const op = "sqlite.gethistory"
+
+	rows, err := s.db.QueryContext(ctx, `SELECT user_id, segment_name, operation, created_at
+		FROM user_segments_history
+		WHERE created_at >= ? AND created_at < ?
+		ORDER BY created_at, id`, formatTime(from), formatTime(to))
+	if err != nil {
+		return history, fmt.Errorf("%s: %w", op, err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			h         model.UserSegmentsHistory
+			createdAt string
+		)
+		if err := rows.Scan(&h.UserID, &h.SegmentName, &h.Operation, &createdAt); err != nil {
+			return history, fmt.Errorf("%s: %w", op, err)
+		}
+		if h.CreatedAt, err = parseTime(createdAt); err != nil {
+			return history, fmt.Errorf("%s: %w", op, err)
+		}
+		history = append(history, h)
+	}
+	if err := rows.Err(); err != nil {
+		return history, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return history, nil
+}
+
+// Delete expired Segments from all Users
+func (s *Storage) DeleteExpired(ctx context.Context) (deleted int, err error) {
+	const op = "sqlite.deleteexpired"
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return deleted, fmt.Errorf("%s: %w", op, err)
+	}
+	defer tx.Rollback()
+
+	now := formatTime(time.Now())
+
+	_, err = tx.ExecContext(ctx, `INSERT INTO user_segments_history(user_id, segment_name, operation, created_at)
+		SELECT user_id, segment_name, ?, ? FROM user_segments WHERE expires_at <= ?`,
+		model.OperationRemove, now, now)
+	if err != nil {
+		return deleted, fmt.Errorf("%s: %w", op, err)
+	}
+
+	res, err := tx.ExecContext(ctx, "DELETE FROM user_segments WHERE expires_at <= ?", now)
+	if err != nil {
+		return deleted, fmt.Errorf("%s: %w", op, err)
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return deleted, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return int(affected), nil
+}
+
+// Get page of active Users of Segment
+func (s *Storage) segmUsers(ctx context.Context, segment string, after, limit int) ([]int, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT user_id FROM user_segments
+		WHERE segment_name = ? AND user_id > ? AND (expires_at IS NULL OR expires_at > ?)
+		ORDER BY user_id LIMIT ?`, segment, after, formatTime(time.Now()), limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var users []int
+	for rows.Next() {
+		var user int
+		if err := rows.Scan(&user); err != nil {
+			return nil, err
+		}
+		users = append(users, user)
+	}
+
+	return users, rows.Err()
+}
+
+// Enroll existing users into new segment according to its auto percent
+func enrollUsers(ctx context.Context, tx *sql.Tx, segment string, autoPercent int, now time.Time) error {
+	rows, err := tx.QueryContext(ctx, "SELECT user_id FROM users")
+	if err != nil {
+		return err
+	}
+
+	var users []int
+	for rows.Next() {
+		var user int
+		if err := rows.Scan(&user); err != nil {
+			rows.Close()
+			return err
+		}
+		if sampling.InPercent(user, segment, autoPercent) {
+			users = append(users, user)
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, user := range users {
+		if _, err := saveUserSegm(ctx, tx, user, segment, nil, now); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Enroll new user into segments with auto percent
+func enrollUser(ctx context.Context, tx *sql.Tx, user int, now time.Time) error {
+	rows, err := tx.QueryContext(ctx, "SELECT segment_name, auto_percent FROM segments WHERE auto_percent > 0")
+	if err != nil {
+		return err
+	}
+
+	var segments []string
+	for rows.Next() {
+		var segm model.Segments
+		if err := rows.Scan(&segm.SegmentName, &segm.AutoPercent); err != nil {
+			rows.Close()
+			return err
+		}
+		if sampling.InPercent(user, segm.SegmentName, segm.AutoPercent) {
+			segments = append(segments, segm.SegmentName)
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, segment := range segments {
+		if _, err := saveUserSegm(ctx, tx, user, segment, nil, now); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Save Segments for User inside transaction
+func saveUserSegms(ctx context.Context, tx *sql.Tx, user int, segments []model.UserSegments, now time.Time) (
+	[]model.SegmentResult, error) {
+	results := make([]model.SegmentResult, 0, len(segments))
+
+	for _, v := range segments {
+		result := model.SegmentResult{Slug: v.SegmentName}
+
+		segmentExists, err := segmExists(ctx, tx, v.SegmentName)
+		if err != nil {
+			return nil, err
+		}
+
+		if !segmentExists {
+			result.Result = model.ResultUnknownSegment
+			results = append(results, result)
+			continue
+		}
+
+		added, err := saveUserSegm(ctx, tx, user, v.SegmentName, v.ExpiresAt, now)
+		if err != nil {
+			return nil, err
+		}
+		if added {
+			result.Result = model.ResultAdded
+		} else {
+			result.Result = model.ResultAlreadyMember
+		}
+
+		results = append(results, result)
+	}
+
+	return results, nil
+}
+
+// Delete Segments from User inside transaction
+func deleteUserSegms(ctx context.Context, tx *sql.Tx, user int, segments []string, now time.Time) ([]model.SegmentResult, error) {
+	results := make([]model.SegmentResult, 0, len(segments))
+
+	for _, v := range segments {
+		result := model.SegmentResult{Slug: v}
+
+		segmentExists, err := segmExists(ctx, tx, v)
+		if err != nil {
+			return nil, err
+		}
+
+		if !segmentExists {
+			result.Result = model.ResultUnknownSegment
+			results = append(results, result)
+			continue
+		}
+
+		removed, err := deleteUserSegm(ctx, tx, user, v, now)
+		if err != nil {
+			return nil, err
+		}
+		if removed {
+			result.Result = model.ResultRemoved
+		} else {
+			result.Result = model.ResultNotMember
+		}
+
+		results = append(results, result)
+	}
+
+	return results, nil
+}
+
+// Save Segment for User inside transaction, updating expiration of existing membership.
+// Expired membership which is not deleted yet is recorded as removed and added again.
+func saveUserSegm(ctx context.Context, tx *sql.Tx, user int, segment string, expiresAt *time.Time, now time.Time) (added bool, err error) {
+	if _, err := deleteExpiredUserSegm(ctx, tx, user, segment, now); err != nil {
+		return false, err
+	}
+
+	var expires any
+	if expiresAt != nil {
+		expires = formatTime(*expiresAt)
+	}
+
+	res, err := tx.ExecContext(ctx, `UPDATE user_segments SET expires_at=?
+		WHERE user_id=? AND segment_name=?`, expires, user, segment)
+	if err != nil {
+		return false, err
+	}
+	if affected, err := res.RowsAffected(); err != nil || affected > 0 {
+		return false, err
+	}
+
+	res, err = tx.ExecContext(ctx, `INSERT INTO user_segments(user_id, segment_name, expires_at)
+		VALUES (?, ?, ?) ON CONFLICT DO NOTHING`, user, segment, expires)
+	if err != nil {
+		return false, err
+	}
+
+	return saveHistory(ctx, tx, res, user, segment, model.OperationAdd, now)
+}
+
+// Delete Segment from User inside transaction.
+// Expired membership which is not deleted yet is recorded as removed but reported as not a member.
+func deleteUserSegm(ctx context.Context, tx *sql.Tx, user int, segment string, now time.Time) (removed bool, err error) {
+	if _, err := deleteExpiredUserSegm(ctx, tx, user, segment, now); err != nil {
+		return false, err
+	}
+
+	res, err := tx.ExecContext(ctx, "DELETE FROM user_segments WHERE user_id=? AND segment_name=?",
+		user, segment)
+	if err != nil {
+		return false, err
+	}
+
+	return saveHistory(ctx, tx, res, user, segment, model.OperationRemove, now)
+}
+
+// Delete expired Segment from User inside transaction
+func deleteExpiredUserSegm(ctx context.Context, tx *sql.Tx, user int, segment string, now time.Time) (deleted bool, err error) {
+	res, err := tx.ExecContext(ctx, `DELETE FROM user_segments
+		WHERE user_id=? AND segment_name=? AND expires_at <= ?`, user, segment, formatTime(now))
+	if err != nil {
+		return false, err
+	}
+
+	return saveHistory(ctx, tx, res, user, segment, model.OperationRemove, now)
+}
+
+// Get sorted active Segments of User inside transaction
+func userSegms(ctx context.Context, tx *sql.Tx, user int, now time.Time) ([]string, error) {
+	rows, err := tx.QueryContext(ctx, `SELECT segment_name FROM user_segments
+		WHERE user_id = ? AND (expires_at IS NULL OR expires_at > ?)
+		ORDER BY segment_name`, user, formatTime(now))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var segments []string
+	for rows.Next() {
+		var segmentName string
+		if err := rows.Scan(&segmentName); err != nil {
+			return nil, err
+		}
+		segments = append(segments, segmentName)
+	}
+
+	return segments, rows.Err()
+}
+
+// Check User existence inside transaction
+func userExists(ctx context.Context, tx *sql.Tx, user int) (exists bool, err error) {
+	err = tx.QueryRowContext(ctx, "SELECT EXISTS(SELECT 1 FROM users WHERE user_id=?)",
+		user).Scan(&exists)
+
+	return exists, err
+}
+
+// Check Segment existence inside transaction
+func segmExists(ctx context.Context, tx *sql.Tx, segment string) (exists bool, err error) {
+	err = tx.QueryRowContext(ctx, "SELECT EXISTS(SELECT 1 FROM segments WHERE segment_name=?)",
+		segment).Scan(&exists)
+
+	return exists, err
+}
+
+// Record membership change in history if the statement affected a row
+func saveHistory(ctx context.Context, tx *sql.Tx, res sql.Result, user int, segment, operation string, now time.Time) (
+	changed bool, err error) {
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	if affected == 0 {
+		return false, nil
+	}
+
+	_, err = tx.ExecContext(ctx, `INSERT INTO user_segments_history(user_id, segment_name, operation, created_at)
+		VALUES (?, ?, ?, ?)`, user, segment, operation, formatTime(now))
+
+	return err == nil, err
+}
+
+func isConstraint(err error, code int) bool {
+	var sqliteErr *sqlite.Error
+	return errors.As(err, &sqliteErr) && sqliteErr.Code() == code
+}
+
+func formatTime(t time.Time) string {
+	return t.UTC().Format(timeLayout)
+}
+
+func parseTime(s string) (time.Time, error) {
+	return time.Parse(timeLayout, s)
+}
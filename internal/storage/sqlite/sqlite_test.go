@@ -0,0 +1,26 @@
+package sqlite_test
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/m1al04949/avito-tech-service/internal/storage"
+	"github.com/m1al04949/avito-tech-service/internal/storage/sqlite"
+	"github.com/m1al04949/avito-tech-service/internal/storage/storagetest"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConformance(t *testing.T) {
+	storagetest.Run(t, func(t *testing.T) storage.Repository {
+		store := sqlite.New(filepath.Join(t.TempDir(), "segments.db"))
+		require.NoError(t, store.Open())
+		t.Cleanup(store.Close)
+		migrator, err := store.Migrator()
+		require.NoError(t, err)
+		_, err = migrator.Up(context.Background())
+		require.NoError(t, err)
+
+		return store
+	})
+}
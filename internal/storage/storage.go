@@ -1,48 +1,70 @@
 package storage
 
 import (
+	"context"
 	"database/sql"
+	"database/sql/driver"
+	"embed"
 	"errors"
 	"fmt"
+	"io/fs"
+	"strings"
+	"sync/atomic"
+	"time"
 
 	"github.com/lib/pq"
+	"github.com/m1al04949/avito-tech-service/internal/lib/sampling"
+	"github.com/m1al04949/avito-tech-service/internal/lib/sqltrace"
 	"github.com/m1al04949/avito-tech-service/internal/model"
+	"github.com/m1al04949/avito-tech-service/internal/storage/migrate"
+	semconv "go.opentelemetry.io/otel/semconv/v1.21.0"
 )
 
+//go:embed migrations/*.sql
+var migrations embed.FS
+
 type Storage struct {
 	config *Config
 	db     *sql.DB
+	// Current URL of new connections, changed when DB password is rotated
+	databaseURL atomic.Pointer[string]
 }
 
 var (
-	ErrSegmentExists     = errors.New("segment exists")
-	ErrSegmentNotExists  = errors.New("segment not exists")
-	ErrSegmentsNotExists = errors.New("segments not exists")
-	ErrUserExists        = errors.New("user exists")
-	ErrUserNotExists     = errors.New("user not exists")
-	ErrUserDelete        = errors.New("delete user from user segments table")
-	ErrSegmentDelete     = errors.New("delete segment from user segments table")
+	ErrSegmentExists      = errors.New("segment exists")
+	ErrSegmentNotExists   = errors.New("segment not exists")
+	ErrSegmentsNotExists  = errors.New("segments not exists")
+	ErrUserExists         = errors.New("user exists")
+	ErrUserNotExists      = errors.New("user not exists")
+	ErrUserDelete         = errors.New("delete user from user segments table")
+	ErrSegmentDelete      = errors.New("delete segment from user segments table")
+	ErrSegmentsConflict   = errors.New("segments are both added and removed")
+	ErrInvalidDatabaseURL = errors.New("invalid database_url")
 )
 
 // Get instance
 func New(cfgpath, dburl string) *Storage {
-	return &Storage{
+	s := &Storage{
 		config: &Config{
 			ConfigPath:  cfgpath,
 			DatabaseURL: dburl,
 		},
 	}
+	s.databaseURL.Store(&dburl)
+
+	return s
 }
 
 // Open connection to DB
 func (s *Storage) Open() error {
-
-	db, err := sql.Open("postgres", s.config.DatabaseURL)
-	if err != nil {
+	if _, err := newConnector(s.config.DatabaseURL); err != nil {
 		return err
 	}
 
+	db := sqltrace.OpenDB(connector{s}, semconv.DBSystemPostgreSQL)
+
 	if err := db.Ping(); err != nil {
+		db.Close()
 		return err
 	}
 
@@ -51,68 +73,107 @@ func (s *Storage) Open() error {
 	return nil
 }
 
-// Close connection
-func (s *Storage) Close() {
-	s.db.Close()
+// SetDatabaseURL changes URL of new connections, open ones are kept until they are recycled
+func (s *Storage) SetDatabaseURL(dburl string) error {
+	if _, err := newConnector(dburl); err != nil {
+		return err
+	}
+	s.databaseURL.Store(&dburl)
+
+	return nil
 }
 
-func (s *Storage) CreateTabs() error {
-	const op = "storage.CreateTabs"
+// connector dials DB with the current URL of storage
+type connector struct {
+	s *Storage
+}
 
-	_, err := s.db.Exec(`
-	    CREATE TABLE IF NOT EXISTS segments(
-		segment_name TEXT NOT NULL PRIMARY KEY,
-		created_at TIMESTAMP DEFAULT current_timestamp);
-		`)
+func (c connector) Connect(ctx context.Context) (driver.Conn, error) {
+	conn, err := newConnector(*c.s.databaseURL.Load())
 	if err != nil {
-		return fmt.Errorf("%s: %w", op, err)
+		return nil, err
 	}
 
-	_, err = s.db.Exec(`
-		CREATE TABLE IF NOT EXISTS users(
-		user_id INT PRIMARY KEY,
-		created_at TIMESTAMP DEFAULT current_timestamp);
-	`)
+	return conn.Connect(ctx)
+}
+
+func (c connector) Driver() driver.Driver {
+	return &pq.Driver{}
+}
+
+// newConnector parses dburl. Error of lib/pq quotes the whole URL with password,
+// so it is replaced to keep secrets out of logs
+func newConnector(dburl string) (*pq.Connector, error) {
+	conn, err := pq.NewConnector(dburl)
 	if err != nil {
-		return fmt.Errorf("%s: %w", op, err)
+		return nil, ErrInvalidDatabaseURL
 	}
 
-	_, err = s.db.Exec(`
-		CREATE TABLE IF NOT EXISTS user_segments(
-		user_id INT REFERENCES users(user_id),
-		segment_name TEXT REFERENCES segments(segment_name),
-		PRIMARY KEY (user_id, segment_name));
-	`)
+	return conn, nil
+}
+
+// Close connection
+func (s *Storage) Close() {
+	s.db.Close()
+}
+
+// DB is the underlying connection pool, for metrics of its stats
+func (s *Storage) DB() *sql.DB {
+	return s.db
+}
+
+// Ping checks connection to DB
+func (s *Storage) Ping(ctx context.Context) error {
+	return s.db.PingContext(ctx)
+}
+
+// Migrator of DB schema with migrations embedded into the binary
+func (s *Storage) Migrator() (*migrate.Migrator, error) {
+	const op = "storage.Migrator"
+
+	sub, err := fs.Sub(migrations, "migrations")
 	if err != nil {
-		return fmt.Errorf("%s: %w", op, err)
+		return nil, fmt.Errorf("%s: %w", op, err)
 	}
 
-	return nil
+	return migrate.New(s.db, migrate.Postgres, sub)
 }
 
-// Save Segment
-func (s *Storage) SaveSegm(segmToSave string) error {
+// Save Segment, enrolling autoPercent of existing users into it
+func (s *Storage) SaveSegm(ctx context.Context, segmToSave string, autoPercent int) error {
 	const op = "storage.SaveSegm"
 
 	m := &model.Segments{
 		SegmentName: segmToSave,
+		AutoPercent: autoPercent,
 	}
 
-	if err := s.db.QueryRow("SELECT (created_at) FROM segments WHERE segment_name=$1",
+	if err := s.db.QueryRowContext(ctx, "SELECT (created_at) FROM segments WHERE segment_name=$1",
 		segmToSave).Scan(&m.CreatedAt); err != nil {
-		stmt, err := s.db.Prepare("INSERT INTO segments(segment_name) VALUES ($1)")
+		tx, err := s.db.BeginTx(ctx, nil)
 		if err != nil {
 			return fmt.Errorf("%s: %w", op, err)
 		}
-		defer stmt.Close()
+		defer tx.Rollback()
 
-		_, err = stmt.Exec(segmToSave)
+		_, err = tx.ExecContext(ctx, "INSERT INTO segments(segment_name, auto_percent) VALUES ($1, $2)",
+			m.SegmentName, m.AutoPercent)
 		if err != nil {
 			if sqlErr, ok := err.(*pq.Error); ok && sqlErr.Code == "23505" {
 				return fmt.Errorf("%s: %w, created at %s", op, ErrSegmentExists, m.CreatedAt)
 			}
 			return fmt.Errorf("%s: %w", op, err)
 		}
+
+		if m.AutoPercent > 0 {
+			if err := enrollUsers(ctx, tx, m); err != nil {
+				return fmt.Errorf("%s: %w", op, err)
+			}
+		}
+
+		if err := tx.Commit(); err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
 	} else {
 		return fmt.Errorf("%s: %w, created at %s", op, ErrSegmentExists, m.CreatedAt)
 	}
@@ -121,25 +182,32 @@ func (s *Storage) SaveSegm(segmToSave string) error {
 }
 
 // Delete Segment
-func (s *Storage) DeleteSegm(segmToDelete string) error {
+func (s *Storage) DeleteSegm(ctx context.Context, segmToDelete string) error {
 	const op = "storage.DeleteSegm"
 
 	m := &model.Segments{
 		SegmentName: segmToDelete,
 	}
 
-	if err := s.db.QueryRow("SELECT (created_at) FROM segments WHERE segment_name=$1",
+	if err := s.db.QueryRowContext(ctx, "SELECT (created_at) FROM segments WHERE segment_name=$1",
 		segmToDelete).Scan(&m.CreatedAt); err != nil {
+		// Cancelled query must not be reported as missing row
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return fmt.Errorf("%s: %w", op, ctxErr)
+		}
 		return fmt.Errorf("%s: %w", op, ErrSegmentNotExists)
 	} else {
-		stmt, err := s.db.Prepare("DELETE FROM segments WHERE segment_name=$1")
+		stmt, err := s.db.PrepareContext(ctx, "DELETE FROM segments WHERE segment_name=$1")
 		if err != nil {
 			return fmt.Errorf("%s: %w", op, err)
 		}
 		defer stmt.Close()
 
-		_, err = stmt.Exec(segmToDelete)
+		_, err = stmt.ExecContext(ctx, segmToDelete)
 		if err != nil {
+			if ctxErr := ctx.Err(); ctxErr != nil {
+				return fmt.Errorf("%s: %w", op, ctxErr)
+			}
 			return fmt.Errorf("%s: %w", op, ErrSegmentDelete)
 		}
 	}
@@ -147,29 +215,205 @@ func (s *Storage) DeleteSegm(segmToDelete string) error {
 	return nil
 }
 
+// Get Segment
+func (s *Storage) GetSegm(ctx context.Context, segment string) (m model.Segments, err error) {
+	const op = "storage.getsegment"
+
+	err = s.db.QueryRowContext(ctx, `SELECT segment_name, auto_percent, created_at,
+		(SELECT COUNT(*) FROM user_segments
+		WHERE segment_name = $1 AND (expires_at IS NULL OR expires_at > now()))
+		FROM segments WHERE segment_name=$1`,
+		segment).Scan(&m.SegmentName, &m.AutoPercent, &m.CreatedAt, &m.Users)
+	if errors.Is(err, sql.ErrNoRows) {
+		return m, fmt.Errorf("%s: %w", op, ErrSegmentNotExists)
+	}
+	if err != nil {
+		return m, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return m, nil
+}
+
+// Get page of Segments with member counts
+func (s *Storage) ListSegms(ctx context.Context, filter model.SegmentsFilter) (segments []model.Segments, err error) {
+	const op = "storage.listsegments"
+
+	var key string
+	switch filter.SortBy {
+	case model.SortByCreatedAt:
+		key = "created_at"
+	case model.SortBySize:
+		key = "users"
+	default:
+		key = "segment_name"
+	}
+
+	cmp, order := ">", "ASC"
+	if filter.Desc {
+		cmp, order = "<", "DESC"
+	}
+
+	args := []any{likePrefix(filter.Prefix)}
+	where := ""
+	if filter.After != nil {
+		switch key {
+		case "created_at":
+			args = append(args, filter.After.CreatedAt)
+		case "users":
+			args = append(args, filter.After.Users)
+		}
+		args = append(args, filter.After.SegmentName)
+		if key == "segment_name" {
+			where = fmt.Sprintf("WHERE segment_name %s $2", cmp)
+		} else {
+			where = fmt.Sprintf("WHERE (%s, segment_name) %s ($2, $3)", key, cmp)
+		}
+	}
+	orderBy := fmt.Sprintf("segment_name %s", order)
+	if key != "segment_name" {
+		orderBy = fmt.Sprintf("%s %s, %s", key, order, orderBy)
+	}
+	args = append(args, filter.Limit)
+
+	query := fmt.Sprintf(`WITH s AS (
+		SELECT sg.segment_name, sg.auto_percent, sg.created_at, COUNT(us.user_id) AS users
+		FROM segments sg
+		LEFT JOIN user_segments us ON us.segment_name = sg.segment_name
+			AND (us.expires_at IS NULL OR us.expires_at > now())
+		WHERE sg.segment_name LIKE $1
+		GROUP BY sg.segment_name, sg.auto_percent, sg.created_at)
+		SELECT segment_name, auto_percent, created_at, users FROM s
+		%s ORDER BY %s LIMIT $%d`, where, orderBy, len(args))
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return segments, fmt.Errorf("%s: %w", op, err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var m model.Segments
+		if err := rows.Scan(&m.SegmentName, &m.AutoPercent, &m.CreatedAt, &m.Users); err != nil {
+			return segments, fmt.Errorf("%s: %w", op, err)
+		}
+		segments = append(segments, m)
+	}
+	if err := rows.Err(); err != nil {
+		return segments, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return segments, nil
+}
+
+// Get page of Users of Segment with user_id greater than after
+func (s *Storage) GetSegmUsers(ctx context.Context, segment string, after, limit int) (users []int, err error) {
+	const op = "storage.getsegmentusers"
+
+	var segmentExists bool
+
+	if err := s.db.QueryRowContext(ctx, "SELECT EXISTS(SELECT 1 FROM segments WHERE segment_name=$1)",
+		segment).Scan(&segmentExists); err != nil {
+		return users, fmt.Errorf("%s: %w", op, err)
+	}
+	if !segmentExists {
+		return users, fmt.Errorf("%s: %w", op, ErrSegmentNotExists)
+	}
+
+	rows, err := s.db.QueryContext(ctx, `SELECT user_id FROM user_segments
+		WHERE segment_name = $1 AND user_id > $2 AND (expires_at IS NULL OR expires_at > now())
+		ORDER BY user_id LIMIT $3`, segment, after, limit)
+	if err != nil {
+		return users, fmt.Errorf("%s: %w", op, err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var user int
+		if err := rows.Scan(&user); err != nil {
+			return users, fmt.Errorf("%s: %w", op, err)
+		}
+		users = append(users, user)
+	}
+	if err := rows.Err(); err != nil {
+		return users, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return users, nil
+}
+
+// Stream all Users of Segment to fn without loading them into memory.
+// ErrSegmentNotExists is returned before fn is called for the first time.
+func (s *Storage) StreamSegmUsers(ctx context.Context, segment string, fn func(user int) error) error {
+	const op = "storage.streamsegmentusers"
+
+	var segmentExists bool
+
+	if err := s.db.QueryRowContext(ctx, "SELECT EXISTS(SELECT 1 FROM segments WHERE segment_name=$1)",
+		segment).Scan(&segmentExists); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if !segmentExists {
+		return fmt.Errorf("%s: %w", op, ErrSegmentNotExists)
+	}
+
+	rows, err := s.db.QueryContext(ctx, `SELECT user_id FROM user_segments
+		WHERE segment_name = $1 AND (expires_at IS NULL OR expires_at > now())
+		ORDER BY user_id`, segment)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var user int
+		if err := rows.Scan(&user); err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+		if err := ctx.Err(); err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+		if err := fn(user); err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
 // Save User
-func (s *Storage) SaveUser(userToSave int) error {
+func (s *Storage) SaveUser(ctx context.Context, userToSave int) error {
 	const op = "storage.SaveUser"
 
 	m := &model.Users{
 		UserID: userToSave,
 	}
 
-	if err := s.db.QueryRow("SELECT (created_at) FROM users WHERE user_id=$1",
+	if err := s.db.QueryRowContext(ctx, "SELECT (created_at) FROM users WHERE user_id=$1",
 		userToSave).Scan(&m.CreatedAt); err != nil {
-		stmt, err := s.db.Prepare("INSERT INTO users(user_id) VALUES ($1)")
+		tx, err := s.db.BeginTx(ctx, nil)
 		if err != nil {
 			return fmt.Errorf("%s: %w", op, err)
 		}
-		defer stmt.Close()
+		defer tx.Rollback()
 
-		_, err = stmt.Exec(userToSave)
+		_, err = tx.ExecContext(ctx, "INSERT INTO users(user_id) VALUES ($1)", userToSave)
 		if err != nil {
 			if sqlErr, ok := err.(*pq.Error); ok && sqlErr.Code == "23505" {
 				return fmt.Errorf("%s: %w, created at %s", op, ErrUserExists, m.CreatedAt)
 			}
 			return fmt.Errorf("%s: %w", op, err)
 		}
+
+		if err := enrollUser(ctx, tx, m); err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+
+		if err := tx.Commit(); err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
 	} else {
 		return fmt.Errorf("%s: %w, created at %s", op, ErrUserExists, m.CreatedAt)
 	}
@@ -178,25 +422,32 @@ func (s *Storage) SaveUser(userToSave int) error {
 }
 
 // Delete User
-func (s *Storage) DeleteUser(userToDelete int) error {
+func (s *Storage) DeleteUser(ctx context.Context, userToDelete int) error {
 	const op = "storage.DeleteUser"
 
 	m := &model.Users{
 		UserID: userToDelete,
 	}
 
-	if err := s.db.QueryRow("SELECT (created_at) FROM users WHERE user_id=$1",
+	if err := s.db.QueryRowContext(ctx, "SELECT (created_at) FROM users WHERE user_id=$1",
 		userToDelete).Scan(&m.CreatedAt); err != nil {
+		// Cancelled query must not be reported as missing row
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return fmt.Errorf("%s: %w", op, ctxErr)
+		}
 		return fmt.Errorf("%s: %w", op, ErrUserNotExists)
 	} else {
-		stmt, err := s.db.Prepare("DELETE FROM users WHERE user_id=$1")
+		stmt, err := s.db.PrepareContext(ctx, "DELETE FROM users WHERE user_id=$1")
 		if err != nil {
 			return fmt.Errorf("%s: %w", op, err)
 		}
 		defer stmt.Close()
 
-		_, err = stmt.Exec(userToDelete)
+		_, err = stmt.ExecContext(ctx, userToDelete)
 		if err != nil {
+			if ctxErr := ctx.Err(); ctxErr != nil {
+				return fmt.Errorf("%s: %w", op, ctxErr)
+			}
 			return fmt.Errorf("%s: %w", op, ErrUserDelete)
 		}
 	}
@@ -204,107 +455,73 @@ func (s *Storage) DeleteUser(userToDelete int) error {
 	return nil
 }
 
-// Save Segments for User
-func (s *Storage) SaveSegmToUser(user int, segments []string) error {
+// Save Segments for User, returning outcome for every segment
+func (s *Storage) SaveSegmToUser(ctx context.Context, user int, segments []model.UserSegments) (results []model.SegmentResult, err error) {
 	const op = "storage.AddToUser"
 
-	var userExists bool
-
-	if err := s.db.QueryRow("SELECT EXISTS(SELECT 1 FROM users WHERE user_id=$1)",
-		user).Scan(&userExists); err != nil {
-		return fmt.Errorf("%s: %w", op, err)
-	}
-	if !userExists {
-		return fmt.Errorf("%s: %w", op, ErrUserNotExists)
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return results, fmt.Errorf("%s: %w", op, err)
 	}
+	defer tx.Rollback()
 
-	existingSegments := make([]string, 0, len(segments))
-	for _, v := range segments {
-		var segmentExists bool
-		err := s.db.QueryRow("SELECT EXISTS(SELECT 1 FROM segments WHERE segment_name=$1)", v).Scan(&segmentExists)
-		if err != nil {
-			return fmt.Errorf("%s: %w", op, err)
-		}
-		if segmentExists {
-			existingSegments = append(existingSegments, v)
-		}
+	userExists, err := userExists(ctx, tx, user)
+	if err != nil {
+		return results, fmt.Errorf("%s: %w", op, err)
 	}
-	if len(existingSegments) == 0 {
-		return fmt.Errorf("%s: %w", op, ErrSegmentsNotExists)
+	if !userExists {
+		return results, fmt.Errorf("%s: %w", op, ErrUserNotExists)
 	}
 
-	stmt, err := s.db.Prepare("INSERT INTO user_segments(user_id, segment_name) VALUES ($1, $2)")
+	results, err = saveUserSegms(ctx, tx, user, segments)
 	if err != nil {
-		return fmt.Errorf("%s: %w", op, err)
+		return nil, fmt.Errorf("%s: %w", op, err)
 	}
-	defer stmt.Close()
 
-	for _, v := range existingSegments {
-		_, err := stmt.Exec(user, v)
-		if err != nil {
-			if sqlErr, ok := err.(*pq.Error); ok && sqlErr.Code == "23505" {
-				continue
-			}
-		}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
 	}
 
-	return nil
+	return results, nil
 }
 
-// Delete Segments for User
-func (s *Storage) DeleteSegmFromUser(user int, segments []string) error {
+// Delete Segments for User, returning outcome for every segment
+func (s *Storage) DeleteSegmFromUser(ctx context.Context, user int, segments []string) (results []model.SegmentResult, err error) {
 	const op = "storage.deletesegmentsfromuser"
 
-	var userExists bool
-
-	if err := s.db.QueryRow("SELECT EXISTS(SELECT 1 FROM users WHERE user_id=$1)",
-		user).Scan(&userExists); err != nil {
-		return fmt.Errorf("%s: %w", op, err)
-	}
-	if !userExists {
-		return fmt.Errorf("%s: %w", op, ErrUserNotExists)
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return results, fmt.Errorf("%s: %w", op, err)
 	}
+	defer tx.Rollback()
 
-	existingSegments := make([]string, 0, len(segments))
-	for _, v := range segments {
-		var segmentExists bool
-		err := s.db.QueryRow("SELECT EXISTS(SELECT 1 FROM segments WHERE segment_name=$1)", v).Scan(&segmentExists)
-		if err != nil {
-			return fmt.Errorf("%s: %w", op, err)
-		}
-		if segmentExists {
-			existingSegments = append(existingSegments, v)
-		}
+	userExists, err := userExists(ctx, tx, user)
+	if err != nil {
+		return results, fmt.Errorf("%s: %w", op, err)
 	}
-	if len(existingSegments) == 0 {
-		return fmt.Errorf("%s: %w", op, ErrSegmentsNotExists)
+	if !userExists {
+		return results, fmt.Errorf("%s: %w", op, ErrUserNotExists)
 	}
 
-	stmt, err := s.db.Prepare("DELETE FROM user_segments WHERE user_id=$1 AND segment_name=$2")
+	results, err = deleteUserSegms(ctx, tx, user, segments)
 	if err != nil {
-		return fmt.Errorf("%s: %w", op, err)
+		return nil, fmt.Errorf("%s: %w", op, err)
 	}
-	defer stmt.Close()
 
-	for _, v := range existingSegments {
-		_, err := stmt.Exec(user, v)
-		if err != nil {
-			if sqlErr, ok := err.(*pq.Error); ok && sqlErr.Code == "23505" {
-				continue
-			}
-		}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
 	}
 
-	return nil
+	return results, nil
 }
 
 // Get User Info
-func (s *Storage) GetUser(user int) (segments []string, err error) {
+func (s *Storage) GetUser(ctx context.Context, user int) (segments []string, err error) {
 	const op = "storage.getuser"
 
 	var userExists bool
 
-	if err := s.db.QueryRow("SELECT EXISTS(SELECT 1 FROM users WHERE user_id=$1)",
+	if err := s.db.QueryRowContext(ctx, "SELECT EXISTS(SELECT 1 FROM users WHERE user_id=$1)",
 		user).Scan(&userExists); err != nil {
 		return segments, fmt.Errorf("%s: %w", op, err)
 	}
@@ -312,7 +529,8 @@ func (s *Storage) GetUser(user int) (segments []string, err error) {
 		return segments, fmt.Errorf("%s: %w", op, ErrUserNotExists)
 	}
 
-	rows, err := s.db.Query("SELECT segment_name FROM user_segments WHERE user_id = $1", user)
+	rows, err := s.db.QueryContext(ctx, `SELECT segment_name FROM user_segments
+		WHERE user_id = $1 AND (expires_at IS NULL OR expires_at > now())`, user)
 	if err != nil {
 		return segments, fmt.Errorf("%s: %w", op, err)
 	}
@@ -331,3 +549,323 @@ func (s *Storage) GetUser(user int) (segments []string, err error) {
 
 	return segments, nil
 }
+
+// Add and delete Segments for User in single transaction, returning resulting Segments
+func (s *Storage) UpdateUserSegments(ctx context.Context, user int, add []model.UserSegments, remove []string) (
+	segments []string, results []model.SegmentResult, err error) {
+	const op = "storage.updateusersegments"
+
+	removeSet := make(map[string]struct{}, len(remove))
+	for _, v := range remove {
+		removeSet[v] = struct{}{}
+	}
+	for _, v := range add {
+		if _, ok := removeSet[v.SegmentName]; ok {
+			return segments, results, fmt.Errorf("%s: %w: %s", op, ErrSegmentsConflict, v.SegmentName)
+		}
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return segments, results, fmt.Errorf("%s: %w", op, err)
+	}
+	defer tx.Rollback()
+
+	// Lock user row so concurrent updates of the same user are applied one by one
+	err = tx.QueryRowContext(ctx, "SELECT user_id FROM users WHERE user_id=$1 FOR UPDATE", user).Scan(&user)
+	if errors.Is(err, sql.ErrNoRows) {
+		return segments, results, fmt.Errorf("%s: %w", op, ErrUserNotExists)
+	}
+	if err != nil {
+		return segments, results, fmt.Errorf("%s: %w", op, err)
+	}
+
+	added, err := saveUserSegms(ctx, tx, user, add)
+	if err != nil {
+		return segments, results, fmt.Errorf("%s: %w", op, err)
+	}
+	removed, err := deleteUserSegms(ctx, tx, user, remove)
+	if err != nil {
+		return segments, results, fmt.Errorf("%s: %w", op, err)
+	}
+	results = append(added, removed...)
+
+	rows, err := tx.QueryContext(ctx, `SELECT segment_name FROM user_segments
+		WHERE user_id = $1 AND (expires_at IS NULL OR expires_at > now())
+		ORDER BY segment_name`, user)
+	if err != nil {
+		return segments, results, fmt.Errorf("%s: %w", op, err)
+	}
+
+	for rows.Next() {
+		var segmentName string
+		if err := rows.Scan(&segmentName); err != nil {
+			rows.Close()
+			return segments, results, fmt.Errorf("%s: %w", op, err)
+		}
+		segments = append(segments, segmentName)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return segments, results, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return segments, results, nil
+}
+
+// Get History of User Segments for period [from, to)
+func (s *Storage) GetHistory(ctx context.Context, from, to time.Time) (history []model.UserSegmentsHistory, err error) {
+	const op = "storage.gethistory"
+
+	rows, err := s.db.QueryContext(ctx, `SELECT user_id, segment_name, operation, created_at
+		FROM user_segments_history
+		WHERE created_at >= $1 AND created_at < $2
+		ORDER BY created_at, id`, from, to)
+	if err != nil {
+		return history, fmt.Errorf("%s: %w", op, err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var h model.UserSegmentsHistory
+		if err := rows.Scan(&h.UserID, &h.SegmentName, &h.Operation, &h.CreatedAt); err != nil {
+			return history, fmt.Errorf("%s: %w", op, err)
+		}
+		history = append(history, h)
+	}
+	if err := rows.Err(); err != nil {
+		return history, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return history, nil
+}
+
+// Delete expired Segments from all Users
+func (s *Storage) DeleteExpired(ctx context.Context) (deleted int, err error) {
+	const op = "storage.deleteexpired"
+
+	res, err := s.db.ExecContext(ctx, `WITH expired AS (
+		DELETE FROM user_segments WHERE expires_at <= now()
+		RETURNING user_id, segment_name)
+		INSERT INTO user_segments_history(user_id, segment_name, operation)
+		SELECT user_id, segment_name, $1 FROM expired`, model.OperationRemove)
+	if err != nil {
+		return deleted, fmt.Errorf("%s: %w", op, err)
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return deleted, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return int(affected), nil
+}
+
+// Enroll existing users into new segment according to its auto percent.
+// Predicate is sampling.InPercent computed by DB, so users are not loaded into memory
+func enrollUsers(ctx context.Context, tx *sql.Tx, segm *model.Segments) error {
+	_, err := tx.ExecContext(ctx, `WITH enrolled AS (
+		INSERT INTO user_segments(user_id, segment_name)
+		SELECT user_id, $1 FROM users
+		WHERE ('x' || left(md5($1::text || ':' || user_id), 8))::bit(32)::bigint % 100 < $2
+		ON CONFLICT DO NOTHING
+		RETURNING user_id, segment_name)
+		INSERT INTO user_segments_history(user_id, segment_name, operation)
+		SELECT user_id, segment_name, $3 FROM enrolled`,
+		segm.SegmentName, segm.AutoPercent, model.OperationAdd)
+
+	return err
+}
+
+// Enroll new user into segments with auto percent
+func enrollUser(ctx context.Context, tx *sql.Tx, user *model.Users) error {
+	rows, err := tx.QueryContext(ctx, "SELECT segment_name, auto_percent FROM segments WHERE auto_percent > 0")
+	if err != nil {
+		return err
+	}
+
+	var segments []string
+	for rows.Next() {
+		var segm model.Segments
+		if err := rows.Scan(&segm.SegmentName, &segm.AutoPercent); err != nil {
+			rows.Close()
+			return err
+		}
+		if sampling.InPercent(user.UserID, segm.SegmentName, segm.AutoPercent) {
+			segments = append(segments, segm.SegmentName)
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, segment := range segments {
+		if _, err := saveUserSegm(ctx, tx, user.UserID, segment, nil); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Save Segments for User inside transaction
+func saveUserSegms(ctx context.Context, tx *sql.Tx, user int, segments []model.UserSegments) ([]model.SegmentResult, error) {
+	results := make([]model.SegmentResult, 0, len(segments))
+
+	for _, v := range segments {
+		result := model.SegmentResult{Slug: v.SegmentName}
+
+		segmentExists, err := segmExists(ctx, tx, v.SegmentName)
+		if err != nil {
+			return nil, err
+		}
+
+		if !segmentExists {
+			result.Result = model.ResultUnknownSegment
+			results = append(results, result)
+			continue
+		}
+
+		added, err := saveUserSegm(ctx, tx, user, v.SegmentName, v.ExpiresAt)
+		if err != nil {
+			return nil, err
+		}
+		if added {
+			result.Result = model.ResultAdded
+		} else {
+			result.Result = model.ResultAlreadyMember
+		}
+
+		results = append(results, result)
+	}
+
+	return results, nil
+}
+
+// Delete Segments from User inside transaction
+func deleteUserSegms(ctx context.Context, tx *sql.Tx, user int, segments []string) ([]model.SegmentResult, error) {
+	results := make([]model.SegmentResult, 0, len(segments))
+
+	for _, v := range segments {
+		result := model.SegmentResult{Slug: v}
+
+		segmentExists, err := segmExists(ctx, tx, v)
+		if err != nil {
+			return nil, err
+		}
+
+		if !segmentExists {
+			result.Result = model.ResultUnknownSegment
+			results = append(results, result)
+			continue
+		}
+
+		removed, err := deleteUserSegm(ctx, tx, user, v)
+		if err != nil {
+			return nil, err
+		}
+		if removed {
+			result.Result = model.ResultRemoved
+		} else {
+			result.Result = model.ResultNotMember
+		}
+
+		results = append(results, result)
+	}
+
+	return results, nil
+}
+
+// Save Segment for User inside transaction, updating expiration of existing membership.
+// Expired membership which is not deleted yet is recorded as removed and added again.
+func saveUserSegm(ctx context.Context, tx *sql.Tx, user int, segment string, expiresAt *time.Time) (added bool, err error) {
+	if _, err := deleteExpiredUserSegm(ctx, tx, user, segment); err != nil {
+		return false, err
+	}
+
+	res, err := tx.ExecContext(ctx, `UPDATE user_segments SET expires_at=$3
+		WHERE user_id=$1 AND segment_name=$2`, user, segment, expiresAt)
+	if err != nil {
+		return false, err
+	}
+	if affected, err := res.RowsAffected(); err != nil || affected > 0 {
+		return false, err
+	}
+
+	res, err = tx.ExecContext(ctx, `INSERT INTO user_segments(user_id, segment_name, expires_at)
+		VALUES ($1, $2, $3) ON CONFLICT DO NOTHING`, user, segment, expiresAt)
+	if err != nil {
+		return false, err
+	}
+
+	return saveHistory(ctx, tx, res, user, segment, model.OperationAdd)
+}
+
+// Delete Segment from User inside transaction.
+// Expired membership which is not deleted yet is recorded as removed but reported as not a member.
+func deleteUserSegm(ctx context.Context, tx *sql.Tx, user int, segment string) (removed bool, err error) {
+	if _, err := deleteExpiredUserSegm(ctx, tx, user, segment); err != nil {
+		return false, err
+	}
+
+	res, err := tx.ExecContext(ctx, "DELETE FROM user_segments WHERE user_id=$1 AND segment_name=$2",
+		user, segment)
+	if err != nil {
+		return false, err
+	}
+
+	return saveHistory(ctx, tx, res, user, segment, model.OperationRemove)
+}
+
+// Delete expired Segment from User inside transaction
+func deleteExpiredUserSegm(ctx context.Context, tx *sql.Tx, user int, segment string) (deleted bool, err error) {
+	res, err := tx.ExecContext(ctx, `DELETE FROM user_segments
+		WHERE user_id=$1 AND segment_name=$2 AND expires_at <= now()`, user, segment)
+	if err != nil {
+		return false, err
+	}
+
+	return saveHistory(ctx, tx, res, user, segment, model.OperationRemove)
+}
+
+// Build LIKE pattern matching values starting with prefix
+func likePrefix(prefix string) string {
+	return strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(prefix) + "%"
+}
+
+// Check User existence inside transaction
+func userExists(ctx context.Context, tx *sql.Tx, user int) (exists bool, err error) {
+	err = tx.QueryRowContext(ctx, "SELECT EXISTS(SELECT 1 FROM users WHERE user_id=$1)",
+		user).Scan(&exists)
+
+	return exists, err
+}
+
+// Check Segment existence inside transaction
+func segmExists(ctx context.Context, tx *sql.Tx, segment string) (exists bool, err error) {
+	err = tx.QueryRowContext(ctx, "SELECT EXISTS(SELECT 1 FROM segments WHERE segment_name=$1)",
+		segment).Scan(&exists)
+
+	return exists, err
+}
+
+// Record membership change in history if the statement affected a row
+func saveHistory(ctx context.Context, tx *sql.Tx, res sql.Result, user int, segment, operation string) (changed bool, err error) {
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	if affected == 0 {
+		return false, nil
+	}
+
+	_, err = tx.ExecContext(ctx, `INSERT INTO user_segments_history(user_id, segment_name, operation)
+		VALUES ($1, $2, $3)`, user, segment, operation)
+
+	return err == nil, err
+}
@@ -0,0 +1,475 @@
+// Package storagetest is a conformance suite which every storage.Repository
+// implementation must pass to be interchangeable with the others.
+package storagetest
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/m1al04949/avito-tech-service/internal/lib/sampling"
+	"github.com/m1al04949/avito-tech-service/internal/model"
+	"github.com/m1al04949/avito-tech-service/internal/storage"
+	"github.com/stretchr/testify/require"
+)
+
+var ctx = context.Background()
+
+// Run runs the suite, newRepo must return empty repository for every call
+func Run(t *testing.T, newRepo func(t *testing.T) storage.Repository) {
+	tests := []struct {
+		name string
+		fn   func(t *testing.T, repo storage.Repository)
+	}{
+		{"Segments", testSegments},
+		{"Users", testUsers},
+		{"AddAndRemoveSegments", testAddAndRemoveSegments},
+		{"UpdateUserSegments", testUpdateUserSegments},
+		{"AutoPercent", testAutoPercent},
+		{"Expiration", testExpiration},
+		{"ListSegments", testListSegments},
+		{"SegmentUsers", testSegmentUsers},
+		{"History", testHistory},
+		{"Cancellation", testCancellation},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			tc.fn(t, newRepo(t))
+		})
+	}
+}
+
+func testSegments(t *testing.T, repo storage.Repository) {
+	require.NoError(t, repo.SaveSegm(ctx, "A", 0))
+	require.ErrorIs(t, repo.SaveSegm(ctx, "A", 0), storage.ErrSegmentExists)
+
+	segment, err := repo.GetSegm(ctx, "A")
+	require.NoError(t, err)
+	require.Equal(t, "A", segment.SegmentName)
+	require.Zero(t, segment.Users)
+	require.WithinDuration(t, time.Now(), segment.CreatedAt, time.Minute)
+
+	_, err = repo.GetSegm(ctx, "B")
+	require.ErrorIs(t, err, storage.ErrSegmentNotExists)
+
+	require.NoError(t, repo.SaveUser(ctx, 1))
+	addSegments(t, repo, 1, "A")
+	require.ErrorIs(t, repo.DeleteSegm(ctx, "A"), storage.ErrSegmentDelete)
+
+	removeSegments(t, repo, 1, "A")
+	require.NoError(t, repo.DeleteSegm(ctx, "A"))
+	require.ErrorIs(t, repo.DeleteSegm(ctx, "A"), storage.ErrSegmentNotExists)
+}
+
+func testUsers(t *testing.T, repo storage.Repository) {
+	require.NoError(t, repo.SaveUser(ctx, 1))
+	require.ErrorIs(t, repo.SaveUser(ctx, 1), storage.ErrUserExists)
+
+	segments, err := repo.GetUser(ctx, 1)
+	require.NoError(t, err)
+	require.Empty(t, segments)
+
+	_, err = repo.GetUser(ctx, 2)
+	require.ErrorIs(t, err, storage.ErrUserNotExists)
+
+	require.NoError(t, repo.SaveSegm(ctx, "A", 0))
+	addSegments(t, repo, 1, "A")
+	require.ErrorIs(t, repo.DeleteUser(ctx, 1), storage.ErrUserDelete)
+
+	removeSegments(t, repo, 1, "A")
+	require.NoError(t, repo.DeleteUser(ctx, 1))
+	require.ErrorIs(t, repo.DeleteUser(ctx, 1), storage.ErrUserNotExists)
+}
+
+func testAddAndRemoveSegments(t *testing.T, repo storage.Repository) {
+	require.NoError(t, repo.SaveSegm(ctx, "A", 0))
+	require.NoError(t, repo.SaveSegm(ctx, "B", 0))
+
+	_, err := repo.SaveSegmToUser(ctx, 1, userSegments("A"))
+	require.ErrorIs(t, err, storage.ErrUserNotExists)
+	_, err = repo.DeleteSegmFromUser(ctx, 1, []string{"A"})
+	require.ErrorIs(t, err, storage.ErrUserNotExists)
+
+	require.NoError(t, repo.SaveUser(ctx, 1))
+
+	results, err := repo.SaveSegmToUser(ctx, 1, userSegments("A", "UNKNOWN"))
+	require.NoError(t, err)
+	require.Equal(t, []model.SegmentResult{
+		{Slug: "A", Result: model.ResultAdded},
+		{Slug: "UNKNOWN", Result: model.ResultUnknownSegment},
+	}, results)
+
+	results, err = repo.SaveSegmToUser(ctx, 1, userSegments("A", "B"))
+	require.NoError(t, err)
+	require.Equal(t, []model.SegmentResult{
+		{Slug: "A", Result: model.ResultAlreadyMember},
+		{Slug: "B", Result: model.ResultAdded},
+	}, results)
+
+	requireUserSegments(t, repo, 1, "A", "B")
+
+	results, err = repo.DeleteSegmFromUser(ctx, 1, []string{"A", "A", "UNKNOWN"})
+	require.NoError(t, err)
+	require.Equal(t, []model.SegmentResult{
+		{Slug: "A", Result: model.ResultRemoved},
+		{Slug: "A", Result: model.ResultNotMember},
+		{Slug: "UNKNOWN", Result: model.ResultUnknownSegment},
+	}, results)
+
+	requireUserSegments(t, repo, 1, "B")
+}
+
+func testUpdateUserSegments(t *testing.T, repo storage.Repository) {
+	require.NoError(t, repo.SaveSegm(ctx, "A", 0))
+	require.NoError(t, repo.SaveSegm(ctx, "B", 0))
+	require.NoError(t, repo.SaveSegm(ctx, "C", 0))
+
+	_, _, err := repo.UpdateUserSegments(ctx, 1, userSegments("A"), nil)
+	require.ErrorIs(t, err, storage.ErrUserNotExists)
+
+	require.NoError(t, repo.SaveUser(ctx, 1))
+	addSegments(t, repo, 1, "A")
+
+	_, _, err = repo.UpdateUserSegments(ctx, 1, userSegments("B"), []string{"B"})
+	require.ErrorIs(t, err, storage.ErrSegmentsConflict)
+	requireUserSegments(t, repo, 1, "A")
+
+	segments, results, err := repo.UpdateUserSegments(ctx, 1, userSegments("C", "B"), []string{"A"})
+	require.NoError(t, err)
+	require.Equal(t, []string{"B", "C"}, segments)
+	require.Equal(t, []model.SegmentResult{
+		{Slug: "C", Result: model.ResultAdded},
+		{Slug: "B", Result: model.ResultAdded},
+		{Slug: "A", Result: model.ResultRemoved},
+	}, results)
+}
+
+func testAutoPercent(t *testing.T, repo storage.Repository) {
+	const percent = 30
+
+	// Users created before and after the segment are enrolled the same way
+	for user := 1; user <= 50; user++ {
+		require.NoError(t, repo.SaveUser(ctx, user))
+	}
+	require.NoError(t, repo.SaveSegm(ctx, "AUTO", percent))
+	for user := 51; user <= 100; user++ {
+		require.NoError(t, repo.SaveUser(ctx, user))
+	}
+
+	var expected []int
+	for user := 1; user <= 100; user++ {
+		if sampling.InPercent(user, "AUTO", percent) {
+			expected = append(expected, user)
+		}
+	}
+
+	users, err := repo.GetSegmUsers(ctx, "AUTO", 0, 1000)
+	require.NoError(t, err)
+	require.Equal(t, expected, users)
+
+	segment, err := repo.GetSegm(ctx, "AUTO")
+	require.NoError(t, err)
+	require.Equal(t, percent, segment.AutoPercent)
+	require.Equal(t, len(expected), segment.Users)
+}
+
+func testExpiration(t *testing.T, repo storage.Repository) {
+	require.NoError(t, repo.SaveSegm(ctx, "A", 0))
+	require.NoError(t, repo.SaveSegm(ctx, "B", 0))
+	require.NoError(t, repo.SaveUser(ctx, 1))
+	require.NoError(t, repo.SaveUser(ctx, 2))
+
+	past := time.Now().Add(-time.Hour)
+	future := time.Now().Add(time.Hour)
+
+	_, err := repo.SaveSegmToUser(ctx, 1, []model.UserSegments{
+		{SegmentName: "A", ExpiresAt: &past},
+		{SegmentName: "B", ExpiresAt: &future},
+	})
+	require.NoError(t, err)
+	_, err = repo.SaveSegmToUser(ctx, 2, []model.UserSegments{{SegmentName: "A", ExpiresAt: &past}})
+	require.NoError(t, err)
+
+	// Expired memberships are not visible
+	requireUserSegments(t, repo, 1, "B")
+	segment, err := repo.GetSegm(ctx, "A")
+	require.NoError(t, err)
+	require.Zero(t, segment.Users)
+
+	// Expired membership is reported as missing and replaced
+	results, err := repo.SaveSegmToUser(ctx, 1, userSegments("A"))
+	require.NoError(t, err)
+	require.Equal(t, model.ResultAdded, results[0].Result)
+	requireUserSegments(t, repo, 1, "A", "B")
+
+	results, err = repo.DeleteSegmFromUser(ctx, 2, []string{"A"})
+	require.NoError(t, err)
+	require.Equal(t, model.ResultNotMember, results[0].Result)
+
+	// Expiration of existing membership is updated
+	_, err = repo.SaveSegmToUser(ctx, 1, []model.UserSegments{{SegmentName: "B", ExpiresAt: &past}})
+	require.NoError(t, err)
+	requireUserSegments(t, repo, 1, "A")
+
+	deleted, err := repo.DeleteExpired(ctx)
+	require.NoError(t, err)
+	require.Equal(t, 1, deleted)
+
+	deleted, err = repo.DeleteExpired(ctx)
+	require.NoError(t, err)
+	require.Zero(t, deleted)
+
+	require.NoError(t, repo.DeleteSegm(ctx, "B"))
+}
+
+func testListSegments(t *testing.T, repo storage.Repository) {
+	// Sizes are distinct, so the order does not depend on DB collation
+	names := []string{"A_1", "A_2", "AX1", "a_3", "B"}
+	for _, name := range names {
+		require.NoError(t, repo.SaveSegm(ctx, name, 0))
+	}
+	for user := 1; user <= 4; user++ {
+		require.NoError(t, repo.SaveUser(ctx, user))
+	}
+	addSegments(t, repo, 1, "B", "AX1", "A_2", "a_3")
+	addSegments(t, repo, 2, "B", "AX1", "A_2")
+	addSegments(t, repo, 3, "B", "AX1")
+	addSegments(t, repo, 4, "B")
+
+	// Prefix is matched literally and case sensitively
+	segments := listAll(t, repo, model.SegmentsFilter{Prefix: "A_", SortBy: model.SortByName})
+	require.Equal(t, []string{"A_1", "A_2"}, segmentNames(segments))
+
+	segments = listAll(t, repo, model.SegmentsFilter{Prefix: "A_", SortBy: model.SortByName, Desc: true})
+	require.Equal(t, []string{"A_2", "A_1"}, segmentNames(segments))
+
+	segments = listAll(t, repo, model.SegmentsFilter{SortBy: model.SortBySize, Desc: true})
+	require.Equal(t, []string{"B", "AX1", "A_2", "a_3", "A_1"}, segmentNames(segments))
+	for i, v := range segments {
+		require.Equal(t, 4-i, v.Users)
+	}
+
+	segments = listAll(t, repo, model.SegmentsFilter{SortBy: model.SortBySize})
+	require.Equal(t, []string{"A_1", "a_3", "A_2", "AX1", "B"}, segmentNames(segments))
+
+	segments = listAll(t, repo, model.SegmentsFilter{SortBy: model.SortByCreatedAt})
+	require.Len(t, segments, len(names))
+	require.True(t, sort.SliceIsSorted(segments, func(i, j int) bool {
+		return segments[i].CreatedAt.Before(segments[j].CreatedAt)
+	}))
+}
+
+func testSegmentUsers(t *testing.T, repo storage.Repository) {
+	_, err := repo.GetSegmUsers(ctx, "A", 0, 10)
+	require.ErrorIs(t, err, storage.ErrSegmentNotExists)
+	require.ErrorIs(t, repo.StreamSegmUsers(ctx, "A", func(int) error {
+		t.Fatal("fn is called for unknown segment")
+		return nil
+	}), storage.ErrSegmentNotExists)
+
+	require.NoError(t, repo.SaveSegm(ctx, "A", 0))
+
+	users, err := repo.GetSegmUsers(ctx, "A", 0, 10)
+	require.NoError(t, err)
+	require.Empty(t, users)
+
+	var expected []int
+	for user := 2500; user > 0; user -= 1 {
+		require.NoError(t, repo.SaveUser(ctx, user))
+		if user%2 == 0 {
+			addSegments(t, repo, user, "A")
+		}
+	}
+	for user := 2; user <= 2500; user += 2 {
+		expected = append(expected, user)
+	}
+
+	users, err = repo.GetSegmUsers(ctx, "A", 0, 3)
+	require.NoError(t, err)
+	require.Equal(t, []int{2, 4, 6}, users)
+
+	users, err = repo.GetSegmUsers(ctx, "A", 6, 2)
+	require.NoError(t, err)
+	require.Equal(t, []int{8, 10}, users)
+
+	var streamed []int
+	require.NoError(t, repo.StreamSegmUsers(ctx, "A", func(user int) error {
+		streamed = append(streamed, user)
+		return nil
+	}))
+	require.Equal(t, expected, streamed)
+
+	stop := fmt.Errorf("stop")
+	require.ErrorIs(t, repo.StreamSegmUsers(ctx, "A", func(int) error { return stop }), stop)
+}
+
+func testHistory(t *testing.T, repo storage.Repository) {
+	from := time.Now().Add(-time.Minute)
+
+	require.NoError(t, repo.SaveSegm(ctx, "A", 0))
+	require.NoError(t, repo.SaveUser(ctx, 1))
+	addSegments(t, repo, 1, "A")
+	addSegments(t, repo, 1, "A")
+	removeSegments(t, repo, 1, "A")
+	removeSegments(t, repo, 1, "A")
+
+	to := time.Now().Add(time.Minute)
+
+	history, err := repo.GetHistory(ctx, from, to)
+	require.NoError(t, err)
+	require.Len(t, history, 2)
+	require.Equal(t, model.OperationAdd, history[0].Operation)
+	require.Equal(t, model.OperationRemove, history[1].Operation)
+	for _, h := range history {
+		require.Equal(t, 1, h.UserID)
+		require.Equal(t, "A", h.SegmentName)
+		require.WithinDuration(t, time.Now(), h.CreatedAt, time.Minute)
+	}
+
+	history, err = repo.GetHistory(ctx, to, to.Add(time.Hour))
+	require.NoError(t, err)
+	require.Empty(t, history)
+}
+
+func testCancellation(t *testing.T, repo storage.Repository) {
+	require.NoError(t, repo.SaveSegm(ctx, "A", 0))
+	for user := 1; user <= 3; user++ {
+		require.NoError(t, repo.SaveUser(ctx, user))
+		addSegments(t, repo, user, "A")
+	}
+
+	cancelled, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var streamed []int
+	err := repo.StreamSegmUsers(cancelled, "A", func(user int) error {
+		streamed = append(streamed, user)
+		cancel()
+		return nil
+	})
+	require.ErrorIs(t, err, context.Canceled)
+	require.Equal(t, []int{1}, streamed)
+
+	// Every operation is stopped with done context and changes nothing
+	for name, call := range map[string]func() error{
+		"SaveSegm":   func() error { return repo.SaveSegm(cancelled, "B", 50) },
+		"DeleteSegm": func() error { return repo.DeleteSegm(cancelled, "A") },
+		"GetSegm": func() error {
+			_, err := repo.GetSegm(cancelled, "A")
+			return err
+		},
+		"ListSegms": func() error {
+			_, err := repo.ListSegms(cancelled, model.SegmentsFilter{SortBy: model.SortByName, Limit: 10})
+			return err
+		},
+		"GetSegmUsers": func() error {
+			_, err := repo.GetSegmUsers(cancelled, "A", 0, 10)
+			return err
+		},
+		"StreamSegmUsers": func() error {
+			return repo.StreamSegmUsers(cancelled, "A", func(int) error { return nil })
+		},
+		"SaveUser":   func() error { return repo.SaveUser(cancelled, 4) },
+		"DeleteUser": func() error { return repo.DeleteUser(cancelled, 1) },
+		"GetUser": func() error {
+			_, err := repo.GetUser(cancelled, 1)
+			return err
+		},
+		"SaveSegmToUser": func() error {
+			_, err := repo.SaveSegmToUser(cancelled, 1, userSegments("A"))
+			return err
+		},
+		"DeleteSegmFromUser": func() error {
+			_, err := repo.DeleteSegmFromUser(cancelled, 1, []string{"A"})
+			return err
+		},
+		"UpdateUserSegments": func() error {
+			_, _, err := repo.UpdateUserSegments(cancelled, 1, nil, []string{"A"})
+			return err
+		},
+		"GetHistory": func() error {
+			_, err := repo.GetHistory(cancelled, time.Now().Add(-time.Hour), time.Now().Add(time.Hour))
+			return err
+		},
+		"DeleteExpired": func() error {
+			_, err := repo.DeleteExpired(cancelled)
+			return err
+		},
+	} {
+		require.ErrorIs(t, call(), context.Canceled, name)
+	}
+
+	_, err = repo.GetSegm(ctx, "B")
+	require.ErrorIs(t, err, storage.ErrSegmentNotExists)
+	_, err = repo.GetUser(ctx, 4)
+	require.ErrorIs(t, err, storage.ErrUserNotExists)
+	for user := 1; user <= 3; user++ {
+		segments, err := repo.GetUser(ctx, user)
+		require.NoError(t, err)
+		require.Equal(t, []string{"A"}, segments)
+	}
+}
+
+func userSegments(segments ...string) []model.UserSegments {
+	res := make([]model.UserSegments, 0, len(segments))
+	for _, v := range segments {
+		res = append(res, model.UserSegments{SegmentName: v})
+	}
+
+	return res
+}
+
+func addSegments(t *testing.T, repo storage.Repository, user int, segments ...string) {
+	t.Helper()
+
+	_, err := repo.SaveSegmToUser(ctx, user, userSegments(segments...))
+	require.NoError(t, err)
+}
+
+func removeSegments(t *testing.T, repo storage.Repository, user int, segments ...string) {
+	t.Helper()
+
+	_, err := repo.DeleteSegmFromUser(ctx, user, segments)
+	require.NoError(t, err)
+}
+
+func requireUserSegments(t *testing.T, repo storage.Repository, user int, expected ...string) {
+	t.Helper()
+
+	segments, err := repo.GetUser(ctx, user)
+	require.NoError(t, err)
+	sort.Strings(segments)
+	require.Equal(t, expected, segments)
+}
+
+// List all segments by pages of two
+func listAll(t *testing.T, repo storage.Repository, filter model.SegmentsFilter) []model.Segments {
+	t.Helper()
+
+	filter.Limit = 2
+
+	var segments []model.Segments
+	for {
+		page, err := repo.ListSegms(ctx, filter)
+		require.NoError(t, err)
+		segments = append(segments, page...)
+		if len(page) < filter.Limit {
+			return segments
+		}
+		filter.After = &page[len(page)-1]
+	}
+}
+
+func segmentNames(segments []model.Segments) []string {
+	names := make([]string, 0, len(segments))
+	for _, v := range segments {
+		names = append(names, v.SegmentName)
+	}
+
+	return names
+}
@@ -0,0 +1,143 @@
+package storage
+
+import (
+	"context"
+	"time"
+
+	"github.com/m1al04949/avito-tech-service/internal/model"
+)
+
+// Timeouts limit duration of storage operations by their kind, zero means no limit
+type Timeouts struct {
+	// Read is for lookups, listings and pages of segment users
+	Read time.Duration
+	// Write is for creation, deletion and membership changes
+	Write time.Duration
+	// Export is for streaming of all users of segment
+	Export time.Duration
+	// Expire is for deletion of expired memberships
+	Expire time.Duration
+}
+
+type timeoutRepository struct {
+	repo     Repository
+	timeouts Timeouts
+}
+
+// WithTimeouts wraps repo so every operation is cancelled after the timeout of its kind,
+// even if the caller's context has no deadline
+func WithTimeouts(repo Repository, timeouts Timeouts) Repository {
+	return &timeoutRepository{
+		repo:     repo,
+		timeouts: timeouts,
+	}
+}
+
+func withTimeout(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout <= 0 {
+		return ctx, func() {}
+	}
+
+	return context.WithTimeout(ctx, timeout)
+}
+
+func (t *timeoutRepository) SaveSegm(ctx context.Context, segmToSave string, autoPercent int) error {
+	ctx, cancel := withTimeout(ctx, t.timeouts.Write)
+	defer cancel()
+
+	return t.repo.SaveSegm(ctx, segmToSave, autoPercent)
+}
+
+func (t *timeoutRepository) DeleteSegm(ctx context.Context, segmToDelete string) error {
+	ctx, cancel := withTimeout(ctx, t.timeouts.Write)
+	defer cancel()
+
+	return t.repo.DeleteSegm(ctx, segmToDelete)
+}
+
+func (t *timeoutRepository) GetSegm(ctx context.Context, segment string) (model.Segments, error) {
+	ctx, cancel := withTimeout(ctx, t.timeouts.Read)
+	defer cancel()
+
+	return t.repo.GetSegm(ctx, segment)
+}
+
+func (t *timeoutRepository) ListSegms(ctx context.Context, filter model.SegmentsFilter) ([]model.Segments, error) {
+	ctx, cancel := withTimeout(ctx, t.timeouts.Read)
+	defer cancel()
+
+	return t.repo.ListSegms(ctx, filter)
+}
+
+func (t *timeoutRepository) GetSegmUsers(ctx context.Context, segment string, after, limit int) ([]int, error) {
+	ctx, cancel := withTimeout(ctx, t.timeouts.Read)
+	defer cancel()
+
+	return t.repo.GetSegmUsers(ctx, segment, after, limit)
+}
+
+func (t *timeoutRepository) StreamSegmUsers(ctx context.Context, segment string, fn func(user int) error) error {
+	ctx, cancel := withTimeout(ctx, t.timeouts.Export)
+	defer cancel()
+
+	return t.repo.StreamSegmUsers(ctx, segment, fn)
+}
+
+func (t *timeoutRepository) SaveUser(ctx context.Context, userToSave int) error {
+	ctx, cancel := withTimeout(ctx, t.timeouts.Write)
+	defer cancel()
+
+	return t.repo.SaveUser(ctx, userToSave)
+}
+
+func (t *timeoutRepository) DeleteUser(ctx context.Context, userToDelete int) error {
+	ctx, cancel := withTimeout(ctx, t.timeouts.Write)
+	defer cancel()
+
+	return t.repo.DeleteUser(ctx, userToDelete)
+}
+
+func (t *timeoutRepository) GetUser(ctx context.Context, user int) ([]string, error) {
+	ctx, cancel := withTimeout(ctx, t.timeouts.Read)
+	defer cancel()
+
+	return t.repo.GetUser(ctx, user)
+}
+
+func (t *timeoutRepository) SaveSegmToUser(ctx context.Context, user int, segments []model.UserSegments) (
+	[]model.SegmentResult, error) {
+	ctx, cancel := withTimeout(ctx, t.timeouts.Write)
+	defer cancel()
+
+	return t.repo.SaveSegmToUser(ctx, user, segments)
+}
+
+func (t *timeoutRepository) DeleteSegmFromUser(ctx context.Context, user int, segments []string) (
+	[]model.SegmentResult, error) {
+	ctx, cancel := withTimeout(ctx, t.timeouts.Write)
+	defer cancel()
+
+	return t.repo.DeleteSegmFromUser(ctx, user, segments)
+}
+
+func (t *timeoutRepository) UpdateUserSegments(ctx context.Context, user int, add []model.UserSegments, remove []string) (
+	[]string, []model.SegmentResult, error) {
+	ctx, cancel := withTimeout(ctx, t.timeouts.Write)
+	defer cancel()
+
+	return t.repo.UpdateUserSegments(ctx, user, add, remove)
+}
+
+func (t *timeoutRepository) GetHistory(ctx context.Context, from, to time.Time) ([]model.UserSegmentsHistory, error) {
+	ctx, cancel := withTimeout(ctx, t.timeouts.Read)
+	defer cancel()
+
+	return t.repo.GetHistory(ctx, from, to)
+}
+
+func (t *timeoutRepository) DeleteExpired(ctx context.Context) (int, error) {
+	ctx, cancel := withTimeout(ctx, t.timeouts.Expire)
+	defer cancel()
+
+	return t.repo.DeleteExpired(ctx)
+}
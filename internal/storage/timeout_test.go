@@ -0,0 +1,48 @@
+package storage_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/m1al04949/avito-tech-service/internal/model"
+	"github.com/m1al04949/avito-tech-service/internal/storage"
+	"github.com/m1al04949/avito-tech-service/internal/storage/memory"
+	"github.com/m1al04949/avito-tech-service/internal/storage/storagetest"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWithTimeoutsConformance(t *testing.T) {
+	storagetest.Run(t, func(t *testing.T) storage.Repository {
+		return storage.WithTimeouts(memory.New(), storage.Timeouts{
+			Read:  time.Minute,
+			Write: time.Minute,
+		})
+	})
+}
+
+func TestWithTimeoutsExport(t *testing.T) {
+	ctx := context.Background()
+	repo := storage.WithTimeouts(memory.New(), storage.Timeouts{Export: 10 * time.Millisecond})
+
+	require.NoError(t, repo.SaveSegm(ctx, "A", 0))
+	for user := 1; user <= 2; user++ {
+		require.NoError(t, repo.SaveUser(ctx, user))
+		_, err := repo.SaveSegmToUser(ctx, user, []model.UserSegments{{SegmentName: "A"}})
+		require.NoError(t, err)
+	}
+
+	var streamed []int
+	err := repo.StreamSegmUsers(ctx, "A", func(user int) error {
+		streamed = append(streamed, user)
+		time.Sleep(20 * time.Millisecond)
+		return nil
+	})
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+	require.Equal(t, []int{1}, streamed)
+
+	// Operations without timeout are not limited
+	users, err := repo.GetSegmUsers(ctx, "A", 0, 10)
+	require.NoError(t, err)
+	require.Equal(t, []int{1, 2}, users)
+}
@@ -0,0 +1,141 @@
+package tracing
+
+import (
+	"context"
+	"time"
+
+	"github.com/m1al04949/avito-tech-service/internal/model"
+	"github.com/m1al04949/avito-tech-service/internal/storage"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+type tracedRepository struct {
+	repo   storage.Repository
+	tracer trace.Tracer
+}
+
+// Storage wraps repo so every operation has its own span, SQL queries
+// of the operation become children of it
+func Storage(repo storage.Repository) storage.Repository {
+	return &tracedRepository{
+		repo:   repo,
+		tracer: Tracer(),
+	}
+}
+
+func (r *tracedRepository) start(ctx context.Context, op string) (context.Context, trace.Span) {
+	return r.tracer.Start(ctx, op, trace.WithSpanKind(trace.SpanKindInternal))
+}
+
+func end(span trace.Span, err *error) {
+	if *err != nil {
+		span.RecordError(*err)
+		span.SetStatus(codes.Error, (*err).Error())
+	}
+	span.End()
+}
+
+func (r *tracedRepository) SaveSegm(ctx context.Context, segmToSave string, autoPercent int) (err error) {
+	ctx, span := r.start(ctx, "storage.SaveSegm")
+	defer end(span, &err)
+
+	return r.repo.SaveSegm(ctx, segmToSave, autoPercent)
+}
+
+func (r *tracedRepository) DeleteSegm(ctx context.Context, segmToDelete string) (err error) {
+	ctx, span := r.start(ctx, "storage.DeleteSegm")
+	defer end(span, &err)
+
+	return r.repo.DeleteSegm(ctx, segmToDelete)
+}
+
+func (r *tracedRepository) GetSegm(ctx context.Context, segment string) (m model.Segments, err error) {
+	ctx, span := r.start(ctx, "storage.GetSegm")
+	defer end(span, &err)
+
+	return r.repo.GetSegm(ctx, segment)
+}
+
+func (r *tracedRepository) ListSegms(ctx context.Context, filter model.SegmentsFilter) (
+	s []model.Segments, err error) {
+	ctx, span := r.start(ctx, "storage.ListSegms")
+	defer end(span, &err)
+
+	return r.repo.ListSegms(ctx, filter)
+}
+
+func (r *tracedRepository) GetSegmUsers(ctx context.Context, segment string, after, limit int) (
+	users []int, err error) {
+	ctx, span := r.start(ctx, "storage.GetSegmUsers")
+	defer end(span, &err)
+
+	return r.repo.GetSegmUsers(ctx, segment, after, limit)
+}
+
+func (r *tracedRepository) StreamSegmUsers(ctx context.Context, segment string, fn func(user int) error) (err error) {
+	ctx, span := r.start(ctx, "storage.StreamSegmUsers")
+	defer end(span, &err)
+
+	return r.repo.StreamSegmUsers(ctx, segment, fn)
+}
+
+func (r *tracedRepository) SaveUser(ctx context.Context, userToSave int) (err error) {
+	ctx, span := r.start(ctx, "storage.SaveUser")
+	defer end(span, &err)
+
+	return r.repo.SaveUser(ctx, userToSave)
+}
+
+func (r *tracedRepository) DeleteUser(ctx context.Context, userToDelete int) (err error) {
+	ctx, span := r.start(ctx, "storage.DeleteUser")
+	defer end(span, &err)
+
+	return r.repo.DeleteUser(ctx, userToDelete)
+}
+
+func (r *tracedRepository) GetUser(ctx context.Context, user int) (segments []string, err error) {
+	ctx, span := r.start(ctx, "storage.GetUser")
+	defer end(span, &err)
+
+	return r.repo.GetUser(ctx, user)
+}
+
+func (r *tracedRepository) SaveSegmToUser(ctx context.Context, user int, segments []model.UserSegments) (
+	results []model.SegmentResult, err error) {
+	ctx, span := r.start(ctx, "storage.SaveSegmToUser")
+	defer end(span, &err)
+
+	return r.repo.SaveSegmToUser(ctx, user, segments)
+}
+
+func (r *tracedRepository) DeleteSegmFromUser(ctx context.Context, user int, segments []string) (
+	results []model.SegmentResult, err error) {
+	ctx, span := r.start(ctx, "storage.DeleteSegmFromUser")
+	defer end(span, &err)
+
+	return r.repo.DeleteSegmFromUser(ctx, user, segments)
+}
+
+func (r *tracedRepository) UpdateUserSegments(ctx context.Context, user int, add []model.UserSegments,
+	remove []string) (segments []string, results []model.SegmentResult, err error) {
+	ctx, span := r.start(ctx, "storage.UpdateUserSegments")
+	defer end(span, &err)
+
+	return r.repo.UpdateUserSegments(ctx, user, add, remove)
+}
+
+func (r *tracedRepository) GetHistory(ctx context.Context, from, to time.Time) (
+	history []model.UserSegmentsHistory, err error) {
+	ctx, span := r.start(ctx, "storage.GetHistory")
+	defer end(span, &err)
+
+	return r.repo.GetHistory(ctx, from, to)
+}
+
+func (r *tracedRepository) DeleteExpired(ctx context.Context) (deleted int, err error) {
+	ctx, span := r.start(ctx, "storage.DeleteExpired")
+	defer end(span, &err)
+
+	return r.repo.DeleteExpired(ctx)
+}
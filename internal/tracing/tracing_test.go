@@ -0,0 +1,113 @@
+package tracing_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/m1al04949/avito-tech-service/internal/app"
+	"github.com/m1al04949/avito-tech-service/internal/auth"
+	"github.com/m1al04949/avito-tech-service/internal/config"
+	"github.com/m1al04949/avito-tech-service/internal/health"
+	"github.com/m1al04949/avito-tech-service/internal/metrics"
+	"github.com/m1al04949/avito-tech-service/internal/storage/sqlite"
+	"github.com/m1al04949/avito-tech-service/internal/tracing"
+	"github.com/m1al04949/avito-tech-service/pkg/slogdiscard"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestTracing(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+
+	store := sqlite.New(filepath.Join(t.TempDir(), "segments.db"))
+	require.NoError(t, store.Open())
+	t.Cleanup(store.Close)
+	migrator, err := store.Migrator()
+	require.NoError(t, err)
+	_, err = migrator.Up(context.Background())
+	require.NoError(t, err)
+
+	cfg := &config.Config{}
+	cfg.HTTPServer.User = "myuser"
+	cfg.HTTPServer.Password = "mypass"
+
+	authenticator, err := auth.New(cfg.HTTPServer)
+	require.NoError(t, err)
+
+	router := app.NewRouter(slogdiscard.NewDiscardLogger(), cfg, tracing.Storage(store), &health.Readiness{},
+		metrics.New(), authenticator)
+
+	const (
+		traceID = "4bf92f3577b34da6a3ce929d0e0e4736"
+		parent  = "00f067aa0ba902b7"
+	)
+
+	req := httptest.NewRequest(http.MethodPut, "/api/v1/users/1000", nil)
+	req.SetBasicAuth("myuser", "mypass")
+	req.Header.Set("traceparent", "00-"+traceID+"-"+parent+"-01")
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	require.Equal(t, http.StatusOK, rr.Code)
+
+	spans := map[string]sdktrace.ReadOnlySpan{}
+	for _, s := range recorder.Ended() {
+		if s.SpanContext().TraceID().String() == traceID {
+			spans[s.Name()] = s
+		}
+	}
+
+	server, ok := spans["PUT /api/v1/users/{id}"]
+	require.True(t, ok, "server span is named by route")
+	require.Equal(t, trace.SpanKindServer, server.SpanKind())
+	require.Equal(t, parent, server.Parent().SpanID().String())
+	require.True(t, server.Parent().IsRemote())
+
+	operation, ok := spans["storage.SaveUser"]
+	require.True(t, ok)
+	require.Equal(t, server.SpanContext().SpanID(), operation.Parent().SpanID())
+
+	insert, ok := spans["INSERT"]
+	require.True(t, ok, "query span is named by SQL operation")
+	require.Equal(t, operation.SpanContext().SpanID(), insert.Parent().SpanID())
+
+	// Failed operation marks its span
+	req = httptest.NewRequest(http.MethodGet, "/api/v1/users/1001", nil)
+	req.SetBasicAuth("myuser", "mypass")
+	router.ServeHTTP(httptest.NewRecorder(), req)
+
+	var getUser sdktrace.ReadOnlySpan
+	for _, s := range recorder.Ended() {
+		if s.Name() == "storage.GetUser" {
+			getUser = s
+		}
+	}
+	require.NotNil(t, getUser)
+	require.Equal(t, codes.Error, getUser.Status().Code)
+}
+
+func TestSetup(t *testing.T) {
+	ctx := context.Background()
+
+	_, err := tracing.Setup(ctx, config.Tracing{Exporter: "jaeger"}, "test")
+	require.Error(t, err)
+
+	shutdown, err := tracing.Setup(ctx, config.Tracing{Exporter: config.TracingNone}, "test")
+	require.NoError(t, err)
+	defer shutdown(ctx)
+
+	// Without exporter spans are not recorded, but still carry ids for logs
+	_, span := tracing.Tracer().Start(ctx, "op")
+	defer span.End()
+	require.True(t, span.SpanContext().IsValid())
+	require.False(t, span.IsRecording())
+}
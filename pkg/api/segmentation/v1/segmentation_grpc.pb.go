@@ -0,0 +1,331 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.3.0
+// - protoc             (unknown)
+// source: segmentation/v1/segmentation.proto
+
+package segmentationv1
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.32.0 or later.
+const _ = grpc.SupportPackageIsVersion7
+
+const (
+	SegmentationService_CreateSegment_FullMethodName          = "/segmentation.v1.SegmentationService/CreateSegment"
+	SegmentationService_DeleteSegment_FullMethodName          = "/segmentation.v1.SegmentationService/DeleteSegment"
+	SegmentationService_CreateUser_FullMethodName             = "/segmentation.v1.SegmentationService/CreateUser"
+	SegmentationService_DeleteUser_FullMethodName             = "/segmentation.v1.SegmentationService/DeleteUser"
+	SegmentationService_AddSegmentsToUser_FullMethodName      = "/segmentation.v1.SegmentationService/AddSegmentsToUser"
+	SegmentationService_RemoveSegmentsFromUser_FullMethodName = "/segmentation.v1.SegmentationService/RemoveSegmentsFromUser"
+	SegmentationService_GetUserSegments_FullMethodName        = "/segmentation.v1.SegmentationService/GetUserSegments"
+)
+
+// SegmentationServiceClient is the client API for SegmentationService service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type SegmentationServiceClient interface {
+	CreateSegment(ctx context.Context, in *CreateSegmentRequest, opts ...grpc.CallOption) (*CreateSegmentResponse, error)
+	DeleteSegment(ctx context.Context, in *DeleteSegmentRequest, opts ...grpc.CallOption) (*DeleteSegmentResponse, error)
+	CreateUser(ctx context.Context, in *CreateUserRequest, opts ...grpc.CallOption) (*CreateUserResponse, error)
+	DeleteUser(ctx context.Context, in *DeleteUserRequest, opts ...grpc.CallOption) (*DeleteUserResponse, error)
+	AddSegmentsToUser(ctx context.Context, in *AddSegmentsToUserRequest, opts ...grpc.CallOption) (*AddSegmentsToUserResponse, error)
+	RemoveSegmentsFromUser(ctx context.Context, in *RemoveSegmentsFromUserRequest, opts ...grpc.CallOption) (*RemoveSegmentsFromUserResponse, error)
+	GetUserSegments(ctx context.Context, in *GetUserSegmentsRequest, opts ...grpc.CallOption) (*GetUserSegmentsResponse, error)
+}
+
+type segmentationServiceClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewSegmentationServiceClient(cc grpc.ClientConnInterface) SegmentationServiceClient {
+	return &segmentationServiceClient{cc}
+}
+
+func (c *segmentationServiceClient) CreateSegment(ctx context.Context, in *CreateSegmentRequest, opts ...grpc.CallOption) (*CreateSegmentResponse, error) {
+	out := new(CreateSegmentResponse)
+	err := c.cc.Invoke(ctx, SegmentationService_CreateSegment_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *segmentationServiceClient) DeleteSegment(ctx context.Context, in *DeleteSegmentRequest, opts ...grpc.CallOption) (*DeleteSegmentResponse, error) {
+	out := new(DeleteSegmentResponse)
+	err := c.cc.Invoke(ctx, SegmentationService_DeleteSegment_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *segmentationServiceClient) CreateUser(ctx context.Context, in *CreateUserRequest, opts ...grpc.CallOption) (*CreateUserResponse, error) {
+	out := new(CreateUserResponse)
+	err := c.cc.Invoke(ctx, SegmentationService_CreateUser_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *segmentationServiceClient) DeleteUser(ctx context.Context, in *DeleteUserRequest, opts ...grpc.CallOption) (*DeleteUserResponse, error) {
+	out := new(DeleteUserResponse)
+	err := c.cc.Invoke(ctx, SegmentationService_DeleteUser_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *segmentationServiceClient) AddSegmentsToUser(ctx context.Context, in *AddSegmentsToUserRequest, opts ...grpc.CallOption) (*AddSegmentsToUserResponse, error) {
+	out := new(AddSegmentsToUserResponse)
+	err := c.cc.Invoke(ctx, SegmentationService_AddSegmentsToUser_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *segmentationServiceClient) RemoveSegmentsFromUser(ctx context.Context, in *RemoveSegmentsFromUserRequest, opts ...grpc.CallOption) (*RemoveSegmentsFromUserResponse, error) {
+	out := new(RemoveSegmentsFromUserResponse)
+	err := c.cc.Invoke(ctx, SegmentationService_RemoveSegmentsFromUser_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *segmentationServiceClient) GetUserSegments(ctx context.Context, in *GetUserSegmentsRequest, opts ...grpc.CallOption) (*GetUserSegmentsResponse, error) {
+	out := new(GetUserSegmentsResponse)
+	err := c.cc.Invoke(ctx, SegmentationService_GetUserSegments_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// SegmentationServiceServer is the server API for SegmentationService service.
+// All implementations must embed UnimplementedSegmentationServiceServer
+// for forward compatibility
+type SegmentationServiceServer interface {
+	CreateSegment(context.Context, *CreateSegmentRequest) (*CreateSegmentResponse, error)
+	DeleteSegment(context.Context, *DeleteSegmentRequest) (*DeleteSegmentResponse, error)
+	CreateUser(context.Context, *CreateUserRequest) (*CreateUserResponse, error)
+	DeleteUser(context.Context, *DeleteUserRequest) (*DeleteUserResponse, error)
+	AddSegmentsToUser(context.Context, *AddSegmentsToUserRequest) (*AddSegmentsToUserResponse, error)
+	RemoveSegmentsFromUser(context.Context, *RemoveSegmentsFromUserRequest) (*RemoveSegmentsFromUserResponse, error)
+	GetUserSegments(context.Context, *GetUserSegmentsRequest) (*GetUserSegmentsResponse, error)
+	mustEmbedUnimplementedSegmentationServiceServer()
+}
+
+// UnimplementedSegmentationServiceServer must be embedded to have forward compatible implementations.
+type UnimplementedSegmentationServiceServer struct {
+}
+
+func (UnimplementedSegmentationServiceServer) CreateSegment(context.Context, *CreateSegmentRequest) (*CreateSegmentResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method CreateSegment not implemented")
+}
+func (UnimplementedSegmentationServiceServer) DeleteSegment(context.Context, *DeleteSegmentRequest) (*DeleteSegmentResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method DeleteSegment not implemented")
+}
+func (UnimplementedSegmentationServiceServer) CreateUser(context.Context, *CreateUserRequest) (*CreateUserResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method CreateUser not implemented")
+}
+func (UnimplementedSegmentationServiceServer) DeleteUser(context.Context, *DeleteUserRequest) (*DeleteUserResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method DeleteUser not implemented")
+}
+func (UnimplementedSegmentationServiceServer) AddSegmentsToUser(context.Context, *AddSegmentsToUserRequest) (*AddSegmentsToUserResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method AddSegmentsToUser not implemented")
+}
+func (UnimplementedSegmentationServiceServer) RemoveSegmentsFromUser(context.Context, *RemoveSegmentsFromUserRequest) (*RemoveSegmentsFromUserResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method RemoveSegmentsFromUser not implemented")
+}
+func (UnimplementedSegmentationServiceServer) GetUserSegments(context.Context, *GetUserSegmentsRequest) (*GetUserSegmentsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetUserSegments not implemented")
+}
+func (UnimplementedSegmentationServiceServer) mustEmbedUnimplementedSegmentationServiceServer() {}
+
+// UnsafeSegmentationServiceServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to SegmentationServiceServer will
+// result in compilation errors.
+type UnsafeSegmentationServiceServer interface {
+	mustEmbedUnimplementedSegmentationServiceServer()
+}
+
+func RegisterSegmentationServiceServer(s grpc.ServiceRegistrar, srv SegmentationServiceServer) {
+	s.RegisterService(&SegmentationService_ServiceDesc, srv)
+}
+
+func _SegmentationService_CreateSegment_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CreateSegmentRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(SegmentationServiceServer).CreateSegment(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: SegmentationService_CreateSegment_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(SegmentationServiceServer).CreateSegment(ctx, req.(*CreateSegmentRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _SegmentationService_DeleteSegment_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(DeleteSegmentRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(SegmentationServiceServer).DeleteSegment(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: SegmentationService_DeleteSegment_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(SegmentationServiceServer).DeleteSegment(ctx, req.(*DeleteSegmentRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _SegmentationService_CreateUser_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CreateUserRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(SegmentationServiceServer).CreateUser(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: SegmentationService_CreateUser_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(SegmentationServiceServer).CreateUser(ctx, req.(*CreateUserRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _SegmentationService_DeleteUser_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(DeleteUserRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(SegmentationServiceServer).DeleteUser(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: SegmentationService_DeleteUser_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(SegmentationServiceServer).DeleteUser(ctx, req.(*DeleteUserRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _SegmentationService_AddSegmentsToUser_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(AddSegmentsToUserRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(SegmentationServiceServer).AddSegmentsToUser(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: SegmentationService_AddSegmentsToUser_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(SegmentationServiceServer).AddSegmentsToUser(ctx, req.(*AddSegmentsToUserRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _SegmentationService_RemoveSegmentsFromUser_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(RemoveSegmentsFromUserRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(SegmentationServiceServer).RemoveSegmentsFromUser(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: SegmentationService_RemoveSegmentsFromUser_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(SegmentationServiceServer).RemoveSegmentsFromUser(ctx, req.(*RemoveSegmentsFromUserRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _SegmentationService_GetUserSegments_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetUserSegmentsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(SegmentationServiceServer).GetUserSegments(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: SegmentationService_GetUserSegments_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(SegmentationServiceServer).GetUserSegments(ctx, req.(*GetUserSegmentsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// SegmentationService_ServiceDesc is the grpc.ServiceDesc for SegmentationService service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var SegmentationService_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "segmentation.v1.SegmentationService",
+	HandlerType: (*SegmentationServiceServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "CreateSegment",
+			Handler:    _SegmentationService_CreateSegment_Handler,
+		},
+		{
+			MethodName: "DeleteSegment",
+			Handler:    _SegmentationService_DeleteSegment_Handler,
+		},
+		{
+			MethodName: "CreateUser",
+			Handler:    _SegmentationService_CreateUser_Handler,
+		},
+		{
+			MethodName: "DeleteUser",
+			Handler:    _SegmentationService_DeleteUser_Handler,
+		},
+		{
+			MethodName: "AddSegmentsToUser",
+			Handler:    _SegmentationService_AddSegmentsToUser_Handler,
+		},
+		{
+			MethodName: "RemoveSegmentsFromUser",
+			Handler:    _SegmentationService_RemoveSegmentsFromUser_Handler,
+		},
+		{
+			MethodName: "GetUserSegments",
+			Handler:    _SegmentationService_GetUserSegments_Handler,
+		},
+	},
+	Streams:  []grpc.StreamDesc{},
+	Metadata: "segmentation/v1/segmentation.proto",
+}
@@ -0,0 +1,276 @@
+// Package client is a typed Go client of avito-tech-service REST API v1
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	apiV1 = "/api/v1"
+
+	contentTypeJSON    = "application/json"
+	contentTypeProblem = "application/problem+json"
+
+	defaultTimeout    = 10 * time.Second
+	defaultRetries    = 3
+	defaultMinBackoff = 100 * time.Millisecond
+	defaultMaxBackoff = 2 * time.Second
+)
+
+// Client calls the service. It is safe for concurrent use
+type Client struct {
+	baseURL    *url.URL
+	httpClient *http.Client
+	// Set by WithTimeout, applied to a copy of httpClient
+	timeout  *time.Duration
+	user     string
+	password string
+
+	retries    int
+	minBackoff time.Duration
+	maxBackoff time.Duration
+}
+
+type Option func(*Client)
+
+// WithBasicAuth sets credentials of the service
+func WithBasicAuth(user, password string) Option {
+	return func(c *Client) {
+		c.user = user
+		c.password = password
+	}
+}
+
+// WithHTTPClient replaces default HTTP client, its timeout is kept unless WithTimeout is set.
+// The client is not modified, so it may be shared
+func WithHTTPClient(httpClient *http.Client) Option {
+	return func(c *Client) {
+		c.httpClient = httpClient
+	}
+}
+
+// WithTimeout limits every attempt of a request, zero means no limit
+func WithTimeout(timeout time.Duration) Option {
+	return func(c *Client) {
+		c.timeout = &timeout
+	}
+}
+
+// WithRetries sets how many times GET, PUT and DELETE requests are repeated on network errors,
+// 429 and 5xx responses except 500. Pauses grow exponentially from min to max backoff
+func WithRetries(retries int, minBackoff, maxBackoff time.Duration) Option {
+	return func(c *Client) {
+		c.retries = retries
+		c.minBackoff = minBackoff
+		c.maxBackoff = maxBackoff
+	}
+}
+
+// New returns client of the service at baseURL, e.g. "http://localhost:8080"
+func New(baseURL string, opts ...Option) (*Client, error) {
+	const op = "client.New"
+
+	u, err := url.Parse(strings.TrimRight(baseURL, "/"))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	if u.Scheme == "" || u.Host == "" {
+		return nil, fmt.Errorf("%s: base url must be absolute: %q", op, baseURL)
+	}
+
+	c := &Client{
+		baseURL:    u,
+		httpClient: &http.Client{Timeout: defaultTimeout},
+		retries:    defaultRetries,
+		minBackoff: defaultMinBackoff,
+		maxBackoff: defaultMaxBackoff,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	if c.timeout != nil {
+		httpClient := *c.httpClient
+		httpClient.Timeout = *c.timeout
+		c.httpClient = &httpClient
+	}
+
+	return c, nil
+}
+
+// Call API and decode JSON response into out, if it is not nil
+func (c *Client) do(ctx context.Context, method, path string, query url.Values, in, out any) error {
+	resp, err := c.send(ctx, method, path, query, in)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if out == nil {
+		_, err = io.Copy(io.Discard, resp.Body)
+		return err
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("decode response: %w", err)
+	}
+
+	return nil
+}
+
+// Send request, retrying it if possible. Response body must be closed by caller
+func (c *Client) send(ctx context.Context, method, path string, query url.Values, in any) (*http.Response, error) {
+	var body []byte
+	if in != nil {
+		var err error
+		body, err = json.Marshal(in)
+		if err != nil {
+			return nil, fmt.Errorf("encode request: %w", err)
+		}
+	}
+
+	u := *c.baseURL
+	u.Path += apiV1 + path
+	u.RawQuery = query.Encode()
+
+	// Some attempt got no response, so the server may have applied the request
+	var unanswered bool
+	for attempt := 0; ; attempt++ {
+		resp, err := c.sendOnce(ctx, method, u.String(), body)
+
+		if attempt >= c.retries || !retryable(method, resp, err) {
+			if err != nil {
+				return nil, err
+			}
+			if resp.StatusCode >= http.StatusBadRequest {
+				defer resp.Body.Close()
+				e := decodeError(resp)
+				e.unanswered = unanswered
+				return nil, e
+			}
+			return resp, nil
+		}
+
+		if resp != nil {
+			_, _ = io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+		} else {
+			unanswered = true
+		}
+
+		timer := time.NewTimer(c.backoff(attempt))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+func (c *Client) sendOnce(ctx context.Context, method, u string, body []byte) (*http.Response, error) {
+	var r io.Reader
+	if body != nil {
+		r = bytes.NewReader(body)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, u, r)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", contentTypeJSON)
+	}
+	// Problem details are returned regardless of server legacy_errors setting
+	req.Header.Set("Accept", contentTypeJSON+", "+contentTypeProblem)
+	if c.user != "" || c.password != "" {
+		req.SetBasicAuth(c.user, c.password)
+	}
+
+	return c.httpClient.Do(req)
+}
+
+func retryable(method string, resp *http.Response, err error) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodPut, http.MethodDelete:
+	default:
+		return false
+	}
+
+	if err != nil {
+		return !errors.Is(err, context.Canceled) && !errors.Is(err, context.DeadlineExceeded)
+	}
+
+	switch resp.StatusCode {
+	case http.StatusTooManyRequests, http.StatusBadGateway,
+		http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+
+	return false
+}
+
+// appliedBefore reports whether target is returned to a request repeated after an attempt
+// without response. PUT and DELETE are not idempotent on the server: when response of an earlier
+// attempt is lost, the repeated one finds the work done and fails with conflict or not found.
+// Attempts answered with 429 or 5xx were not applied, so errors after them are kept
+func appliedBefore(err, target error) bool {
+	var e *Error
+
+	return errors.As(err, &e) && e.unanswered && errors.Is(err, target)
+}
+
+// Exponential backoff with full jitter
+func (c *Client) backoff(attempt int) time.Duration {
+	d := c.minBackoff << attempt
+	if d <= 0 || d > c.maxBackoff {
+		d = c.maxBackoff
+	}
+	if d <= 0 {
+		return 0
+	}
+
+	return time.Duration(rand.Int63n(int64(d))) + 1
+}
+
+func decodeError(resp *http.Response) *Error {
+	e := &Error{StatusCode: resp.StatusCode}
+
+	if strings.HasPrefix(resp.Header.Get("Content-Type"), contentTypeProblem) {
+		var p struct {
+			Detail    string `json:"detail"`
+			Code      string `json:"code"`
+			RequestID string `json:"request_id"`
+		}
+		if err := json.NewDecoder(resp.Body).Decode(&p); err == nil {
+			e.Code = p.Code
+			e.Detail = p.Detail
+			e.RequestID = p.RequestID
+			e.err = codeErrors[p.Code]
+		}
+	}
+
+	if e.Detail == "" {
+		e.Detail = http.StatusText(resp.StatusCode)
+	}
+	if e.err == nil {
+		switch {
+		case resp.StatusCode == http.StatusUnauthorized:
+			e.err = ErrUnauthorized
+		case resp.StatusCode == http.StatusForbidden:
+			e.err = ErrForbidden
+		case resp.StatusCode >= http.StatusInternalServerError:
+			e.err = ErrInternal
+		}
+	}
+
+	return e
+}
@@ -0,0 +1,288 @@
+package client_test
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/m1al04949/avito-tech-service/internal/app"
+	"github.com/m1al04949/avito-tech-service/internal/auth"
+	"github.com/m1al04949/avito-tech-service/internal/config"
+	"github.com/m1al04949/avito-tech-service/internal/health"
+	"github.com/m1al04949/avito-tech-service/internal/metrics"
+	"github.com/m1al04949/avito-tech-service/internal/storage/memory"
+	"github.com/m1al04949/avito-tech-service/pkg/client"
+	"github.com/m1al04949/avito-tech-service/pkg/slogdiscard"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	user     = "myuser"
+	password = "mypass"
+
+	reader         = "reader"
+	readerPassword = "reader-pass"
+)
+
+func newRouter(t *testing.T) http.Handler {
+	t.Helper()
+
+	cfg := &config.Config{}
+	cfg.HTTPServer.User = user
+	cfg.HTTPServer.Password = password
+	cfg.HTTPServer.Credentials = []config.Credential{
+		{User: reader, Password: readerPassword, Role: config.RoleReader},
+	}
+
+	authenticator, err := auth.New(cfg.HTTPServer)
+	require.NoError(t, err)
+
+	return app.NewRouter(slogdiscard.NewDiscardLogger(), cfg, memory.New(), &health.Readiness{}, metrics.New(), authenticator)
+}
+
+func newClient(t *testing.T, url string, opts ...client.Option) *client.Client {
+	t.Helper()
+
+	opts = append([]client.Option{
+		client.WithBasicAuth(user, password),
+		client.WithRetries(2, time.Millisecond, 5*time.Millisecond),
+	}, opts...)
+
+	c, err := client.New(url, opts...)
+	require.NoError(t, err)
+
+	return c
+}
+
+func TestClientErrors(t *testing.T) {
+	router := newRouter(t)
+	srv := httptest.NewServer(router)
+	defer srv.Close()
+
+	ctx := context.Background()
+
+	_, err := newClient(t, srv.URL).ListSegments(ctx, client.ListSegmentsOptions{Limit: 5000})
+	require.ErrorIs(t, err, client.ErrInvalidRequest)
+
+	var apiErr *client.Error
+	require.True(t, errors.As(err, &apiErr))
+	require.Equal(t, http.StatusBadRequest, apiErr.StatusCode)
+	require.Equal(t, "invalid_request", apiErr.Code)
+	require.NotEmpty(t, apiErr.RequestID)
+
+	_, err = newClient(t, srv.URL, client.WithBasicAuth(user, "wrong")).GetUserSegments(ctx, 1)
+	require.ErrorIs(t, err, client.ErrUnauthorized)
+
+	err = newClient(t, srv.URL, client.WithBasicAuth(reader, readerPassword)).CreateUser(ctx, 1)
+	require.ErrorIs(t, err, client.ErrForbidden)
+	require.True(t, errors.As(err, &apiErr))
+	require.Equal(t, "forbidden", apiErr.Code)
+
+	// Proxies reject requests without problem details
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "denied", http.StatusForbidden)
+	}))
+	defer proxy.Close()
+	_, err = newClient(t, proxy.URL).GetUserSegments(ctx, 1)
+	require.ErrorIs(t, err, client.ErrForbidden)
+}
+
+func TestClientRetries(t *testing.T) {
+	router := newRouter(t)
+
+	var calls int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Service is unavailable for the first two calls
+		if atomic.AddInt32(&calls, 1) <= 2 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		router.ServeHTTP(w, r)
+	}))
+	defer srv.Close()
+
+	ctx := context.Background()
+
+	_, err := newClient(t, srv.URL).ListSegments(ctx, client.ListSegmentsOptions{SortBy: "unknown"})
+	require.ErrorIs(t, err, client.ErrInvalidRequest)
+	require.EqualValues(t, 3, atomic.LoadInt32(&calls))
+
+	// Not idempotent requests are not repeated
+	atomic.StoreInt32(&calls, 0)
+	err = newClient(t, srv.URL).CreateSegment(ctx, "SEGMENT", 0)
+	require.ErrorIs(t, err, client.ErrInternal)
+	require.EqualValues(t, 1, atomic.LoadInt32(&calls))
+
+	// Retries stop with context
+	atomic.StoreInt32(&calls, -100)
+	ctx, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+	defer cancel()
+	_, err = newClient(t, srv.URL, client.WithRetries(1000, 10*time.Millisecond, 10*time.Millisecond)).
+		GetUserSegments(ctx, 1)
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+}
+
+func TestClientTimeout(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-time.After(time.Second):
+		}
+	}))
+	defer srv.Close()
+
+	ctx := context.Background()
+	shared := &http.Client{}
+
+	// Timeout applies regardless of order of options and does not change shared client
+	for _, opts := range [][]client.Option{
+		{client.WithHTTPClient(shared), client.WithTimeout(20 * time.Millisecond)},
+		{client.WithTimeout(20 * time.Millisecond), client.WithHTTPClient(shared)},
+	} {
+		start := time.Now()
+		_, err := newClient(t, srv.URL, append(opts, client.WithRetries(0, 0, 0))...).GetUserSegments(ctx, 1)
+		require.Error(t, err)
+		require.Less(t, time.Since(start), 500*time.Millisecond)
+		require.Zero(t, shared.Timeout)
+	}
+}
+
+func TestClientLostResponses(t *testing.T) {
+	router := newRouter(t)
+
+	var drop atomic.Bool
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Request is applied, but its response is lost with the connection
+		if drop.CompareAndSwap(true, false) {
+			router.ServeHTTP(httptest.NewRecorder(), r)
+			conn, _, err := w.(http.Hijacker).Hijack()
+			require.NoError(t, err)
+			conn.Close()
+			return
+		}
+		router.ServeHTTP(w, r)
+	}))
+	defer srv.Close()
+
+	ctx := context.Background()
+	c := newClient(t, srv.URL)
+
+	drop.Store(true)
+	require.NoError(t, c.CreateUser(ctx, 1000))
+	require.False(t, drop.Load())
+	require.ErrorIs(t, c.CreateUser(ctx, 1000), client.ErrUserExists)
+
+	require.NoError(t, c.CreateSegment(ctx, "AVITO_VOICE", 0))
+	drop.Store(true)
+	require.NoError(t, c.DeleteSegment(ctx, "AVITO_VOICE"))
+	require.ErrorIs(t, c.DeleteSegment(ctx, "AVITO_VOICE"), client.ErrSegmentNotExists)
+
+	drop.Store(true)
+	require.NoError(t, c.DeleteUser(ctx, 1000))
+	require.ErrorIs(t, c.DeleteUser(ctx, 1000), client.ErrUserNotExists)
+}
+
+func TestClientErrorsAfterUnavailable(t *testing.T) {
+	router := newRouter(t)
+
+	var unavailable atomic.Bool
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Request is rejected without being applied
+		if unavailable.CompareAndSwap(true, false) {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		router.ServeHTTP(w, r)
+	}))
+	defer srv.Close()
+
+	ctx := context.Background()
+	c := newClient(t, srv.URL)
+
+	unavailable.Store(true)
+	require.ErrorIs(t, c.DeleteUser(ctx, 1000), client.ErrUserNotExists)
+	require.False(t, unavailable.Load())
+
+	unavailable.Store(true)
+	require.ErrorIs(t, c.DeleteSegment(ctx, "AVITO_VOICE"), client.ErrSegmentNotExists)
+
+	require.NoError(t, c.CreateUser(ctx, 1000))
+	unavailable.Store(true)
+	require.ErrorIs(t, c.CreateUser(ctx, 1000), client.ErrUserExists)
+}
+
+func TestClientHappyPath(t *testing.T) {
+	srv := httptest.NewServer(newRouter(t))
+	defer srv.Close()
+
+	ctx := context.Background()
+	c := newClient(t, srv.URL)
+
+	userID := rand.Intn(1_000_000) + 1_000_000
+	slug := "CLIENT_TEST_" + strconv.Itoa(userID)
+
+	require.NoError(t, c.CreateUser(ctx, userID))
+	require.ErrorIs(t, c.CreateUser(ctx, userID), client.ErrUserExists)
+	require.NoError(t, c.CreateSegment(ctx, slug, 0))
+	require.ErrorIs(t, c.CreateSegment(ctx, slug, 0), client.ErrSegmentExists)
+
+	results, err := c.AddSegmentsToUser(ctx, userID, []client.UserSegment{
+		{Slug: slug, TTL: time.Hour},
+		{Slug: slug + "_UNKNOWN"},
+	})
+	require.NoError(t, err)
+	require.Equal(t, []client.SegmentResult{
+		{Slug: slug, Result: client.ResultAdded},
+		{Slug: slug + "_UNKNOWN", Result: client.ResultUnknownSegment},
+	}, results)
+
+	segments, err := c.GetUserSegments(ctx, userID)
+	require.NoError(t, err)
+	require.Equal(t, []string{slug}, segments)
+
+	segment, err := c.GetSegment(ctx, slug)
+	require.NoError(t, err)
+	require.Equal(t, 1, segment.Users)
+
+	page, err := c.GetSegmentUsers(ctx, slug, "", 10)
+	require.NoError(t, err)
+	require.Equal(t, []int{userID}, page.Users)
+
+	var exported []int
+	require.NoError(t, c.ExportSegmentUsers(ctx, slug, func(user int) error {
+		exported = append(exported, user)
+		return nil
+	}))
+	require.Equal(t, []int{userID}, exported)
+
+	require.ErrorIs(t, c.DeleteSegment(ctx, slug), client.ErrSegmentDelete)
+
+	_, _, err = c.UpdateUserSegments(ctx, userID, []client.UserSegment{{Slug: slug}}, []string{slug})
+	require.ErrorIs(t, err, client.ErrSegmentsConflict)
+
+	results, err = c.RemoveSegmentsFromUser(ctx, userID, []string{slug})
+	require.NoError(t, err)
+	require.Equal(t, []client.SegmentResult{{Slug: slug, Result: client.ResultRemoved}}, results)
+
+	now := time.Now()
+	history, err := c.GetHistory(ctx, now.Year(), now.Month())
+	require.NoError(t, err)
+	var found int
+	for _, h := range history {
+		if h.UserID == userID && h.Segment == slug {
+			found++
+		}
+	}
+	require.Equal(t, 2, found)
+
+	require.NoError(t, c.DeleteSegment(ctx, slug))
+	require.NoError(t, c.DeleteUser(ctx, userID))
+	_, err = c.GetUserSegments(ctx, userID)
+	require.ErrorIs(t, err, client.ErrUserNotExists)
+}
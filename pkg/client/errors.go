@@ -0,0 +1,60 @@
+package client
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Errors reported by the service, the same as storage errors on the server side.
+// Use errors.Is to check them, *Error keeps details of the response
+var (
+	ErrSegmentExists    = errors.New("segment exists")
+	ErrSegmentNotExists = errors.New("segment not exists")
+	ErrUserExists       = errors.New("user exists")
+	ErrUserNotExists    = errors.New("user not exists")
+	ErrUserDelete       = errors.New("delete user from user segments table")
+	ErrSegmentDelete    = errors.New("delete segment from user segments table")
+	ErrSegmentsConflict = errors.New("segments are both added and removed")
+	ErrInvalidRequest   = errors.New("invalid request")
+	ErrUnauthorized     = errors.New("unauthorized")
+	ErrForbidden        = errors.New("forbidden")
+	ErrInternal         = errors.New("internal service error")
+)
+
+// Problem codes of the service
+var codeErrors = map[string]error{
+	"invalid_request":   ErrInvalidRequest,
+	"validation_failed": ErrInvalidRequest,
+	"user_not_found":    ErrUserNotExists,
+	"user_exists":       ErrUserExists,
+	"user_in_use":       ErrUserDelete,
+	"segment_not_found": ErrSegmentNotExists,
+	"segment_exists":    ErrSegmentExists,
+	"segment_in_use":    ErrSegmentDelete,
+	"segments_conflict": ErrSegmentsConflict,
+	"forbidden":         ErrForbidden,
+	"internal_error":    ErrInternal,
+}
+
+// Error is a failed response of the service
+type Error struct {
+	StatusCode int
+	Code       string
+	Detail     string
+	RequestID  string
+
+	err error
+	// Earlier attempt of the request got no response, so the server may have applied it
+	unanswered bool
+}
+
+func (e *Error) Error() string {
+	if e.Code == "" {
+		return fmt.Sprintf("avito-tech-service: status %d: %s", e.StatusCode, e.Detail)
+	}
+	return fmt.Sprintf("avito-tech-service: status %d, %s: %s", e.StatusCode, e.Code, e.Detail)
+}
+
+func (e *Error) Unwrap() error {
+	return e.err
+}
@@ -0,0 +1,71 @@
+package client
+
+import (
+	"context"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// Operation of history record
+const (
+	OperationAdd    = "add"
+	OperationRemove = "remove"
+)
+
+const datetimeLayout = "2006-01-02 15:04:05"
+
+type HistoryRecord struct {
+	UserID    int
+	Segment   string
+	Operation string
+	CreatedAt time.Time
+}
+
+// GetHistory returns changes of user segments during the month
+func (c *Client) GetHistory(ctx context.Context, year int, month time.Month) ([]HistoryRecord, error) {
+	query := url.Values{"period": {fmt.Sprintf("%04d-%02d", year, month)}}
+
+	resp, err := c.send(ctx, http.MethodGet, "/reports/history", query, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	cr := csv.NewReader(resp.Body)
+	cr.Comma = ';'
+	cr.FieldsPerRecord = 4
+
+	var history []HistoryRecord
+	for {
+		row, err := cr.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("decode response: %w", err)
+		}
+
+		user, err := strconv.Atoi(row[0])
+		if err != nil {
+			return nil, fmt.Errorf("decode response: %w", err)
+		}
+		createdAt, err := time.Parse(datetimeLayout, row[3])
+		if err != nil {
+			return nil, fmt.Errorf("decode response: %w", err)
+		}
+
+		history = append(history, HistoryRecord{
+			UserID:    user,
+			Segment:   row[1],
+			Operation: row[2],
+			CreatedAt: createdAt,
+		})
+	}
+
+	return history, nil
+}
@@ -0,0 +1,145 @@
+package client
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// Sorting of segments list
+const (
+	SortByName      = "name"
+	SortByCreatedAt = "created_at"
+	SortBySize      = "size"
+)
+
+type Segment struct {
+	Slug        string    `json:"slug"`
+	AutoPercent int       `json:"auto_percent"`
+	CreatedAt   time.Time `json:"created_at"`
+	Users       int       `json:"users"`
+}
+
+type ListSegmentsOptions struct {
+	Prefix string
+	SortBy string
+	Desc   bool
+	Limit  int
+	// NextCursor of the previous page
+	Cursor string
+}
+
+type SegmentsPage struct {
+	Segments []Segment `json:"segments"`
+	// Empty on the last page
+	NextCursor string `json:"next_cursor"`
+}
+
+type SegmentUsersPage struct {
+	Users []int `json:"users"`
+	// Empty on the last page
+	NextCursor string `json:"next_cursor"`
+}
+
+func segmentPath(slug string) string {
+	return "/segments/" + url.PathEscape(slug)
+}
+
+// CreateSegment creates segment and adds autoPercent of existing users to it
+func (c *Client) CreateSegment(ctx context.Context, slug string, autoPercent int) error {
+	req := struct {
+		Slug        string `json:"slug"`
+		AutoPercent int    `json:"auto_percent,omitempty"`
+	}{slug, autoPercent}
+
+	return c.do(ctx, http.MethodPost, "/segments", nil, req, nil)
+}
+
+// DeleteSegment deletes segment without users
+func (c *Client) DeleteSegment(ctx context.Context, slug string) error {
+	err := c.do(ctx, http.MethodDelete, segmentPath(slug), nil, nil, nil)
+	if appliedBefore(err, ErrSegmentNotExists) {
+		return nil
+	}
+
+	return err
+}
+
+// GetSegment returns segment with its size
+func (c *Client) GetSegment(ctx context.Context, slug string) (Segment, error) {
+	var segment Segment
+	err := c.do(ctx, http.MethodGet, segmentPath(slug), nil, nil, &segment)
+
+	return segment, err
+}
+
+// ListSegments returns one page of segments
+func (c *Client) ListSegments(ctx context.Context, opts ListSegmentsOptions) (SegmentsPage, error) {
+	query := url.Values{}
+	if opts.Prefix != "" {
+		query.Set("prefix", opts.Prefix)
+	}
+	if opts.SortBy != "" {
+		query.Set("sort", opts.SortBy)
+	}
+	if opts.Desc {
+		query.Set("order", "desc")
+	}
+	if opts.Limit > 0 {
+		query.Set("limit", strconv.Itoa(opts.Limit))
+	}
+	if opts.Cursor != "" {
+		query.Set("cursor", opts.Cursor)
+	}
+
+	var page SegmentsPage
+	err := c.do(ctx, http.MethodGet, "/segments", query, nil, &page)
+
+	return page, err
+}
+
+// GetSegmentUsers returns one page of segment users ordered by id,
+// cursor is NextCursor of the previous page or empty for the first one
+func (c *Client) GetSegmentUsers(ctx context.Context, slug, cursor string, limit int) (SegmentUsersPage, error) {
+	query := url.Values{}
+	if limit > 0 {
+		query.Set("limit", strconv.Itoa(limit))
+	}
+	if cursor != "" {
+		query.Set("cursor", cursor)
+	}
+
+	var page SegmentUsersPage
+	err := c.do(ctx, http.MethodGet, segmentPath(slug)+"/users", query, nil, &page)
+
+	return page, err
+}
+
+// ExportSegmentUsers streams all users of segment to fn, stopping on its first error
+func (c *Client) ExportSegmentUsers(ctx context.Context, slug string, fn func(user int) error) error {
+	resp, err := c.send(ctx, http.MethodGet, segmentPath(slug)+"/users", url.Values{"format": {"ndjson"}}, nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	sc := bufio.NewScanner(resp.Body)
+	for sc.Scan() {
+		var row struct {
+			UserID int `json:"user_id"`
+		}
+		if err := json.Unmarshal(sc.Bytes(), &row); err != nil {
+			return fmt.Errorf("decode response: %w", err)
+		}
+		if err := fn(row.UserID); err != nil {
+			return err
+		}
+	}
+
+	return sc.Err()
+}
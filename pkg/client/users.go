@@ -0,0 +1,142 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// Result of adding or removing one segment of user
+const (
+	ResultAdded          = "added"
+	ResultAlreadyMember  = "already_member"
+	ResultUnknownSegment = "unknown_segment"
+	ResultRemoved        = "removed"
+	ResultNotMember      = "not_member"
+)
+
+// UserSegment is a segment to add to user. Membership is permanent
+// unless TTL or ExpiresAt is set, they can't be set both
+type UserSegment struct {
+	Slug      string
+	TTL       time.Duration
+	ExpiresAt *time.Time
+}
+
+func (s UserSegment) MarshalJSON() ([]byte, error) {
+	seg := struct {
+		Slug      string     `json:"slug"`
+		TTL       string     `json:"ttl,omitempty"`
+		ExpiresAt *time.Time `json:"expires_at,omitempty"`
+	}{
+		Slug:      s.Slug,
+		ExpiresAt: s.ExpiresAt,
+	}
+	if s.TTL != 0 {
+		seg.TTL = s.TTL.String()
+	}
+
+	return json.Marshal(seg)
+}
+
+type SegmentResult struct {
+	Slug   string `json:"slug"`
+	Result string `json:"result"`
+}
+
+type slugRequest struct {
+	Slug string `json:"slug"`
+}
+
+func userPath(user int) string {
+	return "/users/" + strconv.Itoa(user)
+}
+
+// CreateUser registers user, ErrUserExists is returned for known user
+func (c *Client) CreateUser(ctx context.Context, user int) error {
+	err := c.do(ctx, http.MethodPut, userPath(user), nil, nil, nil)
+	if appliedBefore(err, ErrUserExists) {
+		return nil
+	}
+
+	return err
+}
+
+// DeleteUser deletes user without segments
+func (c *Client) DeleteUser(ctx context.Context, user int) error {
+	err := c.do(ctx, http.MethodDelete, userPath(user), nil, nil, nil)
+	if appliedBefore(err, ErrUserNotExists) {
+		return nil
+	}
+
+	return err
+}
+
+// GetUserSegments returns active segments of user
+func (c *Client) GetUserSegments(ctx context.Context, user int) ([]string, error) {
+	var resp struct {
+		Segments []string `json:"segments"`
+	}
+	if err := c.do(ctx, http.MethodGet, userPath(user)+"/segments", nil, nil, &resp); err != nil {
+		return nil, err
+	}
+
+	return resp.Segments, nil
+}
+
+// AddSegmentsToUser adds segments to user and reports result for every segment
+func (c *Client) AddSegmentsToUser(ctx context.Context, user int, segments []UserSegment) ([]SegmentResult, error) {
+	req := struct {
+		Segments []UserSegment `json:"segments"`
+	}{segments}
+
+	var resp struct {
+		Segments []SegmentResult `json:"segments"`
+	}
+	if err := c.do(ctx, http.MethodPost, userPath(user)+"/segments", nil, req, &resp); err != nil {
+		return nil, err
+	}
+
+	return resp.Segments, nil
+}
+
+// RemoveSegmentsFromUser removes segments from user and reports result for every segment
+func (c *Client) RemoveSegmentsFromUser(ctx context.Context, user int, slugs []string) ([]SegmentResult, error) {
+	query := url.Values{"slug": slugs}
+
+	var resp struct {
+		Segments []SegmentResult `json:"segments"`
+	}
+	if err := c.do(ctx, http.MethodDelete, userPath(user)+"/segments", query, nil, &resp); err != nil {
+		return nil, err
+	}
+
+	return resp.Segments, nil
+}
+
+// UpdateUserSegments adds and removes segments of user in one transaction
+// and returns active segments after update
+func (c *Client) UpdateUserSegments(ctx context.Context, user int, add []UserSegment, remove []string) (
+	[]string, []SegmentResult, error) {
+
+	req := struct {
+		Add    []UserSegment `json:"add,omitempty"`
+		Remove []slugRequest `json:"remove,omitempty"`
+	}{Add: add}
+	for _, slug := range remove {
+		req.Remove = append(req.Remove, slugRequest{Slug: slug})
+	}
+
+	var resp struct {
+		Segments []string        `json:"segments"`
+		Results  []SegmentResult `json:"results"`
+	}
+	if err := c.do(ctx, http.MethodPatch, userPath(user)+"/segments", nil, req, &resp); err != nil {
+		return nil, nil, err
+	}
+
+	return resp.Segments, resp.Results, nil
+}
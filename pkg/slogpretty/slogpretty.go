@@ -49,12 +49,18 @@ func (h *PrettyHandler) Handle(_ context.Context, r slog.Record) error {
 	fields := make(map[string]interface{}, r.NumAttrs())
 
 	r.Attrs(func(a slog.Attr) bool {
+		if a.Equal(slog.Attr{}) {
+			return true
+		}
 		fields[a.Key] = a.Value.Any()
 
 		return true
 	})
 
 	for _, a := range h.attrs {
+		if a.Equal(slog.Attr{}) {
+			continue
+		}
 		fields[a.Key] = a.Value.Any()
 	}
 